@@ -8,6 +8,7 @@ import (
 
 	"github.com/goccy/go-json"
 	"github.com/macrat/ayd/internal/logconv"
+	"github.com/macrat/ayd/internal/store"
 	api "github.com/macrat/ayd/lib-ayd"
 	"github.com/mattn/go-isatty"
 	"github.com/spf13/pflag"
@@ -36,6 +37,7 @@ Options:
   -j, --json    Convert to JSON.
   -l, --ltsv    Convert to LTSV.
   -x, --xlsx    Convert to XLSX.
+  -s, --sqlite  Import into SQLite database. Please set output path by -o.
 
   -h, --help    Show this help message and exit.
 `
@@ -59,6 +61,7 @@ func (c ConvCommand) Run(args []string) int {
 	toJson := flags.BoolP("json", "j", false, "Convert to JSON")
 	toLtsv := flags.BoolP("ltsv", "l", false, "Convert to LTSV")
 	toXlsx := flags.BoolP("xlsx", "x", false, "Convert to XLSX")
+	toSQLite := flags.BoolP("sqlite", "s", false, "Import into SQLite database")
 
 	help := flags.BoolP("help", "h", false, "Show this message and exit")
 
@@ -86,30 +89,43 @@ func (c ConvCommand) Run(args []string) int {
 	if *toXlsx {
 		count++
 	}
+	if *toSQLite {
+		count++
+	}
 	if count > 1 {
 		fmt.Fprintln(c.ErrStream, "error: flags for output format can not use multiple in the same time.")
 		return 2
 	}
 
+	inputs := flags.Args()[2:]
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
 	var scanners jointScanner
-	for _, path := range flags.Args()[2:] {
-		if path == "" || path == "-" {
-			scanners = append(scanners, api.NewLogScanner(io.NopCloser(c.InStream)))
-		} else {
-			f, err := os.Open(path)
-			if err != nil {
-				fmt.Fprintf(c.ErrStream, "error: failed to open input log file: %s\n", err)
-				return 1
-			}
-			s := api.NewLogScanner(f)
-			scanners = append(scanners, s)
+	for _, path := range inputs {
+		r, err := c.openInput(path)
+		if err != nil {
+			(&scanners).Close()
+			fmt.Fprintf(c.ErrStream, "error: failed to open input log file: %s\n", err)
+			return 1
 		}
-	}
-	if len(scanners) == 0 {
-		scanners = append(scanners, api.NewLogScanner(io.NopCloser(c.InStream)))
+		scanners = append(scanners, api.NewLogScanner(r))
 	}
 	defer (&scanners).Close()
 
+	if *toSQLite {
+		if *outputPath == "" || *outputPath == "-" {
+			fmt.Fprintln(c.ErrStream, "error: can not write SQLite database to stdout. please use -o option.")
+			return 2
+		}
+		if _, err := store.ImportToSQLite(*outputPath, &scanners); err != nil {
+			fmt.Fprintf(c.ErrStream, "error: failed to import into SQLite database: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
 	output := c.OutStream
 	if *outputPath != "" && *outputPath != "-" {
 		f, err := os.Create(*outputPath)
@@ -143,6 +159,25 @@ func (c ConvCommand) Run(args []string) int {
 	}
 }
 
+// openInput opens an input log file, or stdin if path is empty or "-".
+// Compressed input is decompressed transparently.
+func (c ConvCommand) openInput(path string) (io.ReadCloser, error) {
+	if path == "" || path == "-" {
+		return store.NewDecompressReader(io.NopCloser(c.InStream))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := store.NewDecompressReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
 func (c ConvCommand) toJson(s api.LogScanner, output io.Writer) error {
 	if _, err := output.Write([]byte("[\n  ")); err != nil {
 		return fmt.Errorf("failed to write log: %s", err)
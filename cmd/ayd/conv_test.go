@@ -2,6 +2,7 @@ package main_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	_ "embed"
 	"io"
 	"os"
@@ -9,9 +10,11 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/macrat/ayd/cmd/ayd"
+	"github.com/macrat/ayd/internal/store"
 	"github.com/macrat/ayd/internal/testutil"
 )
 
@@ -165,6 +168,43 @@ func TestConvCommand_Run(t *testing.T) {
 	})
 }
 
+func TestConvCommand_Run_compressed(t *testing.T) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte(testutil.DummyLog))
+	w.Close()
+
+	fpath := filepath.Join(t.TempDir(), "ayd.log.gz")
+	if err := os.WriteFile(fpath, compressed.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to prepare compressed log: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin []byte
+	}{
+		{"file", []string{"-c", fpath}, nil},
+		{"stdin", []string{"-c"}, compressed.Bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := bytes.NewBuffer(nil)
+			stderr := bytes.NewBuffer(nil)
+			cmd := main.ConvCommand{bytes.NewReader(tt.stdin), stdout, stderr}
+
+			if code := cmd.Run(append([]string{"ayd", "conv"}, tt.args...)); code != 0 {
+				t.Errorf("unexpected exit code: %d\n%s", code, stderr.String())
+			}
+
+			if diff := cmp.Diff(testLogCSV, stdout.String()); diff != "" {
+				t.Errorf("unexpected stdout\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestConvCommand_Run_xlsx(t *testing.T) {
 	stdin := strings.NewReader(testutil.DummyLog)
 	output := bytes.NewBuffer(nil)
@@ -208,3 +248,44 @@ func TestConvCommand_Run_xlsx(t *testing.T) {
 		}
 	}
 }
+
+func TestConvCommand_Run_sqlite(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "ayd.db")
+
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	cmd := main.ConvCommand{strings.NewReader(testutil.DummyLog), stdout, stderr}
+
+	if code := cmd.Run([]string{"ayd", "conv", "-s", "-o", dbpath}); code != 0 {
+		t.Fatalf("unexpected exit code: %d\n%s", code, stderr.String())
+	}
+
+	s, err := store.New("", store.SQLitePrefix+dbpath, io.Discard)
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer s.Close()
+
+	r, err := s.OpenLog(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to open log: %s", err)
+	}
+	defer r.Close()
+
+	count := 0
+	for r.Scan() {
+		count++
+	}
+	if count != 7 {
+		t.Errorf("unexpected number of records: %d", count)
+	}
+
+	stderr.Reset()
+	cmd = main.ConvCommand{strings.NewReader(testutil.DummyLog), stdout, stderr}
+	if code := cmd.Run([]string{"ayd", "conv", "-s"}); code != 2 {
+		t.Errorf("unexpected exit code without output path: %d", code)
+	}
+	if stderr.String() != "error: can not write SQLite database to stdout. please use -o option.\n" {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+}
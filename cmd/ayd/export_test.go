@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// SetTLSCheckInterval replaces the interval to check updates of the TLS files until the end of the test.
+func SetTLSCheckInterval(t testing.TB, d time.Duration) {
+	old := tlsCheckInterval.Swap(int64(d))
+	t.Cleanup(func() {
+		tlsCheckInterval.Store(old)
+	})
+}
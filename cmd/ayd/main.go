@@ -5,12 +5,17 @@ import (
 	_ "embed"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"strings"
 	"text/template"
 	"time"
 
+	"github.com/dustin/go-humanize"
+	"github.com/macrat/ayd/internal/logconv"
 	"github.com/macrat/ayd/internal/meta"
 	"github.com/macrat/ayd/internal/scheme"
+	"github.com/macrat/ayd/internal/sink"
 	"github.com/macrat/ayd/internal/store"
 	api "github.com/macrat/ayd/lib-ayd"
 	"github.com/spf13/pflag"
@@ -20,16 +25,32 @@ type AydCommand struct {
 	OutStream io.Writer
 	ErrStream io.Writer
 
-	ListenPort   int
-	StorePath    string
-	InstanceName string
-	OneshotMode  bool
-	AlertURLs    []string
-	UserInfo     string
-	CertPath     string
-	KeyPath      string
-	ShowVersion  bool
-	ShowHelp     bool
+	ListenPort    int
+	StorePath     string
+	LogCompress   string
+	LogRetention  time.Duration
+	LogMaxSize    string
+	LogArchive    string
+	LogRotate     string
+	LogRollup     bool
+	LogSinks      []string
+	ConsoleFormat string
+	InstanceName  string
+	OneshotMode   bool
+	AlertURLs     []string
+	MaskQuery     []string
+	UserInfo      string
+	CertPath      string
+	KeyPath       string
+	ClientCAPath  string
+	BasePath      string
+	ExternalURL   string
+	OTLPEndpoint  string
+	OTLPHeaders   []string
+	OTLPInterval  time.Duration
+	OTLPTraces    bool
+	ShowVersion   bool
+	ShowHelp      bool
 
 	Tasks     []Task
 	StartedAt time.Time
@@ -57,12 +78,28 @@ func (cmd *AydCommand) ParseArgs(args []string) (exitCode int) {
 
 	flags.IntVarP(&cmd.ListenPort, "port", "p", 9000, "HTTP listen port")
 	flags.StringVarP(&cmd.StorePath, "log-file", "f", "ayd_%Y%m%d.log", "Path to log file")
+	flags.StringVar(&cmd.LogCompress, "log-compress", "", "Compression method for old log files")
+	flags.StringVar(&cmd.LogRotate, "log-rotate-size", "", "Size to rotate log file")
+	flags.DurationVar(&cmd.LogRetention, "log-retention", 0, "Maximum age of log files")
+	flags.StringVar(&cmd.LogMaxSize, "log-max-size", "", "Maximum total size of log files")
+	flags.StringVar(&cmd.LogArchive, "log-archive-dir", "", "Directory to move old log files into")
+	flags.BoolVar(&cmd.LogRollup, "log-rollup", false, "Write hourly and daily rollups for long-term history")
+	flags.StringArrayVar(&cmd.LogSinks, "log-sink", nil, "URL to send logs in addition to the log file")
+	flags.StringVar(&cmd.ConsoleFormat, "console-format", "json", "Format of logs on console")
 	flags.StringVarP(&cmd.InstanceName, "name", "n", "", "Instance name")
 	flags.BoolVarP(&cmd.OneshotMode, "oneshot", "1", false, "Check status only once and exit")
 	flags.StringArrayVarP(&cmd.AlertURLs, "alert", "a", nil, "The alert URLs")
+	flags.StringArrayVar(&cmd.MaskQuery, "mask-query", nil, "Query keys of target URLs to mask")
 	flags.StringVarP(&cmd.UserInfo, "user", "u", "", "Username and password for HTTP endpoint")
 	flags.StringVarP(&cmd.CertPath, "ssl-cert", "c", "", "HTTPS certificate file")
 	flags.StringVarP(&cmd.KeyPath, "ssl-key", "k", "", "HTTPS key file")
+	flags.StringVar(&cmd.ClientCAPath, "ssl-client-ca", "", "CA certificate file to verify HTTPS clients")
+	flags.StringVar(&cmd.BasePath, "base-path", "", "Path prefix of status page")
+	flags.StringVar(&cmd.ExternalURL, "external-url", os.Getenv("AYD_URL"), "URL to access to status page")
+	flags.StringVar(&cmd.OTLPEndpoint, "otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP endpoint to export metrics and traces")
+	flags.StringArrayVar(&cmd.OTLPHeaders, "otlp-header", nil, "HTTP header for OTLP exporter")
+	flags.DurationVar(&cmd.OTLPInterval, "otlp-interval", time.Minute, "Interval to export metrics via OTLP")
+	flags.BoolVar(&cmd.OTLPTraces, "otlp-traces", false, "Export each check as a span via OTLP")
 	flags.BoolVarP(&cmd.ShowVersion, "version", "v", false, "Show version")
 	flags.BoolVarP(&cmd.ShowHelp, "help", "h", false, "Show help message")
 
@@ -86,17 +123,111 @@ func (cmd *AydCommand) ParseArgs(args []string) (exitCode int) {
 		if flags.Changed("ssl-cert") || flags.Changed("ssl-key") {
 			fmt.Fprintln(cmd.ErrStream, "warning: ssl cert and key options will ignored in the oneshot mode.")
 		}
+		if flags.Changed("ssl-client-ca") {
+			fmt.Fprintln(cmd.ErrStream, "warning: ssl client CA option will ignored in the oneshot mode.")
+		}
+		if flags.Changed("base-path") {
+			fmt.Fprintln(cmd.ErrStream, "warning: base path option will ignored in the oneshot mode.")
+		}
 	} else {
 		if cmd.CertPath != "" && cmd.KeyPath == "" || cmd.CertPath == "" && cmd.KeyPath != "" {
 			fmt.Fprintln(cmd.ErrStream, "invalid argument: the both of -c and -k option is required if you want to use HTTPS.")
 			return 2
 		}
+		if cmd.ClientCAPath != "" && cmd.CertPath == "" {
+			fmt.Fprintln(cmd.ErrStream, "invalid argument: --ssl-client-ca option requires -c and -k option.")
+			return 2
+		}
+	}
+
+	if cmd.ExternalURL != "" {
+		if u, err := url.Parse(cmd.ExternalURL); err != nil || u.Scheme == "" || u.Host == "" {
+			fmt.Fprintf(cmd.ErrStream, "invalid argument: external URL must be an absolute URL: %s\n", cmd.ExternalURL)
+			return 2
+		}
+	}
+
+	if cmd.OTLPEndpoint != "" {
+		if u, err := url.Parse(cmd.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(cmd.ErrStream, "invalid argument: OTLP endpoint must be a HTTP or HTTPS URL: %s\n", cmd.OTLPEndpoint)
+			return 2
+		}
+		for _, h := range cmd.OTLPHeaders {
+			if k, _, ok := strings.Cut(h, "="); !ok || strings.TrimSpace(k) == "" {
+				fmt.Fprintf(cmd.ErrStream, "invalid argument: OTLP header must be KEY=VALUE format: %s\n", h)
+				return 2
+			}
+		}
+		if cmd.OTLPInterval <= 0 {
+			fmt.Fprintln(cmd.ErrStream, "invalid argument: OTLP interval must be greater than 0.")
+			return 2
+		}
+	}
+
+	if _, err := store.ParseCompression(cmd.LogCompress); err != nil {
+		fmt.Fprintf(cmd.ErrStream, "invalid argument: log compression method must be gzip or zstd: %s\n", cmd.LogCompress)
+		return 2
 	}
 
 	if cmd.StorePath == "-" {
 		cmd.StorePath = ""
 	}
 
+	if store.IsSQLitePath(cmd.StorePath) && (cmd.LogCompress != "" || cmd.LogRotate != "" || cmd.LogRetention != 0 || cmd.LogMaxSize != "" || cmd.LogRollup) {
+		fmt.Fprintln(cmd.ErrStream, "invalid argument: log file options like --log-compress or --log-retention can not be used with SQLite database.")
+		return 2
+	}
+
+	if cmd.LogRotate != "" {
+		if _, err := humanize.ParseBytes(cmd.LogRotate); err != nil {
+			fmt.Fprintf(cmd.ErrStream, "invalid argument: log rotate size must be a size like 100MB: %s\n", cmd.LogRotate)
+			return 2
+		}
+		if cmd.StorePath != "" && !store.ParsePathPattern(cmd.StorePath).HasSeq() {
+			fmt.Fprintln(cmd.ErrStream, "invalid argument: --log-rotate-size option requires %N in the log file name.")
+			return 2
+		}
+	}
+
+	if cmd.LogRetention < 0 {
+		fmt.Fprintln(cmd.ErrStream, "invalid argument: log retention must be greater than 0.")
+		return 2
+	}
+	if cmd.LogMaxSize != "" {
+		if _, err := humanize.ParseBytes(cmd.LogMaxSize); err != nil {
+			fmt.Fprintf(cmd.ErrStream, "invalid argument: log max size must be a size like 10GB: %s\n", cmd.LogMaxSize)
+			return 2
+		}
+	}
+	if (cmd.LogRetention > 0 || cmd.LogMaxSize != "") && cmd.StorePath != "" && !store.ParsePathPattern(cmd.StorePath).HasTimeSpec() {
+		fmt.Fprintln(cmd.ErrStream, "invalid argument: --log-retention and --log-max-size options require time specs like %Y in the log file name.")
+		return 2
+	}
+	if cmd.LogArchive != "" && cmd.LogRetention == 0 && cmd.LogMaxSize == "" {
+		fmt.Fprintln(cmd.ErrStream, "warning: log archive directory option will ignored without --log-retention or --log-max-size option.")
+	}
+	if cmd.LogRollup && cmd.StorePath == "" {
+		fmt.Fprintln(cmd.ErrStream, "warning: log rollup option will ignored because log file is disabled.")
+	}
+
+	if _, err := logconv.ParseFormat(cmd.ConsoleFormat); err != nil {
+		fmt.Fprintf(cmd.ErrStream, "invalid argument: console format must be json, ltsv, or text: %s\n", cmd.ConsoleFormat)
+		return 2
+	}
+	for _, u := range cmd.LogSinks {
+		if err := sink.Check(u); err != nil {
+			fmt.Fprintf(cmd.ErrStream, "invalid argument: invalid log sink URL: %s: %s\n", u, err)
+			return 2
+		}
+	}
+
+	for _, k := range cmd.MaskQuery {
+		if strings.TrimSpace(k) == "" {
+			fmt.Fprintln(cmd.ErrStream, "invalid argument: --mask-query option requires a query key.")
+			return 2
+		}
+	}
+
 	var err error
 	cmd.Tasks, err = ParseArgs(flags.Args())
 	if err != nil {
@@ -136,12 +267,34 @@ func (cmd *AydCommand) Run(args []string) (exitCode int) {
 		fmt.Fprintf(cmd.ErrStream, "error: failed to open log file: %s\n", err)
 		return 1
 	}
+	s.Compression, _ = store.ParseCompression(cmd.LogCompress)
+	s.Retention.MaxAge = cmd.LogRetention
+	s.Retention.ArchiveDir = cmd.LogArchive
+	s.Rollup = cmd.LogRollup
+	s.Masker = api.NewSecretMasker(cmd.MaskQuery...)
+	s.ConsoleFormat, _ = logconv.ParseFormat(cmd.ConsoleFormat)
+	s.ConsoleColor = s.ConsoleFormat == logconv.FormatText && isColorTerminal(cmd.OutStream)
+	if cmd.LogMaxSize != "" {
+		size, _ := humanize.ParseBytes(cmd.LogMaxSize)
+		s.Retention.MaxSize = int64(size)
+	}
+	if cmd.LogRotate != "" {
+		size, _ := humanize.ParseBytes(cmd.LogRotate)
+		s.MaxFileSize = int64(size)
+	}
+
+	closeSinks, err := cmd.OpenLogSinks(s)
+	if err != nil {
+		fmt.Fprintf(cmd.ErrStream, "error: failed to open log sink: %s\n", err)
+		s.Close()
+		return 1
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	if len(cmd.AlertURLs) > 0 {
-		alert, err := scheme.NewAlerterSet(cmd.AlertURLs)
+		alert, err := scheme.NewAlerterSet(cmd.AlertURLs, cmd.ExternalURL)
 		if err != nil {
 			fmt.Fprintln(cmd.ErrStream, err)
 			s.Close()
@@ -152,12 +305,23 @@ func (cmd *AydCommand) Run(args []string) (exitCode int) {
 		})
 	}
 
+	var stopExporter func()
+	if cmd.OTLPEndpoint != "" {
+		stopExporter = cmd.StartOTLPExporter(ctx, s)
+	}
+
 	if cmd.OneshotMode {
 		exitCode = cmd.RunOneshot(ctx, s)
 	} else {
 		exitCode = cmd.RunServer(ctx, s)
 	}
 
+	if stopExporter != nil {
+		stopExporter()
+	}
+
+	// The sinks are closed before the Store, because they report their errors to the Store.
+	closeSinks()
 	s.Close()
 
 	healthy, _ := s.Errors()
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/macrat/ayd/cmd/ayd"
 )
@@ -84,6 +85,16 @@ func TestAydCommand_ParseArgs(t *testing.T) {
 			Pattern:  "warning: ssl cert and key options will ignored in the oneshot mode\\.\n",
 			ExitCode: 0,
 		},
+		{
+			Args:     []string{"ayd", "-1", "--ssl-client-ca", "./path/to/ca", "dummy:"},
+			Pattern:  "warning: ssl client CA option will ignored in the oneshot mode\\.\n",
+			ExitCode: 0,
+		},
+		{
+			Args:     []string{"ayd", "--ssl-client-ca", "./path/to/ca", "dummy:"},
+			Pattern:  "invalid argument: --ssl-client-ca option requires -c and -k option\\.\n",
+			ExitCode: 2,
+		},
 		{
 			Args:     []string{"ayd", "-c", "./path/to/cert", "dummy:"},
 			Pattern:  "invalid argument: the both of -c and -k option is required if you want to use HTTPS\\.\n",
@@ -94,6 +105,165 @@ func TestAydCommand_ParseArgs(t *testing.T) {
 			Pattern:  "invalid argument: the both of -c and -k option is required if you want to use HTTPS\\.\n",
 			ExitCode: 2,
 		},
+		{
+			Args:     []string{"ayd", "--external-url", "/monitoring/", "dummy:"},
+			Pattern:  "invalid argument: external URL must be an absolute URL: /monitoring/\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "--base-path", "/monitoring/", "--external-url", "https://example.com/monitoring/", "dummy:"},
+			ExitCode: 0,
+			Extra: func(t *testing.T, cmd main.AydCommand) {
+				if cmd.BasePath != "/monitoring/" {
+					t.Errorf("unexpected BasePath: %q", cmd.BasePath)
+				}
+				if cmd.ExternalURL != "https://example.com/monitoring/" {
+					t.Errorf("unexpected ExternalURL: %q", cmd.ExternalURL)
+				}
+			},
+		},
+		{
+			Args:     []string{"ayd", "--otlp-endpoint", "localhost:4318", "dummy:"},
+			Pattern:  "invalid argument: OTLP endpoint must be a HTTP or HTTPS URL: localhost:4318\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "--otlp-endpoint", "http://localhost:4318", "--otlp-header", "no-value", "dummy:"},
+			Pattern:  "invalid argument: OTLP header must be KEY=VALUE format: no-value\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "--otlp-endpoint", "http://localhost:4318", "--otlp-interval", "0s", "dummy:"},
+			Pattern:  "invalid argument: OTLP interval must be greater than 0\\.\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "--log-compress", "bzip2", "dummy:"},
+			Pattern:  "invalid argument: log compression method must be gzip or zstd: bzip2\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "-f", "ayd.log", "--log-retention", "720h", "dummy:"},
+			Pattern:  "invalid argument: --log-retention and --log-max-size options require time specs like %Y in the log file name\\.\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "--log-max-size", "large", "dummy:"},
+			Pattern:  "invalid argument: log max size must be a size like 10GB: large\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "--log-archive-dir", "./archive", "dummy:"},
+			Pattern:  "warning: log archive directory option will ignored without --log-retention or --log-max-size option\\.\n",
+			ExitCode: 0,
+		},
+		{
+			Args:     []string{"ayd", "--log-retention", "720h", "--log-max-size", "10GB", "--log-archive-dir", "./archive", "dummy:"},
+			ExitCode: 0,
+			Extra: func(t *testing.T, cmd main.AydCommand) {
+				if cmd.LogRetention != 720*time.Hour || cmd.LogMaxSize != "10GB" || cmd.LogArchive != "./archive" {
+					t.Errorf("unexpected log retention options: %s %s %s", cmd.LogRetention, cmd.LogMaxSize, cmd.LogArchive)
+				}
+			},
+		},
+		{
+			Args:     []string{"ayd", "--log-rotate-size", "100MB", "dummy:"},
+			Pattern:  "invalid argument: --log-rotate-size option requires %N in the log file name\\.\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "-f", "ayd_%Y%m%d.%N.log", "--log-rotate-size", "huge", "dummy:"},
+			Pattern:  "invalid argument: log rotate size must be a size like 100MB: huge\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "-f", "ayd_%Y%m%d.%N.log", "--log-rotate-size", "100MB", "dummy:"},
+			ExitCode: 0,
+			Extra: func(t *testing.T, cmd main.AydCommand) {
+				if cmd.LogRotate != "100MB" {
+					t.Errorf("unexpected log rotate size: %s", cmd.LogRotate)
+				}
+			},
+		},
+		{
+			Args:     []string{"ayd", "-f", "sqlite:ayd.db", "--log-retention", "720h", "dummy:"},
+			Pattern:  "invalid argument: log file options like --log-compress or --log-retention can not be used with SQLite database\\.\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "--log-rollup", "dummy:"},
+			ExitCode: 0,
+			Extra: func(t *testing.T, cmd main.AydCommand) {
+				if !cmd.LogRollup {
+					t.Errorf("log rollup is not enabled")
+				}
+			},
+		},
+		{
+			Args:     []string{"ayd", "-f", "-", "--log-rollup", "dummy:"},
+			Pattern:  "warning: log rollup option will ignored because log file is disabled\\.\n",
+			ExitCode: 0,
+		},
+		{
+			Args:     []string{"ayd", "--mask-query", "X-Test-Mask", "https://example.com/?x-test-mask=hello"},
+			ExitCode: 0,
+			Extra: func(t *testing.T, cmd main.AydCommand) {
+				if len(cmd.Tasks) != 1 {
+					t.Fatalf("unexpected number of tasks: %d", len(cmd.Tasks))
+				}
+				if u := cmd.Tasks[0].Prober.Target().String(); u != "https://example.com/?x-test-mask=hello" {
+					t.Errorf("target URL is modified: %s", u)
+				}
+				if len(cmd.MaskQuery) != 1 || cmd.MaskQuery[0] != "X-Test-Mask" {
+					t.Errorf("unexpected mask keys: %v", cmd.MaskQuery)
+				}
+			},
+		},
+		{
+			Args:     []string{"ayd", "--mask-query", "", "dummy:"},
+			Pattern:  "invalid argument: --mask-query option requires a query key\\.\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "--console-format", "text", "--log-sink", "syslog://localhost?facility=local0", "dummy:"},
+			ExitCode: 0,
+			Extra: func(t *testing.T, cmd main.AydCommand) {
+				if cmd.ConsoleFormat != "text" {
+					t.Errorf("unexpected console format: %s", cmd.ConsoleFormat)
+				}
+				if len(cmd.LogSinks) != 1 || cmd.LogSinks[0] != "syslog://localhost?facility=local0" {
+					t.Errorf("unexpected log sinks: %v", cmd.LogSinks)
+				}
+			},
+		},
+		{
+			Args:     []string{"ayd", "--console-format", "csv", "dummy:"},
+			Pattern:  "invalid argument: console format must be json, ltsv, or text: csv\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "--log-sink", "ftp://example.com", "dummy:"},
+			Pattern:  "invalid argument: invalid log sink URL: ftp://example.com: unsupported scheme for log sink\n",
+			ExitCode: 2,
+		},
+		{
+			Args:     []string{"ayd", "-f", "sqlite:ayd.db", "dummy:"},
+			ExitCode: 0,
+			Extra: func(t *testing.T, cmd main.AydCommand) {
+				if cmd.StorePath != "sqlite:ayd.db" {
+					t.Errorf("unexpected store path: %s", cmd.StorePath)
+				}
+			},
+		},
+		{
+			Args:     []string{"ayd", "--log-compress", "zstd", "dummy:"},
+			ExitCode: 0,
+			Extra: func(t *testing.T, cmd main.AydCommand) {
+				if cmd.LogCompress != "zstd" {
+					t.Errorf("unexpected log compression: %s", cmd.LogCompress)
+				}
+			},
+		},
 		{
 			Args:     []string{"ayd", "-f", "-", "dummy:"},
 			ExitCode: 0,
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/macrat/ayd/internal/otlp"
+	"github.com/macrat/ayd/internal/store"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// StartOTLPExporter starts exporting records in the store via OTLP.
+// The returned function stops the exporter after sending the remaining records.
+func (cmd *AydCommand) StartOTLPExporter(ctx context.Context, s *store.Store) (stop func()) {
+	headers := make(map[string]string)
+	for _, h := range cmd.OTLPHeaders {
+		k, v, _ := strings.Cut(h, "=")
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	e := otlp.New(cmd.OTLPEndpoint, headers, cmd.OTLPTraces, s.Name())
+
+	s.OnReport = append(s.OnReport, func(r api.Record) {
+		e.Observe(r)
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		e.Run(ctx, cmd.OTLPInterval, func(err error) {
+			s.ReportInternalError("otlp", err.Error())
+		})
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
 	"net"
 	"net/http"
@@ -69,6 +70,20 @@ func (cmd *AydCommand) reportStopServer(s *store.Store, protocol, listen string)
 	})
 }
 
+func (cmd *AydCommand) reportReloadCertificate(s *store.Store, cert *x509.Certificate) {
+	u := &api.URL{Scheme: "ayd", Opaque: "endpoint"}
+	s.Report(u, api.Record{
+		Time:    time.Now(),
+		Status:  api.StatusHealthy,
+		Target:  u,
+		Message: "reload TLS certificate",
+		Extra: map[string]interface{}{
+			"not_after":     cert.NotAfter.Format(time.RFC3339),
+			"serial_number": cert.SerialNumber.String(),
+		},
+	})
+}
+
 func (cmd *AydCommand) RunServer(ctx context.Context, s *store.Store) (exitCode int) {
 	startDebugLogger(s)
 
@@ -85,6 +100,26 @@ func (cmd *AydCommand) RunServer(ctx context.Context, s *store.Store) (exitCode
 		}
 	}
 
+	var tlsConfig *tlsLoader
+	if protocol == "https" {
+		tlsConfig = &tlsLoader{
+			CertPath:     cmd.CertPath,
+			KeyPath:      cmd.KeyPath,
+			ClientCAPath: cmd.ClientCAPath,
+			OnReload: func(cert *x509.Certificate, err error) {
+				if err != nil {
+					s.ReportInternalError("endpoint", fmt.Sprintf("failed to reload TLS certificate: %s", err))
+				} else {
+					cmd.reportReloadCertificate(s, cert)
+				}
+			},
+		}
+		if err := tlsConfig.Load(); err != nil {
+			s.ReportInternalError("endpoint", fmt.Sprintf("failed to load TLS certificate: %s", err))
+			return 1
+		}
+	}
+
 	scheduler := cron.New()
 
 	if err := s.Restore(); err != nil {
@@ -134,7 +169,11 @@ func (cmd *AydCommand) RunServer(ctx context.Context, s *store.Store) (exitCode
 	scheduler.Start()
 	defer scheduler.Stop()
 
-	srv := &http.Server{Addr: listen, Handler: endpoint.WithBasicAuth(endpoint.New(s), cmd.UserInfo)}
+	handler := endpoint.New(s, endpoint.Config{
+		BasePath:    cmd.BasePath,
+		ExternalURL: cmd.ExternalURL,
+	})
+	srv := &http.Server{Addr: listen, Handler: endpoint.WithBasicAuth(handler, cmd.UserInfo)}
 
 	wg.Add(2)
 	go func() {
@@ -155,7 +194,8 @@ func (cmd *AydCommand) RunServer(ctx context.Context, s *store.Store) (exitCode
 	}()
 
 	if protocol == "https" {
-		err = srv.ServeTLS(listener, cmd.CertPath, cmd.KeyPath)
+		srv.TLSConfig = tlsConfig.TLSConfig()
+		err = srv.ServeTLS(listener, "", "")
 	} else {
 		err = srv.Serve(listener)
 	}
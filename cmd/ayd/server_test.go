@@ -2,15 +2,18 @@ package main_test
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"regexp"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/macrat/ayd/cmd/ayd"
 	"github.com/macrat/ayd/internal/testutil"
 	api "github.com/macrat/ayd/lib-ayd"
 )
@@ -109,6 +112,163 @@ func TestRunServer_tls(t *testing.T) {
 	wg.Wait()
 }
 
+// startTLSTestServer starts server with cmd, and returns the URL of it.
+func startTLSTestServer(t *testing.T, cmd *main.AydCommand) (url string, stop func()) {
+	t.Helper()
+
+	log, stdout := io.Pipe()
+	s := testutil.NewStore(t, testutil.WithConsole(stdout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		code := cmd.RunServer(ctx, s)
+		if code != 0 {
+			t.Errorf("unexpected return code: %d", code)
+		}
+		wg.Done()
+	}()
+
+	var startMessage struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(log).Decode(&startMessage); err != nil {
+		t.Fatalf("failed to parse start message: %s", err)
+	}
+
+	go func() {
+		// discard all outputs
+		io.Copy(io.Discard, log)
+	}()
+
+	return startMessage.URL, func() {
+		cancel()
+		wg.Wait()
+		s.Close()
+		stdout.Close()
+		log.Close()
+	}
+}
+
+func TestRunServer_tls_clientAuth(t *testing.T) {
+	cert := testutil.NewCertificate(t)
+	ca := testutil.NewCACertificate(t)
+	otherCA := testutil.NewCACertificate(t)
+
+	cmd, _ := MakeTestCommand(t, []string{"dummy:"})
+	cmd.CertPath = cert.CertFile
+	cmd.KeyPath = cert.KeyFile
+	cmd.ClientCAPath = ca.CertFile
+
+	url, stop := startTLSTestServer(t, cmd)
+	defer stop()
+
+	tests := []struct {
+		Name   string
+		Certs  []tls.Certificate
+		Accept bool
+	}{
+		{"no-certificate", nil, false},
+		{"trusted-certificate", []tls.Certificate{testutil.NewClientCertificate(t, ca).TLSCertificate(t)}, true},
+		{"untrusted-certificate", []tls.Certificate{testutil.NewClientCertificate(t, otherCA).TLSCertificate(t)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			client := &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{
+						InsecureSkipVerify: true,
+						Certificates:       tt.Certs,
+					},
+				},
+			}
+
+			resp, err := client.Get(url + "/healthz")
+			if tt.Accept {
+				if err != nil {
+					t.Fatalf("failed to fetch: %s", err)
+				}
+				defer resp.Body.Close()
+				if resp.StatusCode != 200 {
+					t.Errorf("unexpected response status: %s", resp.Status)
+				}
+			} else if err == nil {
+				resp.Body.Close()
+				t.Errorf("expected to be rejected but got response: %s", resp.Status)
+			}
+		})
+	}
+}
+
+func TestRunServer_tls_reload(t *testing.T) {
+	main.SetTLSCheckInterval(t, 0)
+
+	cert := testutil.NewCertificate(t)
+	renewed := testutil.NewCertificate(t)
+
+	cmd, _ := MakeTestCommand(t, []string{"dummy:"})
+	cmd.CertPath = cert.CertFile
+	cmd.KeyPath = cert.KeyFile
+
+	url, stop := startTLSTestServer(t, cmd)
+	defer stop()
+
+	fetchSerial := func() string {
+		t.Helper()
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				DisableKeepAlives: true,
+			},
+		}
+		resp, err := client.Get(url + "/healthz")
+		if err != nil {
+			t.Fatalf("failed to fetch: %s", err)
+		}
+		defer resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber.String()
+	}
+
+	if serial := fetchSerial(); serial != cert.Certificate.SerialNumber.String() {
+		t.Fatalf("unexpected serial number before reload: %s", serial)
+	}
+
+	modTime := time.Now().Add(time.Minute)
+	for src, dst := range map[string]string{renewed.CertFile: cert.CertFile, renewed.KeyFile: cert.KeyFile} {
+		bs, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("failed to read renewed certificate: %s", err)
+		}
+		if err := os.WriteFile(dst, bs, 0600); err != nil {
+			t.Fatalf("failed to write renewed certificate: %s", err)
+		}
+		if err := os.Chtimes(dst, modTime, modTime); err != nil {
+			t.Fatalf("failed to update modification time: %s", err)
+		}
+	}
+
+	if serial := fetchSerial(); serial != renewed.Certificate.SerialNumber.String() {
+		t.Errorf("certificate was not reloaded: got serial number %s", serial)
+	}
+
+	// Keep using current certificate if failed to load the new one.
+	modTime = modTime.Add(time.Minute)
+	if err := os.WriteFile(cert.CertFile, []byte("broken"), 0600); err != nil {
+		t.Fatalf("failed to break certificate: %s", err)
+	}
+	if err := os.Chtimes(cert.CertFile, modTime, modTime); err != nil {
+		t.Fatalf("failed to update modification time: %s", err)
+	}
+
+	if serial := fetchSerial(); serial != renewed.Certificate.SerialNumber.String() {
+		t.Errorf("unexpected serial number after broken update: %s", serial)
+	}
+}
+
 func TestRunServer_tls_error(t *testing.T) {
 	cert := testutil.NewCertificate(t)
 
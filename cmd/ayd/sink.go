@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/macrat/ayd/internal/sink"
+	"github.com/macrat/ayd/internal/store"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// OpenLogSinks opens the log sinks, and sends every record reported to the Store to them.
+// The returned function closes the sinks after sending the queued records.
+func (cmd *AydCommand) OpenLogSinks(s *store.Store) (closeAll func(), err error) {
+	var sinks []*sink.Sink
+
+	closeAll = func() {
+		for _, x := range sinks {
+			x.Close()
+		}
+	}
+
+	for _, u := range cmd.LogSinks {
+		x, err := sink.Open(u, s.Masker, func(name string, err error) {
+			reportSinkError(s, name, err)
+		})
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		sinks = append(sinks, x)
+
+		s.OnReport = append(s.OnReport, func(r api.Record) {
+			// The errors of the sink itself are not sent to the sink, to prevent a dead sink from feeding its own errors.
+			if name, ok := r.Extra[sinkErrorKey]; ok && r.Target.Scheme == "ayd" && name == x.URL {
+				return
+			}
+			x.Send(r)
+		})
+	}
+
+	return closeAll, nil
+}
+
+// sinkErrorKey is the key of the extra field to tell which sink the error record is about.
+const sinkErrorKey = "sink"
+
+// reportSinkError reports an error of the sink named name to the Store.
+func reportSinkError(s *store.Store, name string, err error) {
+	u := &api.URL{Scheme: "ayd", Opaque: "sink"}
+
+	s.Report(u, api.Record{
+		Time:    time.Now(),
+		Status:  api.StatusFailure,
+		Target:  u,
+		Message: name + ": " + err.Error(),
+		Extra: map[string]interface{}{
+			sinkErrorKey: name,
+		},
+	})
+}
+
+// isColorTerminal reports whether the writer is a terminal that colored output is allowed.
+func isColorTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(f.Fd()) || isCygwinTerminal(f.Fd())
+}
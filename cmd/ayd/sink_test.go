@@ -0,0 +1,76 @@
+package main_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/ayd/cmd/ayd"
+	"github.com/macrat/ayd/internal/store"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+func TestAydCommand_OpenLogSinks_ownErrors(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	s, err := store.New("", "", io.Discard)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+
+	cmd := &main.AydCommand{LogSinks: []string{srv.URL}}
+	closeSinks, err := cmd.OpenLogSinks(s)
+	if err != nil {
+		t.Fatalf("failed to open sinks: %s", err)
+	}
+
+	var internalErrors int
+	s.OnReport = append(s.OnReport, func(r api.Record) {
+		if r.Target.String() == "ayd:sink" {
+			if r.Extra["sink"] != srv.URL {
+				t.Errorf("the error record is not tagged with the sink: %v", r.Extra)
+			}
+			mu.Lock()
+			internalErrors++
+			mu.Unlock()
+		}
+	})
+
+	u := &api.URL{Scheme: "dummy", Opaque: "healthy"}
+	s.Report(u, api.Record{Time: time.Now(), Status: api.StatusHealthy, Target: u})
+	time.Sleep(1500 * time.Millisecond)
+	s.Report(u, api.Record{Time: time.Now(), Status: api.StatusHealthy, Target: u})
+
+	closeSinks()
+	s.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if internalErrors == 0 {
+		t.Fatalf("the error of the sink is not reported")
+	}
+	if len(bodies) == 0 {
+		t.Fatalf("no records sent to the sink")
+	}
+	for _, b := range bodies {
+		if strings.Contains(b, "ayd:sink") {
+			t.Errorf("the error of the sink is sent to the sink itself: %s", b)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/macrat/ayd/internal/ayderr"
@@ -23,7 +24,29 @@ type Task struct {
 }
 
 func (t Task) MakeJob(ctx context.Context, s *store.Store) cron.Job {
+	// next is the time that the job is expected to run, for measuring scheduler lag.
+	// It is zero until the first run if the job will be kicked when start.
+	var next time.Time
+	var nextLock sync.Mutex
+	if t.Schedule != nil && !t.Schedule.NeedKickWhenStart() {
+		next = t.Schedule.Next(time.Now())
+	}
+
 	return cron.FuncJob(func() {
+		now := time.Now()
+		nextLock.Lock()
+		if !next.IsZero() {
+			lag := now.Sub(next)
+			if lag < 0 {
+				lag = 0
+			}
+			s.SetSchedulerLag(t.Prober.Target(), lag)
+		}
+		if t.Schedule != nil {
+			next = t.Schedule.Next(now)
+		}
+		nextLock.Unlock()
+
 		defer func() {
 			if err := recover(); err != nil {
 				s.Report(t.Prober.Target(), api.Record{
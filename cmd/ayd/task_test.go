@@ -134,6 +134,12 @@ func TestParseArgs_errors(t *testing.T) {
 				`::: Not valid as schedule or target URL.`,
 			},
 		},
+		{
+			[]string{"dummy:?message=${env:AYD_TEST_NO_SUCH_SECRET}"},
+			[]string{
+				`dummy:?message=${env:AYD_TEST_NO_SUCH_SECRET}: environment variable AYD_TEST_NO_SUCH_SECRET is not set`,
+			},
+		},
 	}
 
 	for _, tt := range tests {
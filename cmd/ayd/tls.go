@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tlsCheckInterval is the minimum interval to check the modification time of the TLS files, in nanoseconds.
+var tlsCheckInterval atomic.Int64
+
+func init() {
+	tlsCheckInterval.Store(int64(10 * time.Second))
+}
+
+// tlsLoader loads the certificate, the key, and the client CA bundle for the HTTPS server.
+// It checks the modification time of the files on TLS handshakes at most once per tlsCheckInterval, and reloads them if they are updated.
+// So renewed certificates are used without restarting Ayd.
+type tlsLoader struct {
+	CertPath     string
+	KeyPath      string
+	ClientCAPath string
+
+	// OnReload is called when the files are reloaded, excluding the first load.
+	// The err is nil if succeed to reload.
+	OnReload func(cert *x509.Certificate, err error)
+
+	sync.Mutex
+	config   *tls.Config
+	modTimes []time.Time
+	checked  time.Time
+}
+
+func (l *tlsLoader) paths() []string {
+	if l.ClientCAPath == "" {
+		return []string{l.CertPath, l.KeyPath}
+	}
+	return []string{l.CertPath, l.KeyPath, l.ClientCAPath}
+}
+
+func (l *tlsLoader) readModTimes() ([]time.Time, error) {
+	paths := l.paths()
+	ts := make([]time.Time, len(paths))
+	for i, p := range paths {
+		stat, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		ts[i] = stat.ModTime()
+	}
+	return ts, nil
+}
+
+// Load loads the files and makes a new tls.Config.
+// The loaded config will be used until the files are updated.
+func (l *tlsLoader) Load() error {
+	l.Lock()
+	defer l.Unlock()
+
+	modTimes, err := l.readModTimes()
+	if err != nil {
+		return err
+	}
+	l.modTimes = modTimes
+	l.checked = time.Now()
+
+	l.config, err = l.loadConfig()
+	return err
+}
+
+func (l *tlsLoader) loadConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(l.CertPath, l.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if l.ClientCAPath != "" {
+		pem, err := os.ReadFile(l.ClientCAPath)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in %s", l.ClientCAPath)
+		}
+
+		c.ClientCAs = pool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return c, nil
+}
+
+func isSameTimes(xs, ys []time.Time) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if !xs[i].Equal(ys[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// reloadIfNeed reloads the files if their modification time has changed.
+// The current config will be kept if failed to reload, in order to keep serving while the files are being replaced.
+// OnReload is called without holding the lock, because it may take a while.
+func (l *tlsLoader) reloadIfNeed() {
+	modTimes, err := l.readModTimes()
+	if err != nil {
+		return
+	}
+
+	l.Lock()
+	if isSameTimes(modTimes, l.modTimes) {
+		l.Unlock()
+		return
+	}
+	l.modTimes = modTimes
+	l.Unlock()
+
+	config, err := l.loadConfig()
+	if err == nil {
+		l.Lock()
+		l.config = config
+		l.Unlock()
+	}
+
+	if l.OnReload != nil {
+		var cert *x509.Certificate
+		if err == nil {
+			cert, err = x509.ParseCertificate(config.Certificates[0].Certificate[0])
+		}
+		l.OnReload(cert, err)
+	}
+}
+
+func (l *tlsLoader) getConfigForClient(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+	l.Lock()
+	needCheck := time.Since(l.checked) >= time.Duration(tlsCheckInterval.Load())
+	if needCheck {
+		l.checked = time.Now()
+	}
+	l.Unlock()
+
+	if needCheck {
+		l.reloadIfNeed()
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.config == nil {
+		return nil, errors.New("TLS certificate is not loaded")
+	}
+	return l.config, nil
+}
+
+// TLSConfig returns a tls.Config for http.Server.
+func (l *tlsLoader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: l.getConfigForClient,
+	}
+}
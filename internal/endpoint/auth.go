@@ -31,6 +31,14 @@ func WithBasicAuth(handler http.Handler, userinfo string) http.Handler {
 }
 
 func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Browsers never send credentials in CORS preflight requests, so answer them here without calling the handler.
+	// Allowing the preflight does not expose anything, because only the Grafana endpoints allow cross-origin requests.
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		setCORSHeaders(w)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	username, password, ok := r.BasicAuth()
 	if !ok || username != a.Username || password != a.Password {
 		w.Header().Add("WWW-Authenticate", `Basic realm="Ayd? status page"`)
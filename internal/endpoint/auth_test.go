@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/macrat/ayd/internal/endpoint"
+	"github.com/macrat/ayd/internal/testutil"
 )
 
 type TestHandler struct{}
@@ -91,3 +92,49 @@ func TestBasicAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestBasicAuth_grafanaPreflight(t *testing.T) {
+	s := testutil.NewStore(t)
+	defer s.Close()
+
+	srv := httptest.NewServer(endpoint.WithBasicAuth(endpoint.New(s, endpoint.Config{}), "foo:bar"))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodOptions, srv.URL+"/grafana/query", nil)
+	req.Header.Set("Origin", "https://grafana.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to send preflight: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected status for preflight: %s", resp.Status)
+	}
+	if h := resp.Header.Get("Access-Control-Allow-Origin"); h != "*" {
+		t.Errorf("unexpected CORS header: %q", h)
+	}
+	if h := resp.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(h, "Authorization") {
+		t.Errorf("Authorization header is not allowed: %q", h)
+	}
+
+	resp, err = srv.Client().Post(srv.URL+"/grafana/query", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("failed to post: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unexpected status for query without credentials: %s", resp.Status)
+	}
+
+	req, _ = http.NewRequest(http.MethodOptions, srv.URL+"/grafana/query", nil)
+	resp, err = srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to send OPTIONS: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unexpected status for OPTIONS that is not preflight: %s", resp.Status)
+	}
+}
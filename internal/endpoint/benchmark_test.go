@@ -15,14 +15,22 @@ func Benchmark_endpoints(b *testing.B) {
 		Path     string
 		Endpoint func(endpoint.Store) http.HandlerFunc
 	}{
-		{"status.html", endpoint.StatusHTMLEndpoint},
+		{"status.html", func(s endpoint.Store) http.HandlerFunc {
+			return endpoint.StatusHTMLEndpoint(s, "/")
+		}},
 		{"status.txt", endpoint.StatusTextEndpoint},
 		{"status.json", endpoint.StatusJSONEndpoint},
-		{"incidents.html", endpoint.IncidentsHTMLEndpoint},
-		{"incidents.rss", endpoint.IncidentsRSSEndpoint},
+		{"incidents.html", func(s endpoint.Store) http.HandlerFunc {
+			return endpoint.IncidentsHTMLEndpoint(s, "/")
+		}},
+		{"incidents.rss", func(s endpoint.Store) http.HandlerFunc {
+			return endpoint.IncidentsRSSEndpoint(s, "")
+		}},
 		{"incidents.csv", endpoint.IncidentsCSVEndpoint},
 		{"incidents.json", endpoint.IncidentsJSONEndpoint},
-		{"log.html", endpoint.LogHTMLEndpoint},
+		{"log.html", func(s endpoint.Store) http.HandlerFunc {
+			return endpoint.LogHTMLEndpoint(s, "/")
+		}},
 		{"log.csv", endpoint.LogCSVEndpoint},
 		{"log.xlsx", endpoint.LogXlsxEndpoint},
 		{"log.ltsv", endpoint.LogLTSVEndpoint},
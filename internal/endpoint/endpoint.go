@@ -4,6 +4,8 @@ import (
 	"bytes"
 	_ "embed"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/NYTimes/gziphandler"
 )
@@ -36,8 +38,66 @@ var faviconSvg []byte
 //go:embed templates/not-found.html
 var notFoundPageTemplate string
 
+// Config is the configuration for the endpoints.
+type Config struct {
+	// BasePath is the path prefix that Ayd is served on, like "/monitoring/".
+	// It is derived from ExternalURL if empty, or "/" if both of them are empty.
+	BasePath string
+
+	// ExternalURL is the URL that users use to access Ayd, like "https://example.com/monitoring/".
+	// It is used as links in the RSS feed.
+	ExternalURL string
+}
+
+func (c Config) normalize() Config {
+	if c.BasePath == "" && c.ExternalURL != "" {
+		if u, err := url.Parse(c.ExternalURL); err == nil {
+			c.BasePath = u.Path
+		}
+	}
+	if !strings.HasPrefix(c.BasePath, "/") {
+		c.BasePath = "/" + c.BasePath
+	}
+	if !strings.HasSuffix(c.BasePath, "/") {
+		c.BasePath += "/"
+	}
+	if c.ExternalURL != "" && !strings.HasSuffix(c.ExternalURL, "/") {
+		c.ExternalURL += "/"
+	}
+	return c
+}
+
+// BasePathHandler is a http.Handler wrapper that strips the base path from the request path.
+// The requests that do not have the base path are passed as is, so it works even if the reverse proxy already stripped the prefix.
+type BasePathHandler struct {
+	Upstream http.Handler
+	BasePath string
+}
+
+func (h BasePathHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.BasePath == "/" {
+		h.Upstream.ServeHTTP(w, r)
+		return
+	}
+
+	if r.URL.Path == strings.TrimSuffix(h.BasePath, "/") {
+		http.Redirect(w, r, h.BasePath, http.StatusMovedPermanently)
+		return
+	}
+
+	if p, ok := strings.CutPrefix(r.URL.Path, h.BasePath); ok {
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + p
+		r2.URL.RawPath = ""
+		r = r2
+	}
+	h.Upstream.ServeHTTP(w, r)
+}
+
 // New makes new http.Handler
-func New(s Store) http.Handler {
+func New(s Store, c Config) http.Handler {
+	c = c.normalize()
+
 	m := http.NewServeMux()
 
 	faviconLink := `<favicon.ico>;rel="alternate";type="image/vnd.microsoft.icon", <favicon.svg>;rel="alternate";type="image/svg+xml"`
@@ -49,51 +109,57 @@ func New(s Store) http.Handler {
 	}, faviconLink})
 
 	statusLink := `<status.html>;rel="alternate";type="text/html", <status.html>;rel="alternate";type="text/plain", <status.json>;rel="alternate";type="application/json"`
-	m.Handle("/status", http.RedirectHandler("/status.html", http.StatusMovedPermanently))
-	m.Handle("/status.html", LinkHeader{StatusHTMLEndpoint(s), statusLink})
+	m.Handle("/status", http.RedirectHandler(c.BasePath+"status.html", http.StatusMovedPermanently))
+	m.Handle("/status.html", LinkHeader{StatusHTMLEndpoint(s, c.BasePath), statusLink})
 	m.Handle("/status.txt", LinkHeader{StatusTextEndpoint(s), statusLink})
 	m.Handle("/status.json", LinkHeader{StatusJSONEndpoint(s), statusLink})
 
 	incidentsLink := `<incidents.html>;rel="alternate";type="text/html", <incidents.rss>;rel="alternate";type="application/rss+xml", <incidents.csv>;rel="alternate";type="text/csv", <incidents.json>;rel="alternate";type="application/json"`
-	m.Handle("/incidents", http.RedirectHandler("/incidents.html", http.StatusMovedPermanently))
-	m.Handle("/incidents.html", LinkHeader{IncidentsHTMLEndpoint(s), incidentsLink})
-	m.Handle("/incidents.rss", LinkHeader{IncidentsRSSEndpoint(s), incidentsLink})
+	m.Handle("/incidents", http.RedirectHandler(c.BasePath+"incidents.html", http.StatusMovedPermanently))
+	m.Handle("/incidents.html", LinkHeader{IncidentsHTMLEndpoint(s, c.BasePath), incidentsLink})
+	m.Handle("/incidents.rss", LinkHeader{IncidentsRSSEndpoint(s, c.ExternalURL), incidentsLink})
 	m.Handle("/incidents.csv", LinkHeader{IncidentsCSVEndpoint(s), incidentsLink})
 	m.Handle("/incidents.json", LinkHeader{IncidentsJSONEndpoint(s), incidentsLink})
 
 	logLink := `<log.html>;rel="alternate";type="text/html", <log.csv>;rel="alternate";type="text/csv", <log.xlsx>;rel="alternate";type="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", <log.ltsv>;rel="alternate";type="text/plain", <log.json>;rel="alternate";type="application/json"`
-	m.Handle("/log", http.RedirectHandler("/log.html", http.StatusMovedPermanently))
-	m.Handle("/log.html", LinkHeader{LogHTMLEndpoint(s), logLink})
+	m.Handle("/log", http.RedirectHandler(c.BasePath+"log.html", http.StatusMovedPermanently))
+	m.Handle("/log.html", LinkHeader{LogHTMLEndpoint(s, c.BasePath), logLink})
 	m.Handle("/log.csv", LinkHeader{LogCSVEndpoint(s), logLink})
 	m.Handle("/log.xlsx", LinkHeader{LogXlsxEndpoint(s), logLink})
 	m.Handle("/log.ltsv", LinkHeader{LogLTSVEndpoint(s), logLink})
 	m.Handle("/log.json", LinkHeader{LogJsonEndpoint(s), logLink})
 
 	targetsLink := `<targets.txt>;rel="alternate";type="text/plain", <targets.json>;rel="alternate";type="application/json"`
-	m.Handle("/targets", http.RedirectHandler("/targets.txt", http.StatusMovedPermanently))
+	m.Handle("/targets", http.RedirectHandler(c.BasePath+"targets.txt", http.StatusMovedPermanently))
 	m.Handle("/targets.txt", LinkHeader{TargetsTextEndpoint(s), targetsLink})
 	m.Handle("/targets.json", LinkHeader{TargetsJSONEndpoint(s), targetsLink})
 
 	m.Handle("/mcp", MCPHandler(s))
 
+	m.HandleFunc("/grafana", GrafanaRootEndpoint(s))
+	m.HandleFunc("/grafana/{$}", GrafanaRootEndpoint(s))
+	m.HandleFunc("/grafana/search", GrafanaSearchEndpoint(s))
+	m.HandleFunc("/grafana/query", GrafanaQueryEndpoint(s))
+	m.HandleFunc("/grafana/annotations", GrafanaAnnotationsEndpoint(s))
+
 	m.HandleFunc("/metrics", MetricsEndpoint(s))
 	m.HandleFunc("/healthz", HealthzEndpoint(s))
 
 	buf := bytes.NewBuffer(nil)
-	if err := loadHTMLTemplate(notFoundPageTemplate).Execute(buf, nil); err != nil {
+	if err := loadHTMLTemplate(notFoundPageTemplate, c.BasePath).Execute(buf, nil); err != nil {
 		panic(err)
 	}
 	notFoundPage := buf.Bytes()
 	m.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" {
-			http.Redirect(w, r, "/status.html", http.StatusFound)
+			http.Redirect(w, r, c.BasePath+"status.html", http.StatusFound)
 		} else {
 			w.WriteHeader(http.StatusNotFound)
 			w.Write(notFoundPage)
 		}
 	})
 
-	return gziphandler.GzipHandler(CommonHeader{m})
+	return gziphandler.GzipHandler(CommonHeader{BasePathHandler{m, c.BasePath}})
 }
 
 func handleError(s Store, scope string, err error) {
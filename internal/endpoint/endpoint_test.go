@@ -3,6 +3,7 @@ package endpoint_test
 import (
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -10,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/macrat/ayd/internal/endpoint"
 	"github.com/macrat/ayd/internal/testutil"
 )
 
@@ -41,6 +43,65 @@ func TestNotFound(t *testing.T) {
 	}
 }
 
+func TestBasePath(t *testing.T) {
+	s := testutil.NewStore(t, testutil.WithLog())
+	defer s.Close()
+
+	srv := httptest.NewServer(endpoint.New(s, endpoint.Config{
+		ExternalURL: "https://example.com/monitoring",
+	}))
+	defer srv.Close()
+
+	client := srv.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	tests := []struct {
+		Path     string
+		Status   int
+		Location string
+		Contains string
+	}{
+		{"/monitoring", http.StatusMovedPermanently, "/monitoring/", ""},
+		{"/monitoring/", http.StatusFound, "/monitoring/status.html", ""},
+		{"/monitoring/status", http.StatusMovedPermanently, "/monitoring/status.html", ""},
+		{"/monitoring/log", http.StatusMovedPermanently, "/monitoring/log.html", ""},
+		{"/monitoring/status.html", http.StatusOK, "", `href="/monitoring/incidents.html"`},
+		{"/monitoring/log.html", http.StatusOK, "", `href="/monitoring/log.csv"`},
+		{"/monitoring/incidents.rss", http.StatusOK, "", "<link>https://example.com/monitoring/incidents.html</link>"},
+		{"/monitoring/not-found", http.StatusNotFound, "", `href="/monitoring/metrics"`},
+		{"/status.html", http.StatusOK, "", `href="/monitoring/status.html"`}, // the prefix was stripped by the reverse proxy
+		{"/", http.StatusFound, "/monitoring/status.html", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Path, func(t *testing.T) {
+			resp, err := client.Get(srv.URL + tt.Path)
+			if err != nil {
+				t.Fatalf("failed to get %s: %s", tt.Path, err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.Status {
+				t.Errorf("unexpected status: %s", resp.Status)
+			}
+
+			if loc := resp.Header.Get("Location"); loc != tt.Location {
+				t.Errorf("unexpected location: expected %q but got %q", tt.Location, loc)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %s", err)
+			}
+			if !strings.Contains(string(body), tt.Contains) {
+				t.Errorf("expected body contains %q but not\n%s", tt.Contains, body)
+			}
+		})
+	}
+}
+
 func readTestFile(t *testing.T, file string) string {
 	t.Helper()
 
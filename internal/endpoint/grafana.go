@@ -0,0 +1,327 @@
+package endpoint
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/macrat/ayd/internal/query"
+	"github.com/macrat/ayd/internal/stats"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// The endpoints in this file implement the protocol of the Grafana JSON datasource (and the Infinity datasource in the JSON mode).
+// See https://github.com/simPod/GrafanaJsonDatasource for the protocol.
+
+const (
+	grafanaMetricLatency = "latency"
+	grafanaMetricStatus  = "status"
+)
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// normalize fills the range by the default period if it is not specified.
+func (r grafanaRange) normalize() grafanaRange {
+	if r.To.IsZero() {
+		r.To = time.Now()
+	}
+	if r.From.IsZero() {
+		r.From = r.To.Add(-7 * 24 * time.Hour)
+	}
+	return r
+}
+
+type grafanaSearchRequest struct {
+	Target string `json:"target"`
+}
+
+type grafanaQueryRequest struct {
+	Range   grafanaRange `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Hide   bool   `json:"hide"`
+	} `json:"targets"`
+}
+
+type grafanaTimeSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaAnnotationRequest struct {
+	Range      grafanaRange   `json:"range"`
+	Annotation map[string]any `json:"annotation"`
+}
+
+type grafanaAnnotation struct {
+	Annotation map[string]any `json:"annotation,omitempty"`
+	Time       int64          `json:"time"`
+	TimeEnd    int64          `json:"timeEnd"`
+	Title      string         `json:"title"`
+	Text       string         `json:"text"`
+	Tags       []string       `json:"tags"`
+}
+
+// parseGrafanaTarget parses a target expression of Grafana panel like "latency target=ping:*".
+// The first word is the metric name, and the rest is a query for filtering records.
+// The metric is latency if the first word is not a known metric name.
+func parseGrafanaTarget(s string) (metric string, q query.Query) {
+	s = strings.TrimSpace(s)
+	metric, rest, _ := strings.Cut(s, " ")
+	switch metric {
+	case grafanaMetricLatency, grafanaMetricStatus:
+		return metric, query.ParseQuery(rest)
+	default:
+		return grafanaMetricLatency, query.ParseQuery(s)
+	}
+}
+
+// grafanaStatusValue converts a status to a number for Grafana.
+// HEALTHY is 1, DEGRADE is 0.5, and FAILURE is 0, so the average of the values means availability.
+// UNKNOWN and ABORTED don't have a value.
+func grafanaStatusValue(s api.Status) (float64, bool) {
+	switch s {
+	case api.StatusHealthy:
+		return 1, true
+	case api.StatusDegrade:
+		return 0.5, true
+	case api.StatusFailure:
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func toUnixMilli(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
+
+// setCORSHeaders sets the headers to allow cross-origin requests from Grafana in browsers.
+func setCORSHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type")
+}
+
+// grafanaHandler handles the CORS headers and decodes the request body for the Grafana endpoints.
+func grafanaHandler[T any](s Store, scope string, handler func(w http.ResponseWriter, r *http.Request, req T) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w)
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST, OPTIONS")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			enc.Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		var req T
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(map[string]string{"error": "invalid request body: " + err.Error()})
+			return
+		}
+
+		resp, err := handler(w, r, req)
+		if err != nil {
+			handleError(s, scope, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(map[string]string{"error": "internal server error"})
+			return
+		}
+
+		handleError(s, scope, enc.EncodeContext(r.Context(), resp))
+	}
+}
+
+// GrafanaRootEndpoint replies OK for the connection test of the Grafana datasources.
+func GrafanaRootEndpoint(s Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("OK\n"))
+	}
+}
+
+// GrafanaSearchEndpoint replies the list of available metrics for Grafana.
+// The target in the request is a query to filter targets.
+func GrafanaSearchEndpoint(s Store) http.HandlerFunc {
+	return grafanaHandler(s, "grafana/search", func(w http.ResponseWriter, r *http.Request, req grafanaSearchRequest) (any, error) {
+		q := query.ParseQuery(req.Target)
+
+		metrics := []string{}
+		for _, t := range s.Targets() {
+			u, err := api.ParseURL(t)
+			if err != nil {
+				continue
+			}
+			if !q.Match(api.Record{Target: u}) {
+				continue
+			}
+			metrics = append(
+				metrics,
+				grafanaMetricLatency+" target="+t,
+				grafanaMetricStatus+" target="+t,
+			)
+		}
+
+		return metrics, nil
+	})
+}
+
+// GrafanaQueryEndpoint replies time series of latency or status for Grafana.
+func GrafanaQueryEndpoint(s Store) http.HandlerFunc {
+	return grafanaHandler(s, "grafana/query", func(w http.ResponseWriter, r *http.Request, req grafanaQueryRequest) (any, error) {
+		rng := req.Range.normalize()
+
+		result := []grafanaTimeSeries{}
+
+		for _, t := range req.Targets {
+			if t.Hide {
+				continue
+			}
+
+			metric, q := parseGrafanaTarget(t.Target)
+
+			series := make(map[string]*grafanaTimeSeries)
+			var names []string
+
+			addPoint := func(target *api.URL, value float64, at time.Time) {
+				name := target.String()
+				ts, ok := series[name]
+				if !ok {
+					ts = &grafanaTimeSeries{
+						Target:     name,
+						RefID:      t.RefID,
+						Datapoints: [][2]float64{},
+					}
+					series[name] = ts
+					names = append(names, name)
+				}
+				ts.Datapoints = append(ts.Datapoints, [2]float64{value, toUnixMilli(at)})
+			}
+
+			// Use rollups for long range, and raw records only for the period that is not summarized yet.
+			// Rollups are filtered only by targets, because they don't have the other fields.
+			rawFrom := rng.From
+			if interval, ok := stats.RollupIntervalFor(rng.To.Sub(rng.From)); ok {
+				rollups, end, err := s.Rollups(interval, rng.From, rng.To, q.MatchTarget)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read rollups: %w", err)
+				}
+				for _, r := range rollups {
+					if metric == grafanaMetricStatus {
+						if v, ok := r.Availability(); ok {
+							addPoint(r.Target, v, r.Time)
+						}
+					} else {
+						addPoint(r.Target, float64(r.LatencyAvg.Microseconds())/1000, r.Time)
+					}
+				}
+				if end.After(rawFrom) {
+					rawFrom = end
+				}
+			}
+
+			if rawFrom.Before(rng.To) {
+				scanner, err := s.OpenLogByTarget(rawFrom, rng.To, q.MatchTarget)
+				if err != nil {
+					return nil, fmt.Errorf("failed to open log: %w", err)
+				}
+
+				for scanner.Scan() {
+					rec := scanner.Record()
+					if !q.Match(rec) {
+						continue
+					}
+
+					if metric == grafanaMetricStatus {
+						if v, ok := grafanaStatusValue(rec.Status); ok {
+							addPoint(rec.Target, v, rec.Time)
+						}
+					} else {
+						addPoint(rec.Target, float64(rec.Latency.Microseconds())/1000, rec.Time)
+					}
+				}
+				scanner.Close()
+			}
+
+			sort.Strings(names)
+			for _, name := range names {
+				result = append(result, *series[name])
+			}
+		}
+
+		return result, nil
+	})
+}
+
+// GrafanaAnnotationsEndpoint replies incidents as annotations for Grafana.
+// The query in the annotation settings is used for filtering incidents.
+func GrafanaAnnotationsEndpoint(s Store) http.HandlerFunc {
+	return grafanaHandler(s, "grafana/annotations", func(w http.ResponseWriter, r *http.Request, req grafanaAnnotationRequest) (any, error) {
+		rng := req.Range.normalize()
+
+		var q query.Query
+		if str, ok := req.Annotation["query"].(string); ok {
+			q = query.ParseQuery(str)
+		} else {
+			q = query.ParseQuery("")
+		}
+
+		incidents, err := s.IncidentsBetween(rng.From, rng.To, q.MatchTarget)
+		if err != nil {
+			return nil, err
+		}
+
+		result := []grafanaAnnotation{}
+
+		for _, inc := range incidents {
+			rec := api.Record{
+				Time:    inc.StartsAt,
+				Status:  inc.Status,
+				Target:  inc.Target,
+				Message: inc.Message,
+			}
+			if !q.Match(rec) {
+				continue
+			}
+
+			end := inc.EndsAt
+			if end.IsZero() {
+				end = rng.To
+			}
+
+			result = append(result, grafanaAnnotation{
+				Annotation: req.Annotation,
+				Time:       inc.StartsAt.UnixMilli(),
+				TimeEnd:    end.UnixMilli(),
+				Title:      fmt.Sprintf("%s: %s", inc.Status, inc.Target),
+				Text:       inc.Message,
+				Tags:       []string{inc.Status.String(), inc.Target.String()},
+			})
+		}
+
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Time < result[j].Time
+		})
+
+		return result, nil
+	})
+}
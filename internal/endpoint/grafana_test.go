@@ -0,0 +1,243 @@
+package endpoint_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/macrat/ayd/internal/endpoint"
+	"github.com/macrat/ayd/internal/store"
+	"github.com/macrat/ayd/internal/testutil"
+)
+
+func postGrafana(t *testing.T, url, body string) (int, string) {
+	t.Helper()
+
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to post: %s", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %s", err)
+	}
+
+	return resp.StatusCode, string(raw)
+}
+
+func TestGrafanaRootEndpoint(t *testing.T) {
+	srv := testutil.StartTestServer(t)
+	defer srv.Close()
+
+	for _, path := range []string{"/grafana", "/grafana/"} {
+		resp, err := srv.Client().Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("%s: failed to get: %s", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: unexpected status: %s", path, resp.Status)
+		}
+	}
+}
+
+func TestGrafanaSearchEndpoint(t *testing.T) {
+	srv := testutil.StartTestServer(t)
+	defer srv.Close()
+
+	tests := []struct {
+		Body   string
+		Expect string
+	}{
+		{
+			`{"target": "target=http://b.*"}`,
+			`["latency target=http://b.example.com","status target=http://b.example.com"]` + "\n",
+		},
+		{
+			`{"target": "target=dummy:*"}`,
+			`["latency target=dummy:#no-record-yet","status target=dummy:#no-record-yet"]` + "\n",
+		},
+		{
+			`{"target": "target=no-such-target"}`,
+			"[]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		code, body := postGrafana(t, srv.URL+"/grafana/search", tt.Body)
+		if code != http.StatusOK {
+			t.Errorf("%s: unexpected status: %d", tt.Body, code)
+		}
+		if body != tt.Expect {
+			t.Errorf("%s: unexpected response\n--- expected ---\n%s\n--- actual ---\n%s", tt.Body, tt.Expect, body)
+		}
+	}
+}
+
+func TestGrafanaQueryEndpoint(t *testing.T) {
+	srv := testutil.StartTestServer(t)
+	defer srv.Close()
+
+	tests := []struct {
+		Name   string
+		Body   string
+		Expect string
+	}{
+		{
+			"latency",
+			`{"range": {"from": "2021-01-02T15:04:05Z", "to": "2021-01-02T15:04:10Z"}, "targets": [{"target": "latency target=http://a.example.com", "refId": "A"}]}`,
+			`[{"target":"http://a.example.com","refId":"A","datapoints":[[123.456,1609599845000],[234.567,1609599846000],[345.678,1609599847000]]}]` + "\n",
+		},
+		{
+			"status",
+			`{"range": {"from": "2021-01-02T15:04:05Z", "to": "2021-01-02T15:04:10Z"}, "targets": [{"target": "status target=http://b.example.com", "refId": "B"}]}`,
+			`[{"target":"http://b.example.com","refId":"B","datapoints":[[0,1609599845000],[1,1609599846000]]}]` + "\n",
+		},
+		{
+			"status-without-value",
+			`{"range": {"from": "2021-01-02T15:04:05Z", "to": "2021-01-02T15:04:10Z"}, "targets": [{"target": "status target=http://c.example.com", "refId": "C"}]}`,
+			"[]\n",
+		},
+		{
+			"multiple-targets",
+			`{"range": {"from": "2021-01-02T15:04:05Z", "to": "2021-01-02T15:04:07Z"}, "targets": [{"target": "target=http://*.example.com", "refId": "A"}, {"target": "status", "refId": "B", "hide": true}]}`,
+			`[{"target":"http://a.example.com","refId":"A","datapoints":[[123.456,1609599845000],[234.567,1609599846000]]},{"target":"http://b.example.com","refId":"A","datapoints":[[12.345,1609599845000],[54.321,1609599846000]]}]` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			code, body := postGrafana(t, srv.URL+"/grafana/query", tt.Body)
+			if code != http.StatusOK {
+				t.Errorf("unexpected status: %d", code)
+			}
+			if body != tt.Expect {
+				t.Errorf("unexpected response\n--- expected ---\n%s\n--- actual ---\n%s", tt.Expect, body)
+			}
+		})
+	}
+}
+
+func TestGrafanaAnnotationsEndpoint(t *testing.T) {
+	srv := testutil.StartTestServer(t)
+	defer srv.Close()
+
+	code, body := postGrafana(t, srv.URL+"/grafana/annotations", `{"range": {"from": "2021-01-02T00:00:00Z", "to": "2021-01-03T00:00:00Z"}, "annotation": {"name": "incidents", "query": "target=http://b.example.com"}}`)
+	if code != http.StatusOK {
+		t.Errorf("unexpected status: %d", code)
+	}
+
+	expect := `[{"annotation":{"name":"incidents","query":"target=http://b.example.com"},"time":1609599845000,"timeEnd":1609599846000,"title":"FAILURE: http://b.example.com","text":"this is failure","tags":["FAILURE","http://b.example.com"]}]` + "\n"
+	if body != expect {
+		t.Errorf("unexpected response\n--- expected ---\n%s\n--- actual ---\n%s", expect, body)
+	}
+}
+
+func TestGrafanaAnnotationsEndpoint_notRestored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ayd.log")
+	if err := os.WriteFile(path, []byte(testutil.DummyLog), 0644); err != nil {
+		t.Fatalf("failed to prepare log: %s", err)
+	}
+
+	s, err := store.New("", path, io.Discard)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	defer s.Close()
+
+	srv := httptest.NewServer(endpoint.New(s, endpoint.Config{}))
+	defer srv.Close()
+
+	code, body := postGrafana(t, srv.URL+"/grafana/annotations", `{"range": {"from": "2021-01-02T00:00:00Z", "to": "2021-01-03T00:00:00Z"}, "annotation": {"name": "incidents", "query": "target=http://b.example.com"}}`)
+	if code != http.StatusOK {
+		t.Errorf("unexpected status: %d", code)
+	}
+
+	expect := `[{"annotation":{"name":"incidents","query":"target=http://b.example.com"},"time":1609599845000,"timeEnd":1609599846000,"title":"FAILURE: http://b.example.com","text":"this is failure","tags":["FAILURE","http://b.example.com"]}]` + "\n"
+	if body != expect {
+		t.Errorf("unexpected response\n--- expected ---\n%s\n--- actual ---\n%s", expect, body)
+	}
+}
+
+func TestGrafanaEndpoint_errors(t *testing.T) {
+	srv := testutil.StartTestServer(t)
+	defer srv.Close()
+
+	if code, body := postGrafana(t, srv.URL+"/grafana/query", `{invalid`); code != http.StatusBadRequest {
+		t.Errorf("unexpected status for invalid body: %d: %s", code, body)
+	}
+
+	resp, err := srv.Client().Get(srv.URL + "/grafana/query")
+	if err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status for GET: %s", resp.Status)
+	}
+
+	req, _ := http.NewRequest(http.MethodOptions, srv.URL+"/grafana/query", nil)
+	resp, err = srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to send OPTIONS: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected status for OPTIONS: %s", resp.Status)
+	}
+	if h := resp.Header.Get("Access-Control-Allow-Origin"); h != "*" {
+		t.Errorf("unexpected CORS header: %q", h)
+	}
+}
+
+func TestGrafanaQueryEndpoint_rollup(t *testing.T) {
+	s := testutil.NewStore(t, testutil.WithLog())
+	defer s.Close()
+	s.Rollup = true
+	if err := s.UpdateRollups(); err != nil {
+		t.Fatalf("failed to update rollups: %s", err)
+	}
+
+	srv := httptest.NewServer(endpoint.New(s, endpoint.Config{}))
+	defer srv.Close()
+
+	tests := []struct {
+		Name   string
+		Body   string
+		Expect string
+	}{
+		{
+			"latency",
+			`{"range": {"from": "2021-01-01T00:00:00Z", "to": "2021-01-05T00:00:00Z"}, "targets": [{"target": "latency target=http://a.example.com", "refId": "A"}]}`,
+			`[{"target":"http://a.example.com","refId":"A","datapoints":[[234.567,1609599600000]]}]` + "\n",
+		},
+		{
+			"status",
+			`{"range": {"from": "2021-01-01T00:00:00Z", "to": "2021-01-05T00:00:00Z"}, "targets": [{"target": "status target=http://*.example.com", "refId": "B"}]}`,
+			`[{"target":"http://a.example.com","refId":"B","datapoints":[[1,1609599600000]]},{"target":"http://b.example.com","refId":"B","datapoints":[[0.5,1609599600000]]}]` + "\n",
+		},
+		{
+			"daily",
+			`{"range": {"from": "2020-10-01T00:00:00Z", "to": "2021-02-01T00:00:00Z"}, "targets": [{"target": "status target=http://b.example.com", "refId": "C"}]}`,
+			`[{"target":"http://b.example.com","refId":"C","datapoints":[[0.5,1609545600000]]}]` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			code, body := postGrafana(t, srv.URL+"/grafana/query", tt.Body)
+			if code != http.StatusOK {
+				t.Errorf("unexpected status: %d", code)
+			}
+			if body != tt.Expect {
+				t.Errorf("unexpected response\n--- expected ---\n%s\n--- actual ---\n%s", tt.Expect, body)
+			}
+		})
+	}
+}
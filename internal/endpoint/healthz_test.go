@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/macrat/ayd/internal/endpoint"
+	"github.com/macrat/ayd/internal/stats"
 	"github.com/macrat/ayd/internal/testutil"
 	api "github.com/macrat/ayd/lib-ayd"
 )
@@ -79,6 +80,10 @@ func (d DummyErrorsGetter) IncidentCount() int {
 	return 0
 }
 
+func (d DummyErrorsGetter) Metrics() stats.Metrics {
+	return stats.Metrics{}
+}
+
 func (d DummyErrorsGetter) String() string {
 	return fmt.Sprintf("healthy:%v/messages:%v", d.healthy, d.messages)
 }
@@ -87,6 +92,18 @@ func (d DummyErrorsGetter) OpenLog(since, until time.Time) (api.LogScanner, erro
 	return nil, fmt.Errorf("not implemented")
 }
 
+func (d DummyErrorsGetter) OpenLogByTarget(since, until time.Time, match func(*api.URL) bool) (api.LogScanner, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (d DummyErrorsGetter) Rollups(interval stats.RollupInterval, since, until time.Time, match func(*api.URL) bool) ([]stats.Rollup, time.Time, error) {
+	return nil, time.Time{}, fmt.Errorf("not implemented")
+}
+
+func (d DummyErrorsGetter) IncidentsBetween(since, until time.Time, match func(*api.URL) bool) ([]*api.Incident, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
 func TestHealthzEndpoint_errors(t *testing.T) {
 	tests := []struct {
 		Store DummyErrorsGetter
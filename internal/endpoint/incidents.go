@@ -3,9 +3,10 @@ package endpoint
 import (
 	_ "embed"
 	"encoding/csv"
+	"fmt"
 	"net/http"
-	"os"
 	"sort"
+	"strconv"
 	"text/template"
 	"time"
 
@@ -16,41 +17,85 @@ import (
 //go:embed templates/incidents.html
 var incidentsHTMLTemplate string
 
-func IncidentsHTMLEndpoint(s Store) http.HandlerFunc {
-	tmpl := loadHTMLTemplate(incidentsHTMLTemplate)
+func IncidentsHTMLEndpoint(s Store, basePath string) http.HandlerFunc {
+	tmpl := loadHTMLTemplate(incidentsHTMLTemplate, basePath)
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		data := incidentsData{Report: s.MakeReport(0)}
+
+		if isIncidentsPaged(r) {
+			info, code, err := newIncidentsInfo(s, "incidents.html", "", r)
+			if err != nil {
+				w.WriteHeader(code)
+				w.Write([]byte(err.Error() + "\n"))
+				return
+			}
+
+			data.CurrentIncidents = nil
+			data.IncidentHistory = nil
+			for _, x := range info.Incidents {
+				if x.EndsAt.IsZero() {
+					data.CurrentIncidents = append(data.CurrentIncidents, x)
+				} else {
+					data.IncidentHistory = append(data.IncidentHistory, x)
+				}
+			}
+			data.Prev = info.prevQuery
+			data.Next = info.nextQuery
+		}
+
 		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
 
-		handleError(s, "incidents.html", tmpl.Execute(newFlushWriter(w), s.MakeReport(0)))
+		handleError(s, "incidents.html", tmpl.Execute(newFlushWriter(w), data))
 	}
 }
 
+type incidentsData struct {
+	api.Report
+
+	// Prev and Next are the query strings to the previous/next page.
+	Prev string
+	Next string
+}
+
 //go:embed templates/incidents.rss
 var incidentsRSSTemplate string
 
-func IncidentsRSSEndpoint(s Store) http.HandlerFunc {
+func IncidentsRSSEndpoint(s Store, externalURL string) http.HandlerFunc {
 	tmpl := template.Must(template.New("incidents.rss").Funcs(templateFuncs).Parse(incidentsRSSTemplate))
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		info, code, err := newIncidentsInfo(s, "incidents.rss", externalURL, r)
+		if err != nil {
+			w.WriteHeader(code)
+			w.Write([]byte(err.Error() + "\n"))
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/rss+xml")
 
-		handleError(s, "incidents.rss", tmpl.Execute(newFlushWriter(w), newIncidentsInfo(s)))
+		handleError(s, "incidents.rss", tmpl.Execute(newFlushWriter(w), info))
 	}
 }
 
 func IncidentsCSVEndpoint(s Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/csv")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET")
 
+		info, code, err := newIncidentsInfo(s, "incidents.csv", "", r)
+		if err != nil {
+			w.WriteHeader(code)
+			w.Write([]byte(err.Error() + "\n"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+
 		c := csv.NewWriter(newFlushWriter(w))
 		c.Write([]string{"starts_at", "ends_at", "status", "target", "message"})
 
-		rs := newIncidentsInfo(s).Incidents
-
-		for _, r := range rs {
+		for _, r := range info.Incidents {
 			resolved := ""
 			if !r.EndsAt.IsZero() {
 				resolved = r.EndsAt.Format(time.RFC3339)
@@ -77,7 +122,27 @@ func IncidentsJSONEndpoint(s Store) http.HandlerFunc {
 
 		enc := json.NewEncoder(newFlushWriter(w))
 
-		handleError(s, "incidents.json", enc.EncodeContext(r.Context(), newIncidentsInfo(s)))
+		info, code, err := newIncidentsInfo(s, "incidents.json", "", r)
+		if err != nil {
+			msg := struct {
+				E string `json:"error"`
+			}{
+				err.Error(),
+			}
+
+			w.WriteHeader(code)
+			enc.Encode(msg)
+			return
+		}
+
+		if info.prevQuery != "" {
+			info.Prev = r.URL.Path + "?" + info.prevQuery
+		}
+		if info.nextQuery != "" {
+			info.Next = r.URL.Path + "?" + info.nextQuery
+		}
+
+		handleError(s, "incidents.json", enc.EncodeContext(r.Context(), info))
 	}
 }
 
@@ -85,22 +150,88 @@ type incidentsInfo struct {
 	ExternalURL string         `json:"-"`
 	Incidents   []api.Incident `json:"incidents"`
 	ReportedAt  time.Time      `json:"reported_at"`
+
+	// Total, Prev and Next are only set when the request has paging or filtering queries.
+	Total *uint64 `json:"total,omitempty"`
+	Prev  string  `json:"prev,omitempty"`
+	Next  string  `json:"next,omitempty"`
+
+	prevQuery string
+	nextQuery string
+}
+
+// isIncidentsPaged reports whether the request has queries for filtering or paging incidents.
+func isIncidentsPaged(r *http.Request) bool {
+	qs := r.URL.Query()
+	return qs.Has("q") || qs.Has("limit") || qs.Has("offset")
 }
 
-func newIncidentsInfo(s Store) incidentsInfo {
+// newIncidentsInfo makes incidentsInfo for the request.
+//
+// If the request has no query, it reports the incidents in memory.
+// Otherwise, it derives incidents from the log so that it can page through all incidents in the period.
+func newIncidentsInfo(s Store, scope, externalURL string, r *http.Request) (incidentsInfo, int, error) {
 	report := s.MakeReport(0)
 
-	rs := append(report.IncidentHistory, report.CurrentIncidents...)
-	sort.Slice(rs, func(i, j int) bool {
-		if rs[i].StartsAt.Equal(rs[j].StartsAt) {
-			return rs[i].Target.String() < rs[j].Target.String()
+	info := incidentsInfo{
+		ExternalURL: externalURL,
+		ReportedAt:  report.ReportedAt,
+	}
+
+	if !isIncidentsPaged(r) {
+		rs := append(report.IncidentHistory, report.CurrentIncidents...)
+		sort.Slice(rs, func(i, j int) bool {
+			if rs[i].StartsAt.Equal(rs[j].StartsAt) {
+				return rs[i].Target.String() < rs[j].Target.String()
+			}
+			return rs[i].StartsAt.Before(rs[j].StartsAt)
+		})
+		info.Incidents = rs
+		return info, http.StatusOK, nil
+	}
+
+	opts, err := newLogOptionsByRequest(s, scope, r, 30*24*time.Hour)
+	if err != nil {
+		return info, http.StatusBadRequest, err
+	}
+
+	var match func(*api.URL) bool
+	if opts.Query != nil {
+		match = opts.Query.MatchTarget
+	}
+
+	incidents, err := s.IncidentsBetween(opts.Start, opts.End, match)
+	if err != nil {
+		handleError(s, scope, err)
+		return info, http.StatusInternalServerError, fmt.Errorf("internal server error")
+	}
+
+	var total uint64
+	info.Incidents = []api.Incident{}
+	for _, x := range incidents {
+		if opts.Query != nil && !opts.Query.Match(api.Record{Time: x.StartsAt, Status: x.Status, Target: x.Target, Message: x.Message}) {
+			continue
+		}
+		total++
+		if total > opts.Offset && (opts.Limit == 0 || uint64(len(info.Incidents)) < opts.Limit) {
+			info.Incidents = append(info.Incidents, *x)
 		}
-		return rs[i].StartsAt.Before(rs[j].StartsAt)
-	})
+	}
+	info.Total = &total
 
-	return incidentsInfo{
-		ExternalURL: os.Getenv("AYD_URL"),
-		Incidents:   rs,
-		ReportedAt:  report.ReportedAt,
+	q := r.URL.Query()
+	if next := opts.Offset + uint64(len(info.Incidents)); next < total {
+		q.Set("offset", strconv.FormatUint(next, 10))
+		info.nextQuery = q.Encode()
 	}
+	if opts.Offset > 0 {
+		var prev uint64
+		if opts.Limit > 0 && opts.Offset > opts.Limit {
+			prev = opts.Offset - opts.Limit
+		}
+		q.Set("offset", strconv.FormatUint(prev, 10))
+		info.prevQuery = q.Encode()
+	}
+
+	return info, http.StatusOK, nil
 }
@@ -1,7 +1,12 @@
 package endpoint_test
 
 import (
+	"net/http"
 	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/macrat/ayd/internal/testutil"
+	api "github.com/macrat/ayd/lib-ayd"
 )
 
 func TestIncidentsHTMLEndpoint(t *testing.T) {
@@ -19,3 +24,161 @@ func TestIncidentsCSVEndpoint(t *testing.T) {
 func TestIncidentsJsonEndpoint(t *testing.T) {
 	AssertEndpoint(t, "/incidents.json", "./testdata/incidents.json", `"reported_at":".+?"`)
 }
+
+func TestIncidentsJsonEndpoint_query(t *testing.T) {
+	tests := []struct {
+		Name       string
+		Query      string
+		StatusCode int
+		Messages   []string
+		Total      uint64
+		Prev       bool
+		Next       bool
+	}{
+		{
+			"fetch-all",
+			"?q=time%3E%3D2021-01-01+time%3C2022-01-01",
+			http.StatusOK,
+			[]string{"this is failure", "this is unknown"},
+			2,
+			false,
+			false,
+		},
+		{
+			"out-of-range",
+			"?q=time%3E%3D2022-01-01+time%3C2023-01-01",
+			http.StatusOK,
+			[]string{},
+			0,
+			false,
+			false,
+		},
+		{
+			"filter-by-target",
+			"?q=time%3E%3D2021-01-01+time%3C2022-01-01+target%3Dhttp://c.example.com",
+			http.StatusOK,
+			[]string{"this is unknown"},
+			1,
+			false,
+			false,
+		},
+		{
+			"filter-by-status",
+			"?q=time%3E%3D2021-01-01+time%3C2022-01-01+status%3DFAILURE",
+			http.StatusOK,
+			[]string{"this is failure"},
+			1,
+			false,
+			false,
+		},
+		{
+			"first-page",
+			"?q=time%3E%3D2021-01-01+time%3C2022-01-01&limit=1",
+			http.StatusOK,
+			[]string{"this is failure"},
+			2,
+			false,
+			true,
+		},
+		{
+			"second-page",
+			"?q=time%3E%3D2021-01-01+time%3C2022-01-01&limit=1&offset=1",
+			http.StatusOK,
+			[]string{"this is unknown"},
+			2,
+			true,
+			false,
+		},
+		{
+			"invalid-limit",
+			"?limit=abc",
+			http.StatusBadRequest,
+			nil,
+			0,
+			false,
+			false,
+		},
+	}
+
+	srv := testutil.StartTestServer(t)
+	t.Cleanup(func() {
+		srv.Close()
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			resp, err := srv.Client().Get(srv.URL + "/incidents.json" + tt.Query)
+			if err != nil {
+				t.Fatalf("failed to get /incidents.json: %s", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.StatusCode {
+				t.Fatalf("unexpected status: %s", resp.Status)
+			}
+			if tt.StatusCode != http.StatusOK {
+				return
+			}
+
+			var result struct {
+				Incidents []api.Incident `json:"incidents"`
+				Total     uint64         `json:"total"`
+				Prev      string         `json:"prev"`
+				Next      string         `json:"next"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatalf("failed to read result: %s", err)
+			}
+
+			messages := []string{}
+			for _, x := range result.Incidents {
+				messages = append(messages, x.Message)
+			}
+			if len(messages) != len(tt.Messages) {
+				t.Fatalf("unexpected incidents: %v", messages)
+			}
+			for i := range messages {
+				if messages[i] != tt.Messages[i] {
+					t.Errorf("%d: unexpected incident: %s", i, messages[i])
+				}
+			}
+
+			if result.Total != tt.Total {
+				t.Errorf("unexpected total: %d", result.Total)
+			}
+			if (result.Prev != "") != tt.Prev {
+				t.Errorf("unexpected prev link: %q", result.Prev)
+			}
+			if (result.Next != "") != tt.Next {
+				t.Errorf("unexpected next link: %q", result.Next)
+			}
+		})
+	}
+}
+
+func TestIncidentsJsonEndpoint_pastWindow(t *testing.T) {
+	srv := testutil.StartTestServer(t)
+	t.Cleanup(func() {
+		srv.Close()
+	})
+
+	resp, err := srv.Client().Get(srv.URL + "/incidents.json?q=time%3E%3D2021-01-02T15:04:05Z+time%3C2021-01-02T15:04:06Z")
+	if err != nil {
+		t.Fatalf("failed to get /incidents.json: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Incidents []api.Incident `json:"incidents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to read result: %s", err)
+	}
+
+	if len(result.Incidents) != 1 {
+		t.Fatalf("unexpected incidents: %v", result.Incidents)
+	}
+	if x := result.Incidents[0]; x.Message != "this is failure" || x.EndsAt.IsZero() {
+		t.Errorf("incident resolved after the period should not be current: %v", x)
+	}
+}
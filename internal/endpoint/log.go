@@ -174,7 +174,12 @@ func newLogScanner(s Store, scope string, r *http.Request, defaultPeriod time.Du
 }
 
 func newLogScannerByOpts(s Store, scope string, r *http.Request, opts logOptions) (scanner *PagingScanner, statusCode int, err error) {
-	rawScanner, err := s.OpenLog(opts.Start, opts.End)
+	var rawScanner api.LogScanner
+	if opts.Query != nil {
+		rawScanner, err = s.OpenLogByTarget(opts.Start, opts.End, opts.Query.MatchTarget)
+	} else {
+		rawScanner, err = s.OpenLog(opts.Start, opts.End)
+	}
 	if err != nil {
 		handleError(s, scope, fmt.Errorf("failed to open log: %w", err))
 		return nil, http.StatusInternalServerError, fmt.Errorf("internal server error")
@@ -326,8 +331,8 @@ func LogXlsxEndpoint(s Store) http.HandlerFunc {
 //go:embed templates/log.html
 var logHTMLTemplate string
 
-func LogHTMLEndpoint(s Store) http.HandlerFunc {
-	tmpl := loadHTMLTemplate(logHTMLTemplate)
+func LogHTMLEndpoint(s Store, basePath string) http.HandlerFunc {
+	tmpl := loadHTMLTemplate(logHTMLTemplate, basePath)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		opts, err := newLogOptionsByRequest(s, "log.html", r, time.Hour)
@@ -278,7 +278,12 @@ func FetchLogsByJq(ctx context.Context, s Store, input MCPLogsInput) (MCPOutput,
 		}
 	}
 
-	logs, err := s.OpenLog(since, until)
+	var logs api.LogScanner
+	if q != nil {
+		logs, err = s.OpenLogByTarget(since, until, q.MatchTarget)
+	} else {
+		logs, err = s.OpenLog(since, until)
+	}
 	if err != nil {
 		s.ReportInternalError("mcp/query_logs", fmt.Sprintf("failed to open logs: %v", err))
 		return MCPOutput{}, errors.New("internal server error")
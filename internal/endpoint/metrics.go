@@ -3,8 +3,11 @@ package endpoint
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/macrat/ayd/internal/stats"
 	api "github.com/macrat/ayd/lib-ayd"
 )
 
@@ -20,6 +23,16 @@ type metricInfo struct {
 	Latency   float64
 }
 
+// escapeLabel escapes a string for label value of metrics.
+func escapeLabel(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "\n", `\n`), `"`, `\"`)
+}
+
+// formatFloat formats a float value for metrics.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
 // MetricsEndpoint implements Prometheus metrics endpoint.
 // This endpoint follows both of Prometheus specification and OpenMetrics specification.
 func MetricsEndpoint(s Store) http.HandlerFunc {
@@ -33,7 +46,7 @@ func MetricsEndpoint(s Store) http.HandlerFunc {
 				m := metricInfo{
 					Timestamp: last.Time.UnixMilli(),
 					Latency:   last.Latency.Seconds(),
-					Target:    strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(hs.Target.String(), `\`, `\\`), "\n", `\n`), `"`, `\"`),
+					Target:    escapeLabel(hs.Target.String()),
 				}
 
 				switch last.Status {
@@ -88,5 +101,65 @@ func MetricsEndpoint(s Store) http.HandlerFunc {
 		fmt.Fprintln(w, "# HELP ayd_incident_total The number of incident happened since server started.")
 		fmt.Fprintln(w, "# TYPE ayd_incident_total counter")
 		fmt.Fprintf(w, "ayd_incident_total %d\n", s.IncidentCount())
+		fmt.Fprintln(w)
+
+		snapshot := s.Metrics()
+		now := time.Now()
+
+		fmt.Fprintln(w, "# HELP ayd_probe_total The number of checks for the target since server started, by the result status.")
+		fmt.Fprintln(w, "# TYPE ayd_probe_total counter")
+		for _, m := range snapshot.Targets {
+			target := escapeLabel(m.Target.String())
+			for _, st := range []api.Status{api.StatusHealthy, api.StatusUnknown, api.StatusDegrade, api.StatusFailure, api.StatusAborted} {
+				fmt.Fprintf(w, "ayd_probe_total{target=\"%s\",status=\"%s\"} %d\n", target, strings.ToLower(st.String()), m.Probes[st])
+			}
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintln(w, "# HELP ayd_probe_latency_seconds The histogram of the duration in seconds that taken checking for the target since server started.")
+		fmt.Fprintln(w, "# TYPE ayd_probe_latency_seconds histogram")
+		fmt.Fprintln(w, "# UNIT ayd_probe_latency_seconds seconds")
+		for _, m := range snapshot.Targets {
+			target := escapeLabel(m.Target.String())
+			for i, le := range stats.LatencyBuckets {
+				fmt.Fprintf(w, "ayd_probe_latency_seconds_bucket{target=\"%s\",le=\"%s\"} %d\n", target, formatFloat(le), m.LatencyBuckets[i])
+			}
+			fmt.Fprintf(w, "ayd_probe_latency_seconds_bucket{target=\"%s\",le=\"+Inf\"} %d\n", target, m.LatencyCount)
+			fmt.Fprintf(w, "ayd_probe_latency_seconds_sum{target=\"%s\"} %s\n", target, formatFloat(m.LatencySum.Seconds()))
+			fmt.Fprintf(w, "ayd_probe_latency_seconds_count{target=\"%s\"} %d\n", target, m.LatencyCount)
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintln(w, "# HELP ayd_last_healthy_timestamp_seconds The unix time in seconds when the target was HEALTHY at last.")
+		fmt.Fprintln(w, "# TYPE ayd_last_healthy_timestamp_seconds gauge")
+		fmt.Fprintln(w, "# UNIT ayd_last_healthy_timestamp_seconds seconds")
+		for _, m := range snapshot.Targets {
+			if !m.LastHealthy.IsZero() {
+				fmt.Fprintf(w, "ayd_last_healthy_timestamp_seconds{target=\"%s\"} %s\n", escapeLabel(m.Target.String()), formatFloat(float64(m.LastHealthy.UnixMilli())/1000))
+			}
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintln(w, "# HELP ayd_incident_duration_seconds The duration in seconds since the current incident of the target started.")
+		fmt.Fprintln(w, "# TYPE ayd_incident_duration_seconds gauge")
+		fmt.Fprintln(w, "# UNIT ayd_incident_duration_seconds seconds")
+		for _, inc := range s.CurrentIncidents() {
+			fmt.Fprintf(w, "ayd_incident_duration_seconds{target=\"%s\",status=\"%s\"} %s\n", escapeLabel(inc.Target.String()), strings.ToLower(inc.Status.String()), formatFloat(now.Sub(inc.StartsAt).Seconds()))
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintln(w, "# HELP ayd_scheduler_lag_seconds The delay in seconds of the last check of the target from the schedule.")
+		fmt.Fprintln(w, "# TYPE ayd_scheduler_lag_seconds gauge")
+		fmt.Fprintln(w, "# UNIT ayd_scheduler_lag_seconds seconds")
+		for _, m := range snapshot.Targets {
+			if m.Scheduled {
+				fmt.Fprintf(w, "ayd_scheduler_lag_seconds{target=\"%s\"} %s\n", escapeLabel(m.Target.String()), formatFloat(m.SchedulerLag.Seconds()))
+			}
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintln(w, "# HELP ayd_log_errors_total The number of errors when writing the log file since server started.")
+		fmt.Fprintln(w, "# TYPE ayd_log_errors_total counter")
+		fmt.Fprintf(w, "ayd_log_errors_total %d\n", snapshot.LogErrors)
 	}
 }
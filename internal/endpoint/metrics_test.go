@@ -1,10 +1,16 @@
 package endpoint_test
 
 import (
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"regexp"
 	"testing"
+	"time"
 
+	"github.com/macrat/ayd/internal/endpoint"
 	"github.com/macrat/ayd/internal/testutil"
+	api "github.com/macrat/ayd/lib-ayd"
 )
 
 func TestMetricsEndpoint(t *testing.T) {
@@ -17,3 +23,49 @@ func TestMetricsEndpoint(t *testing.T) {
 		t.Errorf("unexpected status: %s", resp.Status)
 	}
 }
+
+func TestMetricsEndpoint_statistics(t *testing.T) {
+	s := testutil.NewStore(t, testutil.WithLog())
+	defer s.Close()
+
+	target := &api.URL{Scheme: "dummy", Fragment: "metrics-test"}
+	s.ActivateTarget(target, target)
+	s.Report(target, api.Record{Time: time.Now().Add(-2 * time.Minute), Status: api.StatusHealthy, Target: target, Latency: 20 * time.Millisecond})
+	s.Report(target, api.Record{Time: time.Now().Add(-time.Minute), Status: api.StatusFailure, Target: target, Latency: 2 * time.Second})
+	s.SetSchedulerLag(target, 1500*time.Millisecond)
+
+	srv := httptest.NewServer(endpoint.New(s, endpoint.Config{}))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %s", err)
+	}
+
+	patterns := []string{
+		"\n# TYPE ayd_probe_total counter\n",
+		`\nayd_probe_total\{target="dummy:#metrics-test",status="healthy"\} 1\n`,
+		`\nayd_probe_total\{target="dummy:#metrics-test",status="failure"\} 1\n`,
+		"\n# TYPE ayd_probe_latency_seconds histogram\n",
+		`\nayd_probe_latency_seconds_bucket\{target="dummy:#metrics-test",le="0.025"\} 1\n`,
+		`\nayd_probe_latency_seconds_bucket\{target="dummy:#metrics-test",le="2.5"\} 2\n`,
+		`\nayd_probe_latency_seconds_bucket\{target="dummy:#metrics-test",le="\+Inf"\} 2\n`,
+		`\nayd_probe_latency_seconds_sum\{target="dummy:#metrics-test"\} 2.02\n`,
+		`\nayd_probe_latency_seconds_count\{target="dummy:#metrics-test"\} 2\n`,
+		`\nayd_last_healthy_timestamp_seconds\{target="dummy:#metrics-test"\} [0-9]+(\.[0-9]+)?\n`,
+		`\nayd_incident_duration_seconds\{target="dummy:#metrics-test",status="failure"\} [0-9]+(\.[0-9]+)?\n`,
+		`\nayd_scheduler_lag_seconds\{target="dummy:#metrics-test"\} 1.5\n`,
+		"\nayd_log_errors_total 0\n",
+	}
+	for _, p := range patterns {
+		if !regexp.MustCompile(p).Match(body) {
+			t.Errorf("expected to match with %q but not\n%s", p, body)
+		}
+	}
+}
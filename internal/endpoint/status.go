@@ -11,8 +11,8 @@ import (
 //go:embed templates/status.html
 var statusHTMLTemplate string
 
-func StatusHTMLEndpoint(s Store) http.HandlerFunc {
-	tmpl := loadHTMLTemplate(statusHTMLTemplate)
+func StatusHTMLEndpoint(s Store, basePath string) http.HandlerFunc {
+	tmpl := loadHTMLTemplate(statusHTMLTemplate, basePath)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
@@ -3,6 +3,7 @@ package endpoint
 import (
 	"time"
 
+	"github.com/macrat/ayd/internal/stats"
 	api "github.com/macrat/ayd/lib-ayd"
 )
 
@@ -34,6 +35,18 @@ type Store interface {
 	// IncidentCount returns the count of incident causes.
 	IncidentCount() int
 
+	// Metrics returns the statistics since Ayd started.
+	Metrics() stats.Metrics
+
 	// OpenLog opens ayd.LogScanner.
 	OpenLog(since, until time.Time) (api.LogScanner, error)
+
+	// OpenLogByTarget opens ayd.LogScanner for the targets that match.
+	OpenLogByTarget(since, until time.Time, match func(*api.URL) bool) (api.LogScanner, error)
+
+	// Rollups returns summaries of records for long-term history, and the end of the summarized period.
+	Rollups(interval stats.RollupInterval, since, until time.Time, match func(*api.URL) bool) ([]stats.Rollup, time.Time, error)
+
+	// IncidentsBetween derives incidents from the log for the targets that match.
+	IncidentsBetween(since, until time.Time, match func(*api.URL) bool) ([]*api.Incident, error)
 }
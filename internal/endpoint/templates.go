@@ -21,14 +21,21 @@ var baseHTMLTemplateStr string
 
 var baseHTMLTemplate = template.Must(template.New("base.html").Funcs(templateFuncs).Parse(baseHTMLTemplateStr))
 
-func loadHTMLTemplate(s string) *template.Template {
+func loadHTMLTemplate(s, basePath string) *template.Template {
 	return template.Must(
-		template.Must(baseHTMLTemplate.Clone()).Parse(s),
+		template.Must(baseHTMLTemplate.Clone()).Funcs(template.FuncMap{
+			"base_path": func() string {
+				return basePath
+			},
+		}).Parse(s),
 	)
 }
 
 var (
 	templateFuncs = map[string]interface{}{
+		"base_path": func() string {
+			return "/"
+		},
 		"sort_history": func(hm map[string]api.ProbeHistory) []api.ProbeHistory {
 			hs := make([]api.ProbeHistory, 0, len(hm))
 			for _, h := range hm {
@@ -0,0 +1,134 @@
+package logconv
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// Format is a format of a log line.
+type Format int
+
+const (
+	// FormatJSON is the JSON Lines format, the same as Ayd's log file.
+	FormatJSON Format = iota
+
+	// FormatLTSV is the LTSV (Labeled Tab-Separated Values) format.
+	FormatLTSV
+
+	// FormatText is the human-readable format.
+	FormatText
+)
+
+// ParseFormat parses a format name; "json", "ltsv", or "text".
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "json":
+		return FormatJSON, nil
+	case "ltsv":
+		return FormatLTSV, nil
+	case "text":
+		return FormatText, nil
+	default:
+		return FormatJSON, fmt.Errorf("unsupported log format: %s", s)
+	}
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatLTSV:
+		return "ltsv"
+	case FormatText:
+		return "text"
+	default:
+		return "json"
+	}
+}
+
+// Line formats a record as a line, without the trailing newline.
+// The color option is used only in FormatText, to colorize the line by ANSI escape sequences.
+func (f Format) Line(r api.Record, color bool) string {
+	switch f {
+	case FormatLTSV:
+		return LTSVLine(r)
+	case FormatText:
+		return TextLine(r, color)
+	default:
+		return r.String()
+	}
+}
+
+// LTSVLine formats a record as a LTSV line, without the trailing newline.
+func LTSVLine(r api.Record) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(
+		&sb,
+		"time:%s\tstatus:%s\tlatency:%.3f\ttarget:%s",
+		r.Time.Format(time.RFC3339),
+		r.Status,
+		float64(r.Latency.Microseconds())/1000,
+		r.Target,
+	)
+
+	if r.Message != "" {
+		fmt.Fprintf(&sb, "\tmessage:%s", r.Message)
+	}
+
+	for _, e := range r.ReadableExtra() {
+		s := e.Value
+		if _, ok := r.Extra[e.Key].(string); ok {
+			// You should escape if the value is string. Otherwise, it's already escaped as a JSON value.
+			s = strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(e.Value, `\`, `\\`), "\t", `\t`), "\n", `\n`), "\r", `\r`)
+		}
+		fmt.Fprintf(&sb, "\t%s:%s", e.Key, s)
+	}
+
+	return sb.String()
+}
+
+func statusColor(s api.Status) string {
+	switch s {
+	case api.StatusHealthy:
+		return "\x1b[32m"
+	case api.StatusDegrade:
+		return "\x1b[33m"
+	case api.StatusFailure:
+		return "\x1b[31m"
+	case api.StatusAborted:
+		return "\x1b[90m"
+	default:
+		return "\x1b[35m"
+	}
+}
+
+// TextLine formats a record as a human-readable line, without the trailing newline.
+// The continuation lines of a multi-line message are indented.
+func TextLine(r api.Record, color bool) string {
+	var sb strings.Builder
+
+	if color {
+		fmt.Fprintf(&sb, "\x1b[2m%s\x1b[0m %s%s\x1b[0m", r.Time.Format(time.RFC3339), statusColor(r.Status), r.Status)
+	} else {
+		fmt.Fprintf(&sb, "%s %s", r.Time.Format(time.RFC3339), r.Status)
+	}
+
+	fmt.Fprintf(&sb, " %9.3fms %s", float64(r.Latency.Microseconds())/1000, r.Target)
+
+	if r.Message != "" {
+		sb.WriteString("  ")
+		sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(r.Message, "\r\n", "\n"), "\n", "\n    "))
+	}
+
+	for _, e := range r.ReadableExtra() {
+		if color {
+			fmt.Fprintf(&sb, "  \x1b[2m%s=\x1b[0m%s", e.Key, e.Value)
+		} else {
+			fmt.Fprintf(&sb, "  %s=%s", e.Key, e.Value)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,61 @@
+package logconv_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/macrat/ayd/internal/logconv"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Output logconv.Format
+		Error  bool
+	}{
+		{"", logconv.FormatJSON, false},
+		{"json", logconv.FormatJSON, false},
+		{"LTSV", logconv.FormatLTSV, false},
+		{"text", logconv.FormatText, false},
+		{"csv", logconv.FormatJSON, true},
+	}
+
+	for _, tt := range tests {
+		f, err := logconv.ParseFormat(tt.Input)
+		if (err != nil) != tt.Error {
+			t.Errorf("%q: unexpected error: %v", tt.Input, err)
+		}
+		if f != tt.Output {
+			t.Errorf("%q: expected %s but got %s", tt.Input, tt.Output, f)
+		}
+	}
+}
+
+func TestFormat_Line(t *testing.T) {
+	r := api.Record{
+		Time:    time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC),
+		Status:  api.StatusFailure,
+		Latency: 123456 * time.Microsecond,
+		Target:  &api.URL{Scheme: "dummy", Opaque: "failure"},
+		Message: "hello\nworld",
+		Extra:   map[string]any{"foo": "bar"},
+	}
+
+	tests := []struct {
+		Format logconv.Format
+		Color  bool
+		Output string
+	}{
+		{logconv.FormatJSON, false, `{"time":"2021-01-02T15:04:05Z", "status":"FAILURE", "latency":123.456, "target":"dummy:failure", "message":"hello\nworld", "foo":"bar"}`},
+		{logconv.FormatLTSV, false, "time:2021-01-02T15:04:05Z\tstatus:FAILURE\tlatency:123.456\ttarget:dummy:failure\tmessage:hello\nworld\tfoo:bar"},
+		{logconv.FormatText, false, "2021-01-02T15:04:05Z FAILURE   123.456ms dummy:failure  hello\n    world  foo=bar"},
+		{logconv.FormatText, true, "\x1b[2m2021-01-02T15:04:05Z\x1b[0m \x1b[31mFAILURE\x1b[0m   123.456ms dummy:failure  hello\n    world  \x1b[2mfoo=\x1b[0mbar"},
+	}
+
+	for _, tt := range tests {
+		if s := tt.Format.Line(r, tt.Color); s != tt.Output {
+			t.Errorf("%s(color=%v): unexpected output\nexpected: %q\n but got: %q", tt.Format, tt.Color, tt.Output, s)
+		}
+	}
+}
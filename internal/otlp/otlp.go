@@ -0,0 +1,356 @@
+// Package otlp implements an exporter that sends probe results to OpenTelemetry collectors using OTLP/HTTP with JSON encoding.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/macrat/ayd/internal/meta"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+const (
+	scopeName = "github.com/macrat/ayd"
+
+	// maxPendingSpans is the maximum number of spans kept until the next export.
+	// The oldest spans are dropped if exceeded.
+	maxPendingSpans = 10000
+)
+
+var statuses = []api.Status{api.StatusHealthy, api.StatusUnknown, api.StatusDegrade, api.StatusFailure, api.StatusAborted}
+
+// Exporter collects records and pushes them to an OTLP/HTTP endpoint periodically.
+type Exporter struct {
+	// Endpoint is the base URL of the OTLP/HTTP receiver, like "http://localhost:4318".
+	// The records will be sent to "/v1/metrics" and "/v1/traces" on this URL.
+	Endpoint string
+
+	// Headers is the HTTP headers sent with each request, like an authorization token.
+	Headers map[string]string
+
+	// Traces enables exporting each record as a span.
+	Traces bool
+
+	// InstanceName is used as the service.instance.id resource attribute if it is not empty.
+	InstanceName string
+
+	// Client is the HTTP client to send requests. http.DefaultClient is used if nil.
+	Client *http.Client
+
+	mu        sync.Mutex
+	startedAt time.Time
+	targets   map[string]*targetState
+	spans     []api.Record
+}
+
+type targetState struct {
+	Target *api.URL
+	Latest api.Record
+	Counts map[api.Status]uint64
+}
+
+// New creates a new Exporter.
+func New(endpoint string, headers map[string]string, traces bool, instanceName string) *Exporter {
+	return &Exporter{
+		Endpoint:     strings.TrimRight(endpoint, "/"),
+		Headers:      headers,
+		Traces:       traces,
+		InstanceName: instanceName,
+		startedAt:    time.Now(),
+		targets:      make(map[string]*targetState),
+	}
+}
+
+// Observe collects a record to export.
+// The records about Ayd itself and alerts are ignored.
+func (e *Exporter) Observe(r api.Record) {
+	if r.Target == nil || r.Target.Scheme == "alert" || r.Target.Scheme == "ayd" {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := r.Target.String()
+	t, ok := e.targets[key]
+	if !ok {
+		t = &targetState{
+			Target: r.Target,
+			Counts: make(map[api.Status]uint64),
+		}
+		e.targets[key] = t
+	}
+	if !r.Time.Before(t.Latest.Time) {
+		t.Latest = r
+	}
+	t.Counts[r.Status]++
+
+	if e.Traces {
+		e.spans = append(e.spans, r)
+		if len(e.spans) > maxPendingSpans {
+			e.spans = e.spans[len(e.spans)-maxPendingSpans:]
+		}
+	}
+}
+
+// Run exports collected records every interval until ctx is done.
+// It exports once more when ctx is done, so that the last records are not lost.
+// The errors are passed to onError.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := e.Export(ctx); err != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+			if err := e.Export(ctx); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Export sends the collected metrics, and the spans if enabled, to the endpoint.
+func (e *Exporter) Export(ctx context.Context) error {
+	now := time.Now()
+
+	e.mu.Lock()
+	metrics := e.makeMetrics(now)
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+
+	// The traces are sent even if failed to send the metrics, because the spans are already taken from the queue.
+	var errs []error
+
+	if metrics != nil {
+		if err := e.post(ctx, "/v1/metrics", metrics); err != nil {
+			errs = append(errs, fmt.Errorf("failed to export metrics: %w", err))
+		}
+	}
+
+	if len(spans) > 0 {
+		if err := e.post(ctx, "/v1/traces", e.makeTraces(spans)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to export traces: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (e *Exporter) post(ctx context.Context, path string, body any) error {
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint+path, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *Exporter) resource() resource {
+	attrs := []keyValue{
+		stringAttr("service.name", "ayd"),
+		stringAttr("service.version", meta.Version),
+	}
+	if e.InstanceName != "" {
+		attrs = append(attrs, stringAttr("service.instance.id", e.InstanceName))
+	}
+	return resource{Attributes: attrs}
+}
+
+func (e *Exporter) sortedTargets() []*targetState {
+	ts := make([]*targetState, 0, len(e.targets))
+	for _, t := range e.targets {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i].Target.String() < ts[j].Target.String()
+	})
+	return ts
+}
+
+func (e *Exporter) makeMetrics(now time.Time) *exportMetricsRequest {
+	if len(e.targets) == 0 {
+		return nil
+	}
+
+	nowNano := unixNano(now)
+	startNano := unixNano(e.startedAt)
+
+	var status, latency, probes []numberDataPoint
+
+	for _, t := range e.sortedTargets() {
+		target := stringAttr("ayd.target", t.Target.String())
+		timeNano := unixNano(t.Latest.Time)
+
+		for _, s := range statuses {
+			v := 0
+			if t.Latest.Status == s {
+				v = 1
+			}
+			status = append(status, numberDataPoint{
+				Attributes:   []keyValue{target, stringAttr("ayd.status", strings.ToLower(s.String()))},
+				TimeUnixNano: timeNano,
+				AsInt:        strconv.Itoa(v),
+			})
+
+			probes = append(probes, numberDataPoint{
+				Attributes:        []keyValue{target, stringAttr("ayd.status", strings.ToLower(s.String()))},
+				StartTimeUnixNano: startNano,
+				TimeUnixNano:      nowNano,
+				AsInt:             strconv.FormatUint(t.Counts[s], 10),
+			})
+		}
+
+		d := t.Latest.Latency.Seconds()
+		latency = append(latency, numberDataPoint{
+			Attributes:   []keyValue{target},
+			TimeUnixNano: timeNano,
+			AsDouble:     &d,
+		})
+	}
+
+	return &exportMetricsRequest{
+		ResourceMetrics: []resourceMetrics{{
+			Resource: e.resource(),
+			ScopeMetrics: []scopeMetrics{{
+				Scope: scope{Name: scopeName, Version: meta.Version},
+				Metrics: []metric{
+					{
+						Name:        "ayd.status",
+						Description: "The latest status of the target. 1 for the current status, otherwise 0.",
+						Unit:        "1",
+						Gauge:       &gauge{DataPoints: status},
+					},
+					{
+						Name:        "ayd.latency",
+						Description: "The latest latency of the target.",
+						Unit:        "s",
+						Gauge:       &gauge{DataPoints: latency},
+					},
+					{
+						Name:        "ayd.probes",
+						Description: "The number of checks for the target since Ayd started.",
+						Unit:        "{probe}",
+						Sum: &sum{
+							DataPoints:             probes,
+							AggregationTemporality: aggregationTemporalityCumulative,
+							IsMonotonic:            true,
+						},
+					},
+				},
+			}},
+		}},
+	}
+}
+
+func (e *Exporter) makeTraces(rs []api.Record) *exportTraceRequest {
+	spans := make([]span, len(rs))
+	for i, r := range rs {
+		spans[i] = makeSpan(r)
+	}
+
+	return &exportTraceRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: e.resource(),
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: scopeName, Version: meta.Version},
+				Spans: spans,
+			}},
+		}},
+	}
+}
+
+func makeSpan(r api.Record) span {
+	attrs := []keyValue{
+		stringAttr("ayd.target", r.Target.String()),
+		stringAttr("ayd.scheme", r.Target.Scheme),
+		stringAttr("ayd.status", r.Status.String()),
+	}
+	if r.Message != "" {
+		attrs = append(attrs, stringAttr("ayd.message", r.Message))
+	}
+
+	keys := make([]string, 0, len(r.Extra))
+	for k := range r.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, keyValue{Key: "ayd.extra." + k, Value: toAnyValue(r.Extra[k])})
+	}
+
+	st := spanStatus{Code: statusCodeOk}
+	switch r.Status {
+	case api.StatusHealthy:
+	case api.StatusDegrade, api.StatusAborted:
+		st.Code = statusCodeUnset
+	default:
+		st.Code = statusCodeError
+		st.Message = r.Message
+	}
+
+	return span{
+		TraceID:           randomHex(16),
+		SpanID:            randomHex(8),
+		Name:              "probe " + r.Target.Scheme,
+		Kind:              spanKindClient,
+		StartTimeUnixNano: unixNano(r.Time),
+		EndTimeUnixNano:   unixNano(r.Time.Add(r.Latency)),
+		Attributes:        attrs,
+		Status:            st,
+	}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,293 @@
+package otlp_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/go-cmp/cmp"
+	"github.com/macrat/ayd/internal/otlp"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+type receivedRequest struct {
+	Path          string
+	ContentType   string
+	Authorization string
+	Body          map[string]any
+}
+
+// startReceiver starts a stand-in of OTLP/HTTP receiver.
+func startReceiver(t *testing.T, status int) (*httptest.Server, func() []receivedRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var reqs []receivedRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %s", err)
+		}
+
+		var body map[string]any
+		if err := json.Unmarshal(bs, &body); err != nil {
+			t.Errorf("failed to parse request body: %s\n%s", err, bs)
+		}
+
+		mu.Lock()
+		reqs = append(reqs, receivedRequest{
+			Path:          r.URL.Path,
+			ContentType:   r.Header.Get("Content-Type"),
+			Authorization: r.Header.Get("Authorization"),
+			Body:          body,
+		})
+		mu.Unlock()
+
+		w.WriteHeader(status)
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedRequest(nil), reqs...)
+	}
+}
+
+// dig gets a value in the nested JSON object.
+func dig(t *testing.T, x any, path ...any) any {
+	t.Helper()
+
+	for _, p := range path {
+		switch k := p.(type) {
+		case string:
+			m, ok := x.(map[string]any)
+			if !ok {
+				t.Fatalf("expected object for %q but got %#v", k, x)
+			}
+			x = m[k]
+		case int:
+			a, ok := x.([]any)
+			if !ok || len(a) <= k {
+				t.Fatalf("expected array longer than %d but got %#v", k, x)
+			}
+			x = a[k]
+		}
+	}
+	return x
+}
+
+func attributes(t *testing.T, x any) map[string]any {
+	t.Helper()
+
+	result := make(map[string]any)
+	attrs, _ := x.([]any)
+	for _, a := range attrs {
+		kv := a.(map[string]any)
+		for _, v := range kv["value"].(map[string]any) {
+			result[kv["key"].(string)] = v
+		}
+	}
+	return result
+}
+
+func TestExporter_Export(t *testing.T) {
+	srv, received := startReceiver(t, http.StatusOK)
+
+	e := otlp.New(srv.URL+"/", map[string]string{"Authorization": "Bearer token"}, true, "test-instance")
+
+	target := &api.URL{Scheme: "dummy", Fragment: "otlp"}
+	tm := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	e.Observe(api.Record{Time: tm, Status: api.StatusHealthy, Latency: 100 * time.Millisecond, Target: target})
+	e.Observe(api.Record{Time: tm.Add(time.Minute), Status: api.StatusFailure, Latency: 250 * time.Millisecond, Target: target, Message: "something wrong", Extra: map[string]any{"code": 42.0, "list": []any{"a"}}})
+	e.Observe(api.Record{Time: tm, Status: api.StatusFailure, Target: &api.URL{Scheme: "ayd", Opaque: "test"}})
+	e.Observe(api.Record{Time: tm, Status: api.StatusFailure, Target: &api.URL{Scheme: "alert", Opaque: "dummy:"}})
+
+	if err := e.Export(context.Background()); err != nil {
+		t.Fatalf("failed to export: %s", err)
+	}
+
+	reqs := received()
+	if len(reqs) != 2 {
+		t.Fatalf("unexpected number of requests: %d", len(reqs))
+	}
+
+	for _, r := range reqs {
+		if r.ContentType != "application/json" {
+			t.Errorf("%s: unexpected content type: %s", r.Path, r.ContentType)
+		}
+		if r.Authorization != "Bearer token" {
+			t.Errorf("%s: unexpected authorization header: %s", r.Path, r.Authorization)
+		}
+	}
+
+	metrics := reqs[0]
+	if metrics.Path != "/v1/metrics" {
+		t.Fatalf("unexpected path: %s", metrics.Path)
+	}
+
+	res := attributes(t, dig(t, metrics.Body, "resourceMetrics", 0, "resource", "attributes"))
+	if res["service.name"] != "ayd" || res["service.instance.id"] != "test-instance" {
+		t.Errorf("unexpected resource attributes: %v", res)
+	}
+
+	ms := dig(t, metrics.Body, "resourceMetrics", 0, "scopeMetrics", 0, "metrics").([]any)
+	if len(ms) != 3 {
+		t.Fatalf("unexpected number of metrics: %d", len(ms))
+	}
+
+	var failureStatus, failureProbes any
+	for _, dp := range dig(t, ms[0], "gauge", "dataPoints").([]any) {
+		if attributes(t, dig(t, dp, "attributes"))["ayd.status"] == "failure" {
+			failureStatus = dig(t, dp, "asInt")
+		}
+	}
+	if failureStatus != "1" {
+		t.Errorf("unexpected value of ayd.status for failure: %v", failureStatus)
+	}
+
+	if v := dig(t, ms[1], "gauge", "dataPoints", 0, "asDouble"); v != 0.25 {
+		t.Errorf("unexpected latency: %v", v)
+	}
+
+	if v := dig(t, ms[2], "sum", "isMonotonic"); v != true {
+		t.Errorf("expected ayd.probes is monotonic but got %v", v)
+	}
+	for _, dp := range dig(t, ms[2], "sum", "dataPoints").([]any) {
+		attrs := attributes(t, dig(t, dp, "attributes"))
+		if attrs["ayd.target"] != "dummy:#otlp" {
+			t.Errorf("unexpected target: %v", attrs["ayd.target"])
+		}
+		if attrs["ayd.status"] == "failure" {
+			failureProbes = dig(t, dp, "asInt")
+		}
+	}
+	if failureProbes != "1" {
+		t.Errorf("unexpected value of ayd.probes for failure: %v", failureProbes)
+	}
+
+	traces := reqs[1]
+	if traces.Path != "/v1/traces" {
+		t.Fatalf("unexpected path: %s", traces.Path)
+	}
+
+	spans := dig(t, traces.Body, "resourceSpans", 0, "scopeSpans", 0, "spans").([]any)
+	if len(spans) != 2 {
+		t.Fatalf("unexpected number of spans: %d", len(spans))
+	}
+
+	span := spans[1]
+	if name := dig(t, span, "name"); name != "probe dummy" {
+		t.Errorf("unexpected span name: %v", name)
+	}
+	if code := dig(t, span, "status", "code"); code != 2.0 {
+		t.Errorf("unexpected status code: %v", code)
+	}
+	if start, end := dig(t, span, "startTimeUnixNano"), dig(t, span, "endTimeUnixNano"); start != "1609599905000000000" || end != "1609599905250000000" {
+		t.Errorf("unexpected span time: %v - %v", start, end)
+	}
+	if diff := cmp.Diff(map[string]any{
+		"ayd.target":     "dummy:#otlp",
+		"ayd.scheme":     "dummy",
+		"ayd.status":     "FAILURE",
+		"ayd.message":    "something wrong",
+		"ayd.extra.code": "42",
+		"ayd.extra.list": `["a"]`,
+	}, attributes(t, dig(t, span, "attributes"))); diff != "" {
+		t.Errorf("unexpected span attributes:\n%s", diff)
+	}
+
+	// spans are sent only once, but metrics are sent every time.
+	if err := e.Export(context.Background()); err != nil {
+		t.Fatalf("failed to export: %s", err)
+	}
+	if reqs := received(); len(reqs) != 3 || reqs[2].Path != "/v1/metrics" {
+		t.Errorf("unexpected requests after second export: %v", reqs)
+	}
+}
+
+func TestExporter_Export_empty(t *testing.T) {
+	srv, received := startReceiver(t, http.StatusOK)
+
+	e := otlp.New(srv.URL, nil, false, "")
+	if err := e.Export(context.Background()); err != nil {
+		t.Fatalf("failed to export: %s", err)
+	}
+
+	if reqs := received(); len(reqs) != 0 {
+		t.Errorf("expected no request but got %d requests", len(reqs))
+	}
+}
+
+func TestExporter_Export_error(t *testing.T) {
+	srv, _ := startReceiver(t, http.StatusBadRequest)
+
+	e := otlp.New(srv.URL, nil, false, "")
+	e.Observe(api.Record{Time: time.Now(), Status: api.StatusHealthy, Target: &api.URL{Scheme: "dummy"}})
+
+	err := e.Export(context.Background())
+	if err == nil || err.Error() != "failed to export metrics: unexpected response status: 400 Bad Request" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestExporter_Export_metricsError(t *testing.T) {
+	var mu sync.Mutex
+	var traces int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/metrics" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		traces++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	e := otlp.New(srv.URL, nil, true, "")
+	e.Observe(api.Record{Time: time.Now(), Status: api.StatusHealthy, Target: &api.URL{Scheme: "dummy"}})
+
+	err := e.Export(context.Background())
+	if err == nil || err.Error() != "failed to export metrics: unexpected response status: 500 Internal Server Error" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if traces != 1 {
+		t.Errorf("traces should be sent even if failed to send metrics, but sent %d times", traces)
+	}
+}
+
+func TestExporter_Run(t *testing.T) {
+	srv, received := startReceiver(t, http.StatusOK)
+
+	e := otlp.New(srv.URL, nil, false, "")
+	e.Observe(api.Record{Time: time.Now(), Status: api.StatusHealthy, Target: &api.URL{Scheme: "dummy"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx, time.Hour, func(err error) {
+			t.Errorf("unexpected error: %s", err)
+		})
+		close(done)
+	}()
+
+	cancel()
+	<-done
+
+	if reqs := received(); len(reqs) != 1 {
+		t.Errorf("expected to export once when stopped but exported %d times", len(reqs))
+	}
+}
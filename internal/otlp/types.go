@@ -0,0 +1,143 @@
+package otlp
+
+import (
+	"strconv"
+
+	"github.com/goccy/go-json"
+)
+
+// The types in this file are the JSON representation of OTLP messages.
+// See https://github.com/open-telemetry/opentelemetry-proto for the definitions.
+
+const (
+	aggregationTemporalityCumulative = 2
+
+	spanKindClient = 3
+
+	statusCodeUnset = 0
+	statusCodeOk    = 1
+	statusCodeError = 2
+)
+
+type exportMetricsRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type metric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Gauge       *gauge `json:"gauge,omitempty"`
+	Sum         *sum   `json:"sum,omitempty"`
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type numberDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsInt             string     `json:"asInt,omitempty"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+}
+
+type exportTraceRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            spanStatus `json:"status"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    string   `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func stringAttr(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &value}}
+}
+
+// toAnyValue converts a value in api.Record.Extra to anyValue.
+// The values that are not a string, a number, or a boolean are encoded as JSON string.
+func toAnyValue(v any) anyValue {
+	switch x := v.(type) {
+	case string:
+		return anyValue{StringValue: &x}
+	case bool:
+		return anyValue{BoolValue: &x}
+	case int:
+		return anyValue{IntValue: strconv.Itoa(x)}
+	case int64:
+		return anyValue{IntValue: strconv.FormatInt(x, 10)}
+	case float64:
+		if x == float64(int64(x)) && x < 1e15 && x > -1e15 {
+			return anyValue{IntValue: strconv.FormatInt(int64(x), 10)}
+		}
+		return anyValue{DoubleValue: &x}
+	default:
+		bs, err := json.Marshal(x)
+		if err != nil {
+			s := ""
+			return anyValue{StringValue: &s}
+		}
+		s := string(bs)
+		return anyValue{StringValue: &s}
+	}
+}
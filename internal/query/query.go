@@ -14,6 +14,10 @@ type Query interface {
 	Match(api.Record) bool
 	Optimize() Query
 	TimeRange() (*time.Time, *time.Time)
+
+	// MatchTarget reports whether the query can match to any record of the target.
+	// It may report true even if no record of the target matches, but never reports false if a record can match.
+	MatchTarget(*api.URL) bool
 }
 
 type queryInverter interface {
@@ -170,6 +174,15 @@ func (q *And) TimeRange() (*time.Time, *time.Time) {
 	return start, end
 }
 
+func (q *And) MatchTarget(target *api.URL) bool {
+	for _, query := range q.Queries {
+		if !query.MatchTarget(target) {
+			return false
+		}
+	}
+	return true
+}
+
 type Or struct {
 	Queries []Query
 }
@@ -238,6 +251,15 @@ func (q *Or) TimeRange() (*time.Time, *time.Time) {
 	return start, end
 }
 
+func (q *Or) MatchTarget(target *api.URL) bool {
+	for _, query := range q.Queries {
+		if query.MatchTarget(target) {
+			return true
+		}
+	}
+	return false
+}
+
 type Not struct {
 	Query Query
 }
@@ -287,6 +309,15 @@ func (q *Not) TimeRange() (*time.Time, *time.Time) {
 	return nil, nil
 }
 
+func (q *Not) MatchTarget(target *api.URL) bool {
+	// Only the queries that depend on nothing but the target can be inverted.
+	// For example, "not target=ping:*" never matches to "ping:localhost", but "not status=healthy" can match to any target.
+	if f, ok := q.Query.(*FieldQuery); ok && f.isTargetOnly() {
+		return !f.Value.Match(target)
+	}
+	return true
+}
+
 type SimpleQuery struct {
 	Value valueMatcher
 }
@@ -326,6 +357,10 @@ func (q *SimpleQuery) TimeRange() (*time.Time, *time.Time) {
 	return nil, nil
 }
 
+func (q *SimpleQuery) MatchTarget(target *api.URL) bool {
+	return true
+}
+
 type FieldQuery struct {
 	Key   stringMatcher
 	Value valueMatcher
@@ -384,3 +419,16 @@ func (q *FieldQuery) TimeRange() (*time.Time, *time.Time) {
 
 	return nil, nil
 }
+
+func (q *FieldQuery) MatchTarget(target *api.URL) bool {
+	if !q.isTargetOnly() {
+		return true
+	}
+	return q.Value.Match(target)
+}
+
+// isTargetOnly reports whether the query looks only the target field.
+func (q *FieldQuery) isTargetOnly() bool {
+	m, ok := q.Key.(exactMatcher)
+	return ok && m.Str == "target"
+}
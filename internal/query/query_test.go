@@ -502,6 +502,43 @@ func TestQuery_TimeRange(t *testing.T) {
 	}
 }
 
+func TestQuery_MatchTarget(t *testing.T) {
+	tests := []struct {
+		query  string
+		target string
+		expect bool
+	}{
+		{"", "ping:localhost", true},
+		{"hello world", "ping:localhost", true},
+		{"target=ping:*", "ping:localhost", true},
+		{"target=ping:*", "http://example.com", false},
+		{"target=*example.com", "http://example.com", true},
+		{"-target=ping:*", "ping:localhost", false},
+		{"-target=ping:*", "http://example.com", true},
+		{"target=ping:* status=HEALTHY", "ping:localhost", true},
+		{"target=ping:* status=HEALTHY", "http://example.com", false},
+		{"target=ping:* OR status=HEALTHY", "http://example.com", true},
+		{"target=ping:* OR target=http:*", "http://example.com", true},
+		{"target=ping:* OR target=http:*", "dns:example.com", false},
+		{"NOT (target=ping:* status=HEALTHY)", "ping:localhost", true},
+		{"ping:*", "http://example.com", true},
+		{"targ*=ping:*", "http://example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query+" "+tt.target, func(t *testing.T) {
+			u, err := lib.ParseURL(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse target: %s", err)
+			}
+
+			if got := ParseQuery(tt.query).MatchTarget(u); got != tt.expect {
+				t.Errorf("expected %v but got %v", tt.expect, got)
+			}
+		})
+	}
+}
+
 func BenchmarkQuery_ParseQuery(b *testing.B) {
 	inputs := []string{
 		"a b c d e f g h i j k l m n o p q r s t u v w x y z",
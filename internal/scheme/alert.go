@@ -3,6 +3,7 @@ package scheme
 import (
 	"context"
 	"errors"
+	"net/url"
 	"sync"
 
 	"github.com/macrat/ayd/internal/ayderr"
@@ -14,6 +15,61 @@ var (
 	ErrUnsupportedAlertScheme = errors.New("unsupported scheme for alert")
 )
 
+// alertLinkKey is the key of the Extra that has the link to the log page of the target.
+// AlerterSet puts it to the records passed to alerters, so every alert payload can include the link.
+const alertLinkKey = "ayd_url"
+
+// alertLink makes a link to the log page about the record.
+// It returns an empty string if externalURL is empty.
+func alertLink(externalURL string, rec api.Record) string {
+	if externalURL == "" {
+		return ""
+	}
+
+	base := externalURL
+	if base[len(base)-1] != '/' {
+		base += "/"
+	}
+
+	qs := url.Values{}
+	qs.Set("q", "target="+rec.Target.String())
+	return base + "log.html?" + qs.Encode()
+}
+
+// withAlertLink returns a copy of the record that has the link to the log page in the Extra.
+func withAlertLink(externalURL string, rec api.Record) api.Record {
+	link := alertLink(externalURL, rec)
+	if link == "" {
+		return rec
+	}
+
+	extra := make(map[string]interface{}, len(rec.Extra)+1)
+	for k, v := range rec.Extra {
+		extra[k] = v
+	}
+	extra[alertLinkKey] = link
+	rec.Extra = extra
+
+	return rec
+}
+
+// splitAlertLink takes the link to the log page out of the Extra of the record.
+// It is for alerters that send the link separately from the Extra, like http: and exec:.
+func splitAlertLink(rec api.Record) (link string, extra map[string]interface{}) {
+	link, ok := rec.Extra[alertLinkKey].(string)
+	if !ok {
+		return "", rec.Extra
+	}
+
+	extra = make(map[string]interface{}, len(rec.Extra)-1)
+	for k, v := range rec.Extra {
+		if k != alertLinkKey {
+			extra[k] = v
+		}
+	}
+	return link, extra
+}
+
 // Alerter is the interface to send alerts to somewhere.
 type Alerter interface {
 	// Target returns the alert target URL.
@@ -36,6 +92,16 @@ func NewAlerterFromURL(u *api.URL) (Alerter, error) {
 		return nil, ErrUnsupportedAlertScheme
 	case "tcp", "tcp4", "tcp6":
 		return nil, ErrUnsupportedAlertScheme
+	case "udp", "udp4", "udp6":
+		return nil, ErrUnsupportedAlertScheme
+	case "smtp", "smtps", "imap", "imaps", "pop3", "pop3s":
+		return nil, ErrUnsupportedAlertScheme
+	case "postgres", "postgresql", "mysql", "redis", "rediss":
+		return nil, ErrUnsupportedAlertScheme
+	case "grpc", "grpcs", "ws", "wss", "ntp", "snmp", "ldap", "ldaps":
+		return nil, ErrUnsupportedAlertScheme
+	case "mqtt", "mqtts":
+		return NewMQTTAlert(u)
 	case "sftp":
 		return NewSFTPScheme(u)
 	case "dns", "dns4", "dns6":
@@ -53,13 +119,24 @@ func NewAlerterFromURL(u *api.URL) (Alerter, error) {
 	}
 }
 
+// NewAlerter makes an Alerter from the raw URL.
+// The secret references in the URL are resolved in the same way as NewProber.
 func NewAlerter(target string) (Alerter, error) {
-	u, err := api.ParseURL(target)
+	resolved, secrets, err := resolveSecretRefs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := api.ParseURL(resolved)
 	if err != nil {
 		return nil, ErrInvalidURL
 	}
 
-	return NewAlerterFromURL(u)
+	a, err := NewAlerterFromURL(u)
+	if err != nil || len(secrets) == 0 {
+		return a, err
+	}
+	return newSecretAlerter(a, secrets), nil
 }
 
 // AlertReporter is a wrapper of Reporter interface for alert schemes.
@@ -85,11 +162,21 @@ func (r AlertReporter) DeactivateTarget(source *api.URL, targets ...*api.URL) {
 
 // AlerterSet is a set of alerts.
 // It also implements Alerter alertinterface.
-type AlerterSet []Alerter
+type AlerterSet struct {
+	alerters []Alerter
 
-func NewAlerterSet(targets []string) (AlerterSet, error) {
+	// externalURL is the URL of the Ayd status page, like "https://example.com/monitoring/".
+	externalURL string
+}
+
+// NewAlerterSet makes a new AlerterSet.
+// If externalURL is not empty, the alerts include a link to the log page of the target.
+func NewAlerterSet(targets []string, externalURL string) (AlerterSet, error) {
 	urls := &urlSet{}
-	alerts := make(AlerterSet, 0, len(targets))
+	alerts := AlerterSet{
+		alerters:    make([]Alerter, 0, len(targets)),
+		externalURL: externalURL,
+	}
 	errs := &ayderr.ListBuilder{What: ErrInvalidAlertURL}
 
 	for _, t := range targets {
@@ -98,7 +185,7 @@ func NewAlerterSet(targets []string) (AlerterSet, error) {
 			errs.Pushf("%s: %w", t, err)
 		} else if !urls.Has(a.Target()) {
 			urls.Add(a.Target())
-			alerts = append(alerts, a)
+			alerts.alerters = append(alerts.alerters, a)
 		}
 	}
 
@@ -114,9 +201,11 @@ func (as AlerterSet) Target() *api.URL {
 // Alert of AlerterSet calls all Alert methods of children parallelly.
 // This method blocks until all alerts done.
 func (as AlerterSet) Alert(ctx context.Context, r Reporter, lastRecord api.Record) {
+	lastRecord = withAlertLink(as.externalURL, lastRecord)
+
 	wg := &sync.WaitGroup{}
 
-	for _, a := range as {
+	for _, a := range as.alerters {
 		wg.Add(1)
 		go func(a Alerter) {
 			a.Alert(ctx, r, lastRecord)
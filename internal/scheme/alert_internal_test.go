@@ -0,0 +1,54 @@
+package scheme
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+func Test_alertLink(t *testing.T) {
+	rec := api.Record{Target: &api.URL{Scheme: "ping", Opaque: "example.com"}}
+
+	tests := []struct {
+		ExternalURL string
+		Want        string
+	}{
+		{"", ""},
+		{"https://example.com/monitoring/", "https://example.com/monitoring/log.html?q=target%3Dping%3Aexample.com"},
+		{"https://example.com/monitoring", "https://example.com/monitoring/log.html?q=target%3Dping%3Aexample.com"},
+	}
+
+	for _, tt := range tests {
+		if got := alertLink(tt.ExternalURL, rec); got != tt.Want {
+			t.Errorf("%q: expected %q but got %q", tt.ExternalURL, tt.Want, got)
+		}
+	}
+}
+
+func Test_withAlertLink(t *testing.T) {
+	rec := api.Record{
+		Target: &api.URL{Scheme: "ping", Opaque: "example.com"},
+		Extra:  map[string]interface{}{"hello": "world"},
+	}
+
+	if r := withAlertLink("", rec); r.Extra[alertLinkKey] != nil {
+		t.Errorf("link should not be set without external URL: %v", r.Extra)
+	}
+
+	r := withAlertLink("https://example.com/", rec)
+	if r.Extra[alertLinkKey] != "https://example.com/log.html?q=target%3Dping%3Aexample.com" {
+		t.Errorf("unexpected link: %v", r.Extra)
+	}
+	if _, ok := rec.Extra[alertLinkKey]; ok {
+		t.Errorf("original record is modified: %v", rec.Extra)
+	}
+
+	link, extra := splitAlertLink(r)
+	if link != "https://example.com/log.html?q=target%3Dping%3Aexample.com" {
+		t.Errorf("unexpected link: %q", link)
+	}
+	if diff := cmp.Diff(map[string]interface{}{"hello": "world"}, extra); diff != "" {
+		t.Errorf("unexpected extra\n%s", diff)
+	}
+}
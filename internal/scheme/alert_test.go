@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -44,6 +45,17 @@ func TestAlerter(t *testing.T) {
 		{"tcp://example.com", "", "", "unsupported scheme for alert"},
 		{"tcp4://example.com", "", "", "unsupported scheme for alert"},
 		{"tcp6://example.com", "", "", "unsupported scheme for alert"},
+		{"udp://example.com:53", "", "", "unsupported scheme for alert"},
+		{"smtp://example.com", "", "", "unsupported scheme for alert"},
+		{"postgres://example.com", "", "", "unsupported scheme for alert"},
+		{"redis://example.com", "", "", "unsupported scheme for alert"},
+		{"grpc://example.com:50051", "", "", "unsupported scheme for alert"},
+		{"ws://example.com", "", "", "unsupported scheme for alert"},
+		{"ntp://example.com", "", "", "unsupported scheme for alert"},
+		{"snmp://example.com/1.3.6.1.2.1.1.3.0", "", "", "unsupported scheme for alert"},
+		{"ldap://example.com", "", "", "unsupported scheme for alert"},
+		{"mqtt://example.com", "", "", "missing topic to publish"},
+		{"mqtt://example.com/foo/+/bar", "", "", "cannot publish to a topic with wildcard"},
 		{"dns://example.com", "", "", "unsupported scheme for alert"},
 		{"dns4://example.com", "", "", "unsupported scheme for alert"},
 		{"dns6://example.com", "", "", "unsupported scheme for alert"},
@@ -202,7 +214,7 @@ func TestAlerterSet(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.Name, func(t *testing.T) {
-			as, err := scheme.NewAlerterSet(tt.URLs)
+			as, err := scheme.NewAlerterSet(tt.URLs, "")
 			if tt.Error != "" {
 				if err == nil {
 					t.Fatalf("expected error but returns nil")
@@ -250,10 +262,39 @@ func TestAlerterSet(t *testing.T) {
 	}
 }
 
+func TestAlerterSet_externalURL(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "alert.log")
+
+	as, err := scheme.NewAlerterSet([]string{"file:" + path}, "https://example.com/monitoring/")
+	if err != nil {
+		t.Fatalf("failed to create a new set: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	as.Alert(ctx, &testutil.DummyReporter{}, api.Record{
+		Target:  &api.URL{Scheme: "dummy", Opaque: "failure"},
+		Status:  api.StatusFailure,
+		Time:    time.Date(2001, 2, 3, 16, 5, 6, 0, time.UTC),
+		Message: "foobar",
+	})
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read alert: %s", err)
+	}
+	if !strings.Contains(string(raw), `"ayd_url":"https://example.com/monitoring/log.html?q=target%3Ddummy%3Afailure"`) {
+		t.Errorf("link is not included in the alert: %s", raw)
+	}
+}
+
 func TestAlerterSet_blocking(t *testing.T) {
 	t.Parallel()
 
-	as, err := scheme.NewAlerterSet([]string{"dummy:?latency=500ms", "dummy:?latency=1000ms"})
+	as, err := scheme.NewAlerterSet([]string{"dummy:?latency=500ms", "dummy:?latency=1000ms"}, "")
 	if err != nil {
 		t.Fatalf("failed to create a new set: %s", err)
 	}
@@ -0,0 +1,30 @@
+package scheme
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// dbConnectErrorRecord makes a record for an error while connecting to a database server.
+func dbConnectErrorRecord(err error) api.Record {
+	rec := api.Record{
+		Status:  api.StatusFailure,
+		Message: err.Error(),
+	}
+
+	dnsErr := &net.DNSError{}
+	if errors.As(err, &dnsErr) {
+		rec.Status = api.StatusUnknown
+		rec.Message = dnsErrorToMessage(dnsErr)
+	}
+
+	return rec
+}
+
+// milliseconds converts a duration to milliseconds, in the same precision as the latency in logs.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -234,12 +234,18 @@ func (s ExecLocalScheme) Alert(ctx context.Context, r Reporter, lastRecord api.R
 		"ayd_extra={}",
 	}
 
-	if lastRecord.Extra != nil {
-		if bs, err := json.Marshal(lastRecord.Extra); err == nil {
+	link, extra := splitAlertLink(lastRecord)
+
+	if extra != nil {
+		if bs, err := json.Marshal(extra); err == nil {
 			env[len(env)-1] = "ayd_extra=" + string(bs)
 		}
 	}
 
+	if link != "" {
+		env = append(env, "ayd_url="+link)
+	}
+
 	s.run(ctx, AlertReporter{s.target, r}, env)
 }
 
@@ -339,11 +345,17 @@ func (s ExecSSHScheme) Alert(ctx context.Context, r Reporter, lastRecord api.Rec
 		"ayd_extra":   "{}",
 	}
 
-	if lastRecord.Extra != nil {
-		if bs, err := json.Marshal(lastRecord.Extra); err == nil {
+	link, extra := splitAlertLink(lastRecord)
+
+	if extra != nil {
+		if bs, err := json.Marshal(extra); err == nil {
 			env["ayd_extra"] = string(bs)
 		}
 	}
 
+	if link != "" {
+		env["ayd_url"] = link
+	}
+
 	s.run(ctx, AlertReporter{s.target, r}, env)
 }
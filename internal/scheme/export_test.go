@@ -0,0 +1,14 @@
+package scheme
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+// SetTLSRootCAs replaces the root certificates to verify servers until the end of the test.
+func SetTLSRootCAs(t testing.TB, pool *x509.CertPool) {
+	old := tlsRootCAs.Swap(pool)
+	t.Cleanup(func() {
+		tlsRootCAs.Store(old)
+	})
+}
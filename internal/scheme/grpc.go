@@ -0,0 +1,137 @@
+package scheme
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrGRPCPortMissing = errors.New("gRPC target's port number is required")
+)
+
+// GRPCProbe is a Prober implementation for the gRPC health checking protocol.
+//
+// It calls grpc.health.v1.Health/Check for the service in the path, like "grpc://example.com:50051/my.service.Name".
+// The empty path means the overall health of the server.
+type GRPCProbe struct {
+	target  *api.URL
+	service string
+}
+
+func NewGRPCProbe(u *api.URL) (GRPCProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return GRPCProbe{}, ErrUnsupportedScheme
+	}
+
+	p := GRPCProbe{
+		target:  &api.URL{Scheme: scheme, Host: strings.ToLower(u.Host), Fragment: u.Fragment},
+		service: strings.Trim(u.Path, "/"),
+	}
+	if p.service != "" {
+		p.target.Path = "/" + p.service
+	}
+
+	if p.target.ToURL().Hostname() == "" {
+		return GRPCProbe{}, ErrMissingHost
+	}
+	if p.target.ToURL().Port() == "" && scheme == "grpc" {
+		return GRPCProbe{}, ErrGRPCPortMissing
+	}
+
+	return p, nil
+}
+
+func (p GRPCProbe) Target() *api.URL {
+	return p.target
+}
+
+func (p GRPCProbe) address() string {
+	u := p.target.ToURL()
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return u.Host
+}
+
+func (p GRPCProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := p.probe(ctx)
+	rec.Time = st
+	rec.Target = p.target
+	rec.Latency = time.Since(st)
+
+	r.Report(p.target, timeoutOr(ctx, rec))
+}
+
+func (p GRPCProbe) probe(ctx context.Context) api.Record {
+	creds := insecure.NewCredentials()
+	if p.target.Scheme == "grpcs" {
+		creds = credentials.NewTLS(newTLSConfig(p.target.ToURL().Hostname()))
+	}
+
+	conn, err := grpc.NewClient(p.address(), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return api.Record{
+			Status:  api.StatusUnknown,
+			Message: err.Error(),
+		}
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: p.service})
+	if err != nil {
+		st := status.Convert(err)
+		rec := api.Record{
+			Status:  api.StatusFailure,
+			Message: st.Message(),
+			Extra: map[string]interface{}{
+				"grpc_code": st.Code().String(),
+			},
+		}
+		switch st.Code() {
+		case codes.NotFound:
+			rec.Status = api.StatusUnknown
+			rec.Message = "service is unknown"
+		case codes.Unimplemented:
+			rec.Status = api.StatusUnknown
+			rec.Message = "health checking protocol is not implemented"
+		}
+		return rec
+	}
+
+	rec := api.Record{
+		Extra: map[string]interface{}{
+			"serving_status": resp.GetStatus().String(),
+		},
+	}
+	switch resp.GetStatus() {
+	case healthpb.HealthCheckResponse_SERVING:
+		rec.Status = api.StatusHealthy
+		rec.Message = "service is serving"
+	case healthpb.HealthCheckResponse_NOT_SERVING:
+		rec.Status = api.StatusFailure
+		rec.Message = "service is not serving"
+	case healthpb.HealthCheckResponse_SERVICE_UNKNOWN:
+		rec.Status = api.StatusUnknown
+		rec.Message = "service is unknown"
+	default:
+		rec.Status = api.StatusUnknown
+		rec.Message = "service status is unknown"
+	}
+	return rec
+}
@@ -0,0 +1,53 @@
+package scheme_test
+
+import (
+	"net"
+	"testing"
+
+	api "github.com/macrat/ayd/lib-ayd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// StartGRPCServer starts a gRPC server that implements the health checking protocol.
+// The server reports "serving.Service" as SERVING, and "stopped.Service" as NOT_SERVING.
+// If withHealth is false, the server doesn't implement the health checking protocol.
+func StartGRPCServer(t testing.TB, withHealth bool) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+
+	server := grpc.NewServer()
+	if withHealth {
+		h := health.NewServer()
+		h.SetServingStatus("serving.Service", healthpb.HealthCheckResponse_SERVING)
+		h.SetServingStatus("stopped.Service", healthpb.HealthCheckResponse_NOT_SERVING)
+		healthpb.RegisterHealthServer(server, h)
+	}
+
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	return l.Addr().String()
+}
+
+func TestGRPCProbe(t *testing.T) {
+	t.Parallel()
+
+	addr := StartGRPCServer(t, true)
+	noHealth := StartGRPCServer(t, false)
+
+	AssertProbe(t, []ProbeTest{
+		{"grpc://" + addr, api.StatusHealthy, `service is serving\n---\nserving_status: SERVING`, ""},
+		{"grpc://" + addr + "/serving.Service", api.StatusHealthy, `service is serving\n---\nserving_status: SERVING`, ""},
+		{"grpc://" + addr + "/stopped.Service", api.StatusFailure, `service is not serving\n---\nserving_status: NOT_SERVING`, ""},
+		{"grpc://" + addr + "/unknown.Service", api.StatusUnknown, `service is unknown\n---\ngrpc_code: NotFound`, ""},
+		{"grpc://" + noHealth, api.StatusUnknown, `health checking protocol is not implemented\n---\ngrpc_code: Unimplemented`, ""},
+		{"grpc://127.0.0.1:1", api.StatusFailure, `.*connection refused.*\n---\ngrpc_code: Unavailable`, ""},
+		{"grpc://example.com", api.StatusUnknown, "", "gRPC target's port number is required"},
+	}, 5)
+}
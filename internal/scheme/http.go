@@ -171,8 +171,13 @@ func (s HTTPScheme) Alert(ctx context.Context, r Reporter, lastRecord api.Record
 	qs.Set("ayd_message", lastRecord.Message)
 	qs.Set("ayd_extra", "{}")
 
-	if lastRecord.Extra != nil {
-		if bs, err := json.MarshalContext(ctx, lastRecord.Extra); err == nil {
+	link, extra := splitAlertLink(lastRecord)
+	if link != "" {
+		qs.Set("ayd_url", link)
+	}
+
+	if extra != nil {
+		if bs, err := json.MarshalContext(ctx, extra); err == nil {
 			qs.Set("ayd_extra", string(bs))
 		}
 	}
@@ -0,0 +1,248 @@
+package scheme
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrInvalidLDAPFilter = errors.New("invalid LDAP search filter")
+	ErrInvalidLDAPScope  = errors.New("invalid LDAP search scope")
+	ErrInvalidLDAPCount  = errors.New("invalid number of LDAP search results")
+)
+
+// ldapScopes is the search scopes that can be set by "scope" query.
+var ldapScopes = map[string]int{
+	"base": ldap.ScopeBaseObject,
+	"one":  ldap.ScopeSingleLevel,
+	"sub":  ldap.ScopeWholeSubtree,
+}
+
+// LDAPProbe is a Prober implementation for the LDAP.
+//
+// It binds to the server as the user in URL, or anonymously.
+// If the "filter", "scope", "min", or "max" query is set, it searches under the base DN in the path and checks the number of results, like "ldap://example.com/dc=example,dc=com?filter=(uid=alice)".
+type LDAPProbe struct {
+	target   *api.URL
+	startTLS bool
+	search   bool
+	filter   string
+	scope    int
+	min, max int
+}
+
+func NewLDAPProbe(u *api.URL) (LDAPProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return LDAPProbe{}, ErrUnsupportedScheme
+	}
+
+	p := LDAPProbe{
+		target: &api.URL{Scheme: scheme, User: u.User, Host: strings.ToLower(u.Host), Path: u.Path, Fragment: u.Fragment},
+		filter: "(objectClass=*)",
+		scope:  ldap.ScopeWholeSubtree,
+		max:    -1,
+	}
+	if p.target.ToURL().Hostname() == "" {
+		return LDAPProbe{}, ErrMissingHost
+	}
+
+	query := u.ToURL().Query()
+	q := url.Values{}
+
+	if s := query.Get("starttls"); s != "" && scheme == "ldap" {
+		var err error
+		if p.startTLS, err = strconv.ParseBool(s); err != nil {
+			return LDAPProbe{}, ErrInvalidStartTLS
+		}
+		if p.startTLS {
+			q.Set("starttls", "true")
+		}
+	}
+
+	if s := query.Get("filter"); s != "" {
+		if _, err := ldap.CompileFilter(s); err != nil {
+			return LDAPProbe{}, ErrInvalidLDAPFilter
+		}
+		p.search = true
+		p.filter = s
+		q.Set("filter", s)
+	}
+
+	if s := query.Get("scope"); s != "" {
+		scope, ok := ldapScopes[strings.ToLower(s)]
+		if !ok {
+			return LDAPProbe{}, ErrInvalidLDAPScope
+		}
+		p.search = true
+		p.scope = scope
+		q.Set("scope", strings.ToLower(s))
+	}
+
+	for _, x := range []struct {
+		Name string
+		Ptr  *int
+	}{
+		{"min", &p.min},
+		{"max", &p.max},
+	} {
+		if s := query.Get(x.Name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return LDAPProbe{}, ErrInvalidLDAPCount
+			}
+			p.search = true
+			*x.Ptr = n
+			q.Set(x.Name, strconv.Itoa(n))
+		}
+	}
+	if query.Get("min") == "" && query.Get("max") == "" {
+		// Require at least one result in default.
+		p.min = 1
+	}
+	if p.max >= 0 && p.max < p.min {
+		return LDAPProbe{}, ErrInvalidLDAPCount
+	}
+
+	p.target.RawQuery = q.Encode()
+
+	return p, nil
+}
+
+func (p LDAPProbe) Target() *api.URL {
+	return p.target
+}
+
+func (p LDAPProbe) address() string {
+	u := p.target.ToURL()
+	if u.Port() != "" {
+		return u.Host
+	}
+	if p.target.Scheme == "ldaps" {
+		return net.JoinHostPort(u.Hostname(), "636")
+	}
+	return net.JoinHostPort(u.Hostname(), "389")
+}
+
+func (p LDAPProbe) dial(ctx context.Context) (net.Conn, error) {
+	if p.target.Scheme == "ldaps" {
+		dialer := tls.Dialer{
+			Config: newTLSConfig(p.target.ToURL().Hostname()),
+		}
+		return dialer.DialContext(ctx, "tcp", p.address())
+	}
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", p.address())
+}
+
+func (p LDAPProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := p.probe(ctx)
+	rec.Time = st
+	rec.Target = p.target
+	rec.Latency = time.Since(st)
+
+	r.Report(p.target, timeoutOr(ctx, rec))
+}
+
+func (p LDAPProbe) probe(ctx context.Context) api.Record {
+	conn, err := p.dial(ctx)
+	if err != nil {
+		rec := api.Record{
+			Status:  api.StatusFailure,
+			Message: err.Error(),
+		}
+
+		dnsErr := &net.DNSError{}
+		if errors.As(err, &dnsErr) {
+			rec.Status = api.StatusUnknown
+			rec.Message = dnsErrorToMessage(dnsErr)
+		}
+		return rec
+	}
+
+	l := ldap.NewConn(conn, p.target.Scheme == "ldaps")
+	l.Start()
+	defer l.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		l.Close()
+	})
+	defer stop()
+
+	extra := map[string]interface{}{}
+
+	if p.startTLS {
+		if err := l.StartTLS(newTLSConfig(p.target.ToURL().Hostname())); err != nil {
+			return api.Record{
+				Status:  api.StatusFailure,
+				Message: "failed to start TLS: " + err.Error(),
+			}
+		}
+	}
+	if state, ok := l.TLSConnectionState(); ok {
+		setTLSExtra(extra, state)
+	}
+
+	if p.target.User != nil && p.target.User.Username() != "" {
+		password, _ := p.target.User.Password()
+		err = l.Bind(p.target.User.Username(), password)
+	} else {
+		err = l.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return api.Record{
+			Status:  api.StatusFailure,
+			Message: "failed to bind: " + err.Error(),
+			Extra:   extra,
+		}
+	}
+
+	rec := api.Record{
+		Status:  api.StatusHealthy,
+		Message: "succeed to bind",
+		Extra:   extra,
+	}
+
+	if !p.search {
+		return rec
+	}
+
+	st := time.Now()
+	// "1.1" means that no attributes are needed.
+	result, err := l.Search(ldap.NewSearchRequest(strings.TrimPrefix(p.target.Path, "/"), p.scope, ldap.NeverDerefAliases, 0, 0, false, p.filter, []string{"1.1"}, nil))
+	extra["search_latency"] = milliseconds(time.Since(st))
+	if err != nil {
+		rec.Status = api.StatusFailure
+		rec.Message = "failed to search: " + err.Error()
+		return rec
+	}
+
+	n := len(result.Entries)
+	extra["result_count"] = n
+	rec.Message = "succeed to search"
+
+	if n < p.min {
+		rec.Status = api.StatusFailure
+		rec.Message = fmt.Sprintf("result count %d is smaller than %d", n, p.min)
+	} else if p.max >= 0 && n > p.max {
+		rec.Status = api.StatusFailure
+		rec.Message = fmt.Sprintf("result count %d is larger than %d", n, p.max)
+	}
+
+	return rec
+}
@@ -0,0 +1,175 @@
+package scheme_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// testLDAPEntries is the entries in the stand-in LDAP server.
+var testLDAPEntries = []map[string]string{
+	{"dn": "dc=example,dc=com", "objectClass": "domain"},
+	{"dn": "ou=people,dc=example,dc=com", "objectClass": "organizationalUnit"},
+	{"dn": "uid=alice,ou=people,dc=example,dc=com", "objectClass": "person", "uid": "alice"},
+	{"dn": "uid=bob,ou=people,dc=example,dc=com", "objectClass": "person", "uid": "bob"},
+}
+
+// StartLDAPServer starts a stand-in LDAP server.
+// It accepts anonymous bind, and "cn=admin,dc=example,dc=com" with password "secret".
+// The search supports only equality match, presence, and AND filter.
+func StartLDAPServer(t testing.TB) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				serveLDAP(conn)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func serveLDAP(conn net.Conn) {
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		id := req.Children[0].Value.(int64)
+		op := req.Children[1]
+
+		send := func(tag ber.Tag, children ...*ber.Packet) {
+			msg := ber.NewSequence("LDAP Message")
+			msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+			resp := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+			for _, c := range children {
+				resp.AppendChild(c)
+			}
+			msg.AppendChild(resp)
+			conn.Write(msg.Bytes())
+		}
+		result := func(tag ber.Tag, code int, message string) {
+			send(
+				tag,
+				ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"),
+				ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"),
+				ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"),
+			)
+		}
+
+		switch op.Tag {
+		case 0: // BindRequest
+			name := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			if name == "" || (name == "cn=admin,dc=example,dc=com" && password == "secret") {
+				result(1, 0, "")
+			} else {
+				result(1, 49, "invalid credentials")
+			}
+		case 2: // UnbindRequest
+			return
+		case 3: // SearchRequest
+			base := op.Children[0].Value.(string)
+			scope := op.Children[1].Value.(int64)
+
+			found := false
+			for _, e := range testLDAPEntries {
+				if e["dn"] == base {
+					found = true
+				}
+			}
+			if !found {
+				result(5, 32, "no such object")
+				continue
+			}
+
+			for _, e := range testLDAPEntries {
+				dn := e["dn"]
+				var inScope bool
+				switch scope {
+				case 0:
+					inScope = dn == base
+				case 1:
+					inScope = strings.HasSuffix(dn, ","+base) && !strings.Contains(strings.TrimSuffix(dn, ","+base), ",")
+				default:
+					inScope = dn == base || strings.HasSuffix(dn, ","+base)
+				}
+				if inScope && matchLDAPFilter(op.Children[6], e) {
+					send(
+						4,
+						ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "Object Name"),
+						ber.NewSequence("Attributes"),
+					)
+				}
+			}
+			result(5, 0, "")
+		default:
+			return
+		}
+	}
+}
+
+func matchLDAPFilter(f *ber.Packet, entry map[string]string) bool {
+	switch f.Tag {
+	case 0: // and
+		for _, c := range f.Children {
+			if !matchLDAPFilter(c, entry) {
+				return false
+			}
+		}
+		return true
+	case 3: // equalityMatch
+		return entry[f.Children[0].Value.(string)] == f.Children[1].Value.(string)
+	case 7: // present
+		_, ok := entry[f.Data.String()]
+		return ok
+	default:
+		return false
+	}
+}
+
+func TestLDAPProbe(t *testing.T) {
+	t.Parallel()
+
+	addr := StartLDAPServer(t)
+	admin := "ldap://cn=admin,dc=example,dc=com:secret@" + addr
+
+	AssertProbe(t, []ProbeTest{
+		{"ldap://" + addr, api.StatusHealthy, `succeed to bind`, ""},
+		{admin, api.StatusHealthy, `succeed to bind`, ""},
+		{"ldap://cn=admin,dc=example,dc=com:wrong@" + addr, api.StatusFailure, `failed to bind: LDAP Result Code 49 "Invalid Credentials": invalid credentials`, ""},
+		{admin + "/dc=example,dc=com?filter=%28uid%3Dalice%29", api.StatusHealthy, `succeed to search\n---\nresult_count: 1\nsearch_latency: [0-9.]+`, ""},
+		{admin + "/dc=example,dc=com?filter=%28objectClass%3Dperson%29&max=2&min=2", api.StatusHealthy, `succeed to search\n---\nresult_count: 2\nsearch_latency: [0-9.]+`, ""},
+		{admin + "/dc=example,dc=com?scope=one", api.StatusHealthy, `succeed to search\n---\nresult_count: 1\nsearch_latency: [0-9.]+`, ""},
+		{admin + "/dc=example,dc=com?scope=sub", api.StatusHealthy, `succeed to search\n---\nresult_count: 4\nsearch_latency: [0-9.]+`, ""},
+		{admin + "/dc=example,dc=com?filter=%28uid%3Dcharlie%29", api.StatusFailure, `result count 0 is smaller than 1\n---\nresult_count: 0\nsearch_latency: [0-9.]+`, ""},
+		{admin + "/dc=example,dc=com?filter=%28uid%3Dcharlie%29&max=0", api.StatusHealthy, `succeed to search\n---\nresult_count: 0\nsearch_latency: [0-9.]+`, ""},
+		{admin + "/dc=example,dc=com?filter=%28objectClass%3Dperson%29&max=1", api.StatusFailure, `result count 2 is larger than 1\n---\nresult_count: 2\nsearch_latency: [0-9.]+`, ""},
+		{admin + "/dc=example,dc=org?filter=%28uid%3Dalice%29", api.StatusFailure, `failed to search: LDAP Result Code 32 "No Such Object": no such object\n---\nsearch_latency: [0-9.]+`, ""},
+		{"ldap://" + addr + "?filter=uid%3Dalice%29", api.StatusUnknown, "", "invalid LDAP search filter"},
+		{"ldap://" + addr + "?scope=all", api.StatusUnknown, "", "invalid LDAP search scope"},
+		{"ldap://" + addr + "?min=3&max=2", api.StatusUnknown, "", "invalid number of LDAP search results"},
+	}, 5)
+
+	AssertTimeout(t, "ldap://"+addr)
+}
@@ -0,0 +1,534 @@
+package scheme
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrInvalidStartTLS      = errors.New("invalid value for starttls query")
+	ErrStartTLSNotSupported = errors.New("STARTTLS is not supported by the server")
+	ErrAuthNotSupported     = errors.New("authentication is not supported by the server")
+	ErrPlaintextLogin       = errors.New("refused to login without TLS; use smtps, imaps, pop3s, or starttls=true query")
+)
+
+// mailDefaultPorts is the default port numbers of mail protocols.
+var mailDefaultPorts = map[string]string{
+	"smtp":  "25",
+	"smtps": "465",
+	"imap":  "143",
+	"imaps": "993",
+	"pop3":  "110",
+	"pop3s": "995",
+}
+
+// MailProbe is a Prober implementation for SMTP, IMAP and POP3.
+//
+// It reads the greeting and the capabilities of the server.
+// If "starttls=true" is set in query, it upgrades the connection by STARTTLS.
+// And, if username and password are set in URL, it tries to login.
+// The login is allowed only over TLS, to avoid sending the password in plaintext.
+type MailProbe struct {
+	target      *api.URL
+	protocol    string
+	implicitTLS bool
+	startTLS    bool
+}
+
+func NewMailProbe(u *api.URL) (MailProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return MailProbe{}, ErrUnsupportedScheme
+	}
+
+	p := MailProbe{
+		target:      &api.URL{Scheme: scheme, User: u.User, Host: strings.ToLower(u.Host), Fragment: u.Fragment},
+		protocol:    strings.TrimSuffix(scheme, "s"),
+		implicitTLS: strings.HasSuffix(scheme, "s"),
+	}
+	if u.Host == "" {
+		p.target.Host = strings.ToLower(u.Opaque)
+	}
+
+	if p.target.ToURL().Hostname() == "" {
+		return MailProbe{}, ErrMissingHost
+	}
+
+	if s := u.ToURL().Query().Get("starttls"); s != "" && !p.implicitTLS {
+		var err error
+		if p.startTLS, err = strconv.ParseBool(s); err != nil {
+			return MailProbe{}, ErrInvalidStartTLS
+		}
+		if p.startTLS {
+			p.target.RawQuery = "starttls=true"
+		}
+	}
+
+	if p.target.User != nil && !p.implicitTLS && !p.startTLS {
+		return MailProbe{}, ErrPlaintextLogin
+	}
+
+	return p, nil
+}
+
+func (p MailProbe) Target() *api.URL {
+	return p.target
+}
+
+func (p MailProbe) address() string {
+	u := p.target.ToURL()
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), mailDefaultPorts[p.target.Scheme])
+	}
+	return u.Host
+}
+
+func (p MailProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := p.probe(ctx)
+	rec.Time = st
+	rec.Target = p.target
+	rec.Latency = time.Since(st)
+
+	r.Report(p.target, timeoutOr(ctx, rec))
+}
+
+func (p MailProbe) probe(ctx context.Context) api.Record {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", p.address())
+	if err != nil {
+		rec := api.Record{
+			Status:  api.StatusFailure,
+			Message: err.Error(),
+		}
+
+		dnsErr := &net.DNSError{}
+		if errors.As(err, &dnsErr) {
+			rec.Status = api.StatusUnknown
+			rec.Message = dnsErrorToMessage(dnsErr)
+		}
+		return rec
+	}
+
+	sess := &mailSession{
+		conn:       conn,
+		text:       textproto.NewConn(conn),
+		serverName: p.target.ToURL().Hostname(),
+		extra: map[string]interface{}{
+			"source_addr": conn.LocalAddr().String(),
+			"target_addr": conn.RemoteAddr().String(),
+		},
+	}
+	defer sess.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	rec := api.Record{
+		Status:  api.StatusHealthy,
+		Message: "succeed to connect",
+		Extra:   sess.extra,
+	}
+
+	if p.implicitTLS {
+		if err := sess.upgradeTLS(); err != nil {
+			rec.Status = api.StatusFailure
+			rec.Message = err.Error()
+			return rec
+		}
+	}
+
+	var client mailClient
+	switch p.protocol {
+	case "smtp":
+		client = smtpClient{sess}
+	case "imap":
+		client = &imapClient{mailSession: sess}
+	case "pop3":
+		client = pop3Client{sess}
+	}
+
+	if err := client.Handshake(p.startTLS); err != nil {
+		rec.Status = api.StatusFailure
+		rec.Message = err.Error()
+		return rec
+	}
+
+	if p.target.User != nil {
+		password, _ := p.target.User.Password()
+		if err := client.Login(p.target.User.Username(), password); err != nil {
+			rec.Status = api.StatusFailure
+			rec.Message = "failed to login: " + err.Error()
+			return rec
+		}
+		rec.Message = "succeed to login"
+	}
+
+	client.Quit()
+
+	return rec
+}
+
+// mailClient is a client of a mail protocol.
+type mailClient interface {
+	// Handshake reads greeting and capabilities, and upgrades the connection by STARTTLS if startTLS is true.
+	Handshake(startTLS bool) error
+
+	// Login tries to login by username and password.
+	Login(username, password string) error
+
+	// Quit sends quit command. It ignores errors.
+	Quit()
+}
+
+// mailSession is a connection to a mail server.
+type mailSession struct {
+	conn       net.Conn
+	text       *textproto.Conn
+	serverName string
+	extra      map[string]interface{}
+}
+
+// upgradeTLS performs TLS handshake, and replaces the connection.
+func (s *mailSession) upgradeTLS() error {
+	conn := tls.Client(s.conn, newTLSConfig(s.serverName))
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+
+	s.conn = conn
+	s.text = textproto.NewConn(conn)
+	setTLSExtra(s.extra, conn.ConnectionState())
+
+	return nil
+}
+
+func (s *mailSession) Close() error {
+	return s.conn.Close()
+}
+
+// hasCapability checks if the capability list has the name, case-insensitively.
+func hasCapability(caps []string, name string) bool {
+	for _, c := range caps {
+		fs := strings.Fields(c)
+		if len(fs) > 0 && strings.EqualFold(fs[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilityArgs returns arguments of the capability, like ["PLAIN", "LOGIN"] for "AUTH PLAIN LOGIN".
+func capabilityArgs(caps []string, name string) []string {
+	for _, c := range caps {
+		fs := strings.Fields(c)
+		if len(fs) > 0 && strings.EqualFold(fs[0], name) {
+			return fs[1:]
+		}
+	}
+	return nil
+}
+
+type smtpClient struct {
+	*mailSession
+}
+
+func (c smtpClient) cmd(expectCode int, format string, args ...interface{}) (string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+
+	_, msg, err := c.text.ReadResponse(expectCode)
+	return msg, smtpError(err)
+}
+
+// smtpError converts textproto.Error to a readable error, because textproto.Error quotes the message.
+func smtpError(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return fmt.Errorf("%03d %s", tpErr.Code, tpErr.Msg)
+	}
+	return err
+}
+
+func (c smtpClient) ehlo() error {
+	msg, err := c.cmd(250, "EHLO localhost")
+	if err != nil {
+		return err
+	}
+
+	caps := []string{}
+	if lines := strings.Split(msg, "\n"); len(lines) > 1 {
+		caps = lines[1:]
+	}
+	c.extra["capabilities"] = caps
+
+	return nil
+}
+
+func (c smtpClient) Handshake(startTLS bool) error {
+	_, msg, err := c.text.ReadResponse(220)
+	if err != nil {
+		return smtpError(err)
+	}
+	c.extra["greeting"] = strings.Split(msg, "\n")[0]
+
+	if err := c.ehlo(); err != nil {
+		return err
+	}
+
+	if startTLS {
+		if !hasCapability(c.extra["capabilities"].([]string), "STARTTLS") {
+			return ErrStartTLSNotSupported
+		}
+		if _, err := c.cmd(220, "STARTTLS"); err != nil {
+			return err
+		}
+		if err := c.upgradeTLS(); err != nil {
+			return err
+		}
+		return c.ehlo()
+	}
+
+	return nil
+}
+
+func (c smtpClient) Login(username, password string) error {
+	mechs := capabilityArgs(c.extra["capabilities"].([]string), "AUTH")
+
+	for _, m := range mechs {
+		if strings.EqualFold(m, "PLAIN") {
+			_, err := c.cmd(235, "AUTH PLAIN %s", base64.StdEncoding.EncodeToString([]byte("\x00"+username+"\x00"+password)))
+			return err
+		}
+	}
+
+	for _, m := range mechs {
+		if strings.EqualFold(m, "LOGIN") {
+			if _, err := c.cmd(334, "AUTH LOGIN"); err != nil {
+				return err
+			}
+			if _, err := c.cmd(334, "%s", base64.StdEncoding.EncodeToString([]byte(username))); err != nil {
+				return err
+			}
+			_, err := c.cmd(235, "%s", base64.StdEncoding.EncodeToString([]byte(password)))
+			return err
+		}
+	}
+
+	return ErrAuthNotSupported
+}
+
+func (c smtpClient) Quit() {
+	c.cmd(221, "QUIT")
+}
+
+type imapClient struct {
+	*mailSession
+
+	tag int
+}
+
+// cmd sends a tagged command, and returns the untagged responses.
+func (c *imapClient) cmd(format string, args ...interface{}) ([]string, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+
+	if err := c.text.PrintfLine("%s "+format, append([]interface{}{tag}, args...)...); err != nil {
+		return nil, err
+	}
+
+	var untagged []string
+	for {
+		line, err := c.text.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if rest, ok := strings.CutPrefix(line, tag+" "); ok {
+			if !strings.HasPrefix(strings.ToUpper(rest), "OK") {
+				return nil, errors.New(rest)
+			}
+			return untagged, nil
+		}
+		untagged = append(untagged, line)
+	}
+}
+
+func (c *imapClient) capability() error {
+	lines, err := c.cmd("CAPABILITY")
+	if err != nil {
+		return err
+	}
+
+	caps := []string{}
+	for _, l := range lines {
+		if rest, ok := cutPrefixFold(l, "* CAPABILITY "); ok {
+			caps = append(caps, strings.Fields(rest)...)
+		}
+	}
+	c.extra["capabilities"] = caps
+
+	return nil
+}
+
+func (c *imapClient) Handshake(startTLS bool) error {
+	greeting, err := c.text.ReadLine()
+	if err != nil {
+		return err
+	}
+	c.extra["greeting"] = greeting
+
+	if _, ok := cutPrefixFold(greeting, "* OK"); !ok {
+		if _, ok := cutPrefixFold(greeting, "* PREAUTH"); !ok {
+			return fmt.Errorf("unexpected greeting: %s", greeting)
+		}
+	}
+
+	if err := c.capability(); err != nil {
+		return err
+	}
+
+	if startTLS {
+		if !hasCapability(c.extra["capabilities"].([]string), "STARTTLS") {
+			return ErrStartTLSNotSupported
+		}
+		if _, err := c.cmd("STARTTLS"); err != nil {
+			return err
+		}
+		if err := c.upgradeTLS(); err != nil {
+			return err
+		}
+		return c.capability()
+	}
+
+	return nil
+}
+
+// imapQuote quotes a string for IMAP command.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (c *imapClient) Login(username, password string) error {
+	if hasCapability(c.extra["capabilities"].([]string), "LOGINDISABLED") {
+		return ErrAuthNotSupported
+	}
+	_, err := c.cmd("LOGIN %s %s", imapQuote(username), imapQuote(password))
+	return err
+}
+
+func (c *imapClient) Quit() {
+	c.cmd("LOGOUT")
+}
+
+type pop3Client struct {
+	*mailSession
+}
+
+// cmd sends a command, and returns the response line without "+OK".
+func (c pop3Client) cmd(format string, args ...interface{}) (string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return c.readResponse()
+}
+
+func (c pop3Client) readResponse() (string, error) {
+	line, err := c.text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if rest, ok := strings.CutPrefix(line, "+OK"); ok {
+		return strings.TrimSpace(rest), nil
+	}
+	return "", errors.New(line)
+}
+
+func (c pop3Client) capa() error {
+	caps := []string{}
+	c.extra["capabilities"] = caps
+
+	if _, err := c.cmd("CAPA"); err != nil {
+		// CAPA command is optional in POP3.
+		return nil
+	}
+
+	lines, err := c.text.ReadDotLines()
+	if err != nil {
+		return err
+	}
+	c.extra["capabilities"] = append(caps, lines...)
+
+	return nil
+}
+
+func (c pop3Client) Handshake(startTLS bool) error {
+	line, err := c.text.ReadLine()
+	if err != nil {
+		return err
+	}
+	c.extra["greeting"] = line
+
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("unexpected greeting: %s", line)
+	}
+
+	if err := c.capa(); err != nil {
+		return err
+	}
+
+	if startTLS {
+		if !hasCapability(c.extra["capabilities"].([]string), "STLS") {
+			return ErrStartTLSNotSupported
+		}
+		if _, err := c.cmd("STLS"); err != nil {
+			return err
+		}
+		if err := c.upgradeTLS(); err != nil {
+			return err
+		}
+		return c.capa()
+	}
+
+	return nil
+}
+
+func (c pop3Client) Login(username, password string) error {
+	if _, err := c.cmd("USER %s", username); err != nil {
+		return err
+	}
+	_, err := c.cmd("PASS %s", password)
+	return err
+}
+
+func (c pop3Client) Quit() {
+	c.cmd("QUIT")
+}
+
+// cutPrefixFold is a case-insensitive version of strings.CutPrefix.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
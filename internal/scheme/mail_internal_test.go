@@ -0,0 +1,26 @@
+package scheme
+
+import (
+	"testing"
+)
+
+func Test_hasCapability(t *testing.T) {
+	caps := []string{"", "  ", "PIPELINING", "AUTH PLAIN LOGIN"}
+
+	tests := []struct {
+		Name   string
+		Expect bool
+	}{
+		{"PIPELINING", true},
+		{"pipelining", true},
+		{"AUTH", true},
+		{"STARTTLS", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if actual := hasCapability(caps, tt.Name); actual != tt.Expect {
+			t.Errorf("%q: expected %v but got %v", tt.Name, tt.Expect, actual)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package scheme_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/ayd/internal/scheme"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// GenerateTestCertificate generates a self-signed certificate for 127.0.0.1 and localhost.
+func GenerateTestCertificate(t testing.TB, commonName string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Date(2100, 1, 2, 15, 4, 5, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+// mailTestConn is a connection of the stand-in mail server.
+type mailTestConn struct {
+	conn net.Conn
+	text *textproto.Conn
+	cert tls.Certificate
+	tls  bool
+}
+
+func (c *mailTestConn) upgradeTLS() bool {
+	conn := tls.Server(c.conn, &tls.Config{Certificates: []tls.Certificate{c.cert}})
+	if err := conn.Handshake(); err != nil {
+		return false
+	}
+	c.conn = conn
+	c.text = textproto.NewConn(conn)
+	c.tls = true
+	return true
+}
+
+// StartMailServer starts a stand-in server of SMTP, IMAP, or POP3, that accepts user "hoge" with password "fuga".
+// The mode is "plain" for a server that supports STARTTLS, "tls" for implicit TLS, or "no-starttls" for a server that doesn't support STARTTLS.
+func StartMailServer(t testing.TB, protocol, mode string, cert tls.Certificate) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+				c := &mailTestConn{conn: conn, text: textproto.NewConn(conn), cert: cert}
+				if mode == "tls" && !c.upgradeTLS() {
+					return
+				}
+				startTLS := mode == "plain"
+
+				switch protocol {
+				case "smtp":
+					serveSMTP(c, startTLS)
+				case "imap":
+					serveIMAP(c, startTLS)
+				case "pop3":
+					servePOP3(c, startTLS)
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func serveSMTP(c *mailTestConn, startTLS bool) {
+	c.text.PrintfLine("220 mail.example.com ESMTP ready")
+	for {
+		line, err := c.text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			c.text.PrintfLine("250-mail.example.com")
+			c.text.PrintfLine("250-PIPELINING")
+			if startTLS && !c.tls {
+				c.text.PrintfLine("250-STARTTLS")
+			}
+			c.text.PrintfLine("250 AUTH PLAIN LOGIN")
+		case "STARTTLS":
+			c.text.PrintfLine("220 ready to start TLS")
+			if !c.upgradeTLS() {
+				return
+			}
+		case "AUTH":
+			if arg == "PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00hoge\x00fuga")) {
+				c.text.PrintfLine("235 authentication succeeded")
+			} else {
+				c.text.PrintfLine("535 authentication failed")
+			}
+		case "QUIT":
+			c.text.PrintfLine("221 bye")
+			return
+		default:
+			c.text.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+func serveIMAP(c *mailTestConn, startTLS bool) {
+	c.text.PrintfLine("* OK IMAP4rev1 ready")
+	for {
+		line, err := c.text.ReadLine()
+		if err != nil {
+			return
+		}
+		fs := strings.Fields(line)
+		if len(fs) < 2 {
+			c.text.PrintfLine("* BAD invalid command")
+			continue
+		}
+		tag := fs[0]
+
+		switch strings.ToUpper(fs[1]) {
+		case "CAPABILITY":
+			if startTLS && !c.tls {
+				c.text.PrintfLine("* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED")
+			} else {
+				c.text.PrintfLine("* CAPABILITY IMAP4rev1 AUTH=PLAIN")
+			}
+			c.text.PrintfLine("%s OK CAPABILITY completed", tag)
+		case "STARTTLS":
+			c.text.PrintfLine("%s OK begin TLS negotiation", tag)
+			if !c.upgradeTLS() {
+				return
+			}
+		case "LOGIN":
+			if len(fs) == 4 && fs[2] == `"hoge"` && fs[3] == `"fuga"` {
+				c.text.PrintfLine("%s OK LOGIN completed", tag)
+			} else {
+				c.text.PrintfLine("%s NO authentication failed", tag)
+			}
+		case "LOGOUT":
+			c.text.PrintfLine("* BYE logging out")
+			c.text.PrintfLine("%s OK LOGOUT completed", tag)
+			return
+		default:
+			c.text.PrintfLine("%s BAD unknown command", tag)
+		}
+	}
+}
+
+func servePOP3(c *mailTestConn, startTLS bool) {
+	c.text.PrintfLine("+OK POP3 ready")
+	user := ""
+	for {
+		line, err := c.text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(cmd) {
+		case "CAPA":
+			c.text.PrintfLine("+OK capability list follows")
+			c.text.PrintfLine("USER")
+			if startTLS && !c.tls {
+				c.text.PrintfLine("STLS")
+			}
+			c.text.PrintfLine(".")
+		case "STLS":
+			c.text.PrintfLine("+OK begin TLS negotiation")
+			if !c.upgradeTLS() {
+				return
+			}
+		case "USER":
+			user = arg
+			c.text.PrintfLine("+OK")
+		case "PASS":
+			if user == "hoge" && arg == "fuga" {
+				c.text.PrintfLine("+OK logged in")
+			} else {
+				c.text.PrintfLine("-ERR invalid password")
+			}
+		case "QUIT":
+			c.text.PrintfLine("+OK bye")
+			return
+		default:
+			c.text.PrintfLine("-ERR unknown command")
+		}
+	}
+}
+
+func TestMailProbe(t *testing.T) {
+	cert, pool := GenerateTestCertificate(t, "mail.example.com")
+	untrusted, _ := GenerateTestCertificate(t, "untrusted.example.com")
+
+	scheme.SetTLSRootCAs(t, pool)
+
+	certInfo := `certificate_expires: 2100-01-02T15:04:05Z\ncertificate_issuer: CN=mail.example.com\ncertificate_subject: CN=mail.example.com\n`
+	addrInfo := func(addr string) string {
+		return `source_addr: 127.0.0.1:[0-9]+\ntarget_addr: ` + addr
+	}
+
+	for _, proto := range []string{"smtp", "imap", "pop3"} {
+		plain := StartMailServer(t, proto, "plain", cert)
+		implicit := StartMailServer(t, proto, "tls", cert)
+		noStartTLS := StartMailServer(t, proto, "no-starttls", cert)
+		untrustedTLS := StartMailServer(t, proto, "tls", untrusted)
+
+		greeting := map[string]string{
+			"smtp": "mail.example.com ESMTP ready",
+			"imap": `\* OK IMAP4rev1 ready`,
+			"pop3": `\+OK POP3 ready`,
+		}[proto]
+		plainCaps := map[string]string{
+			"smtp": `\["PIPELINING","STARTTLS","AUTH PLAIN LOGIN"\]`,
+			"imap": `\["IMAP4rev1","STARTTLS","LOGINDISABLED"\]`,
+			"pop3": `\["USER","STLS"\]`,
+		}[proto]
+		tlsCaps := map[string]string{
+			"smtp": `\["PIPELINING","AUTH PLAIN LOGIN"\]`,
+			"imap": `\["IMAP4rev1","AUTH=PLAIN"\]`,
+			"pop3": `\["USER"\]`,
+		}[proto]
+		loginError := map[string]string{
+			"smtp": "535 authentication failed",
+			"imap": "NO authentication failed",
+			"pop3": `-ERR invalid password`,
+		}[proto]
+
+		t.Run(proto, func(t *testing.T) {
+			AssertProbe(t, []ProbeTest{
+				{proto + "://" + plain, api.StatusHealthy, `succeed to connect\n---\ncapabilities: ` + plainCaps + `\ngreeting: ` + greeting + `\n` + addrInfo(plain), ""},
+				{proto + "://" + plain + "?starttls=true", api.StatusHealthy, `succeed to connect\n---\ncapabilities: ` + tlsCaps + `\n` + certInfo + `greeting: ` + greeting + `\n` + addrInfo(plain) + `\ntls_version: TLS 1.3`, ""},
+				{proto + "://hoge:fuga@" + plain + "?starttls=true", api.StatusHealthy, `succeed to login\n---\n(.|\n)+`, ""},
+				{proto + "://hoge:foo@" + plain + "?starttls=true", api.StatusFailure, `failed to login: ` + loginError + `\n---\n(.|\n)+`, ""},
+				{proto + "s://hoge:fuga@" + implicit, api.StatusHealthy, `succeed to login\n---\ncapabilities: ` + tlsCaps + `\n` + certInfo + `greeting: ` + greeting + `\n` + addrInfo(implicit) + `\ntls_version: TLS 1.3`, ""},
+				{proto + "://" + noStartTLS + "?starttls=true", api.StatusFailure, `STARTTLS is not supported by the server\n---\n(.|\n)+`, ""},
+				{proto + "s://" + untrustedTLS, api.StatusFailure, `tls: failed to verify certificate: x509: .+\n---\n` + addrInfo(untrustedTLS), ""},
+				{proto + "://" + plain + "?starttls=maybe", api.StatusUnknown, "", "invalid value for starttls query"},
+				{proto + "://hoge:fuga@" + plain, api.StatusUnknown, "", "refused to login without TLS; use smtps, imaps, pop3s, or starttls=true query"},
+				{proto + "://hoge:fuga@" + plain + "?starttls=false", api.StatusUnknown, "", "refused to login without TLS; use smtps, imaps, pop3s, or starttls=true query"},
+			}, 5)
+		})
+	}
+}
@@ -0,0 +1,566 @@
+package scheme
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrInvalidMQTTQoS       = errors.New("invalid QoS, it must be 0 or 1")
+	ErrInvalidMQTTWait      = errors.New("invalid duration for wait query")
+	ErrInvalidMQTTRetain    = errors.New("invalid value for retain query")
+	ErrMissingMQTTTopic     = errors.New("missing topic to publish")
+	ErrMQTTWildcardTopic    = errors.New("cannot publish to a topic with wildcard")
+	ErrMQTTSubscribeRefused = errors.New("subscription refused by the broker")
+)
+
+// The packet types of MQTT.
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttSubscribe  = 8
+	mqttSubAck     = 9
+	mqttPingResp   = 13
+	mqttDisconnect = 14
+)
+
+const (
+	// maxMQTTPacket is the maximum size of a packet that MQTTScheme receives.
+	maxMQTTPacket = 1024 * 1024
+
+	// mqttPacketID is the packet identifier for SUBSCRIBE and PUBLISH.
+	// It is always the same because MQTTScheme sends only one packet that needs identifier in a connection.
+	mqttPacketID = 1
+)
+
+// mqttConnAckErrors is the messages for the return codes in CONNACK packet.
+var mqttConnAckErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// MQTTScheme is a Prober and Alerter implementation for the MQTT.
+//
+// As a Prober, it connects to the broker, and subscribes the topic in the path if set.
+// If "wait" query is set, it waits for a new message in the topic, like "mqtt://example.com/sensors/+/temperature?wait=1m".
+//
+// As an Alerter, it publishes the record in JSON to the topic in the path.
+type MQTTScheme struct {
+	target *api.URL
+	topic  string
+	qos    byte
+	retain bool
+	wait   time.Duration
+}
+
+func NewMQTTScheme(u *api.URL) (MQTTScheme, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return MQTTScheme{}, ErrUnsupportedScheme
+	}
+
+	s := MQTTScheme{
+		target: &api.URL{Scheme: scheme, User: u.User, Host: strings.ToLower(u.Host), Fragment: u.Fragment},
+		topic:  strings.TrimPrefix(u.Path, "/"),
+	}
+	if s.target.ToURL().Hostname() == "" {
+		return MQTTScheme{}, ErrMissingHost
+	}
+	if s.topic != "" {
+		s.target.Path = "/" + s.topic
+	}
+
+	query := u.ToURL().Query()
+	q := url.Values{}
+
+	if v := query.Get("qos"); v != "" {
+		switch v {
+		case "0":
+		case "1":
+			s.qos = 1
+			q.Set("qos", "1")
+		default:
+			return MQTTScheme{}, ErrInvalidMQTTQoS
+		}
+	}
+
+	if v := query.Get("retain"); v != "" {
+		var err error
+		if s.retain, err = strconv.ParseBool(v); err != nil {
+			return MQTTScheme{}, ErrInvalidMQTTRetain
+		}
+		if s.retain {
+			q.Set("retain", "true")
+		}
+	}
+
+	if v := query.Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return MQTTScheme{}, ErrInvalidMQTTWait
+		}
+		s.wait = d
+		q.Set("wait", d.String())
+	}
+
+	s.target.RawQuery = q.Encode()
+
+	return s, nil
+}
+
+// NewMQTTAlert makes a MQTTScheme for alerting.
+// It is the same as NewMQTTScheme, but it requires a topic without wildcard.
+func NewMQTTAlert(u *api.URL) (MQTTScheme, error) {
+	s, err := NewMQTTScheme(u)
+	if err != nil {
+		return MQTTScheme{}, err
+	}
+	if s.topic == "" {
+		return MQTTScheme{}, ErrMissingMQTTTopic
+	}
+	if strings.ContainsAny(s.topic, "+#") {
+		return MQTTScheme{}, ErrMQTTWildcardTopic
+	}
+	return s, nil
+}
+
+func (s MQTTScheme) Target() *api.URL {
+	return s.target
+}
+
+func (s MQTTScheme) address() string {
+	u := s.target.ToURL()
+	if u.Port() != "" {
+		return u.Host
+	}
+	if s.target.Scheme == "mqtts" {
+		return net.JoinHostPort(u.Hostname(), "8883")
+	}
+	return net.JoinHostPort(u.Hostname(), "1883")
+}
+
+// connect connects to the broker, and returns the connection.
+// The returned record is for reporting an error if the connection is nil.
+func (s MQTTScheme) connect(ctx context.Context) (*mqttConn, api.Record) {
+	var conn net.Conn
+	var err error
+	if s.target.Scheme == "mqtts" {
+		dialer := tls.Dialer{
+			Config: newTLSConfig(s.target.ToURL().Hostname()),
+		}
+		conn, err = dialer.DialContext(ctx, "tcp", s.address())
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", s.address())
+	}
+	if err != nil {
+		rec := api.Record{
+			Status:  api.StatusFailure,
+			Message: err.Error(),
+		}
+
+		dnsErr := &net.DNSError{}
+		if errors.As(err, &dnsErr) {
+			rec.Status = api.StatusUnknown
+			rec.Message = dnsErrorToMessage(dnsErr)
+		}
+		return nil, rec
+	}
+
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+	c.stop = context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	var username, password string
+	if s.target.User != nil {
+		username = s.target.User.Username()
+		password, _ = s.target.User.Password()
+	}
+	if err := c.Connect(username, password); err != nil {
+		c.Close()
+		return nil, api.Record{
+			Status:  api.StatusFailure,
+			Message: "failed to connect: " + err.Error(),
+		}
+	}
+
+	return c, api.Record{}
+}
+
+func (s MQTTScheme) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second+s.wait)
+	defer cancel()
+
+	st := time.Now()
+	rec := s.probe(ctx)
+	rec.Time = st
+	rec.Target = s.target
+	rec.Latency = time.Since(st)
+
+	r.Report(s.target, timeoutOr(ctx, rec))
+}
+
+func (s MQTTScheme) probe(ctx context.Context) api.Record {
+	c, rec := s.connect(ctx)
+	if c == nil {
+		return rec
+	}
+	defer c.Close()
+
+	extra := map[string]interface{}{}
+	if tc, ok := c.conn.(*tls.Conn); ok {
+		setTLSExtra(extra, tc.ConnectionState())
+	}
+
+	if s.topic == "" {
+		return api.Record{
+			Status:  api.StatusHealthy,
+			Message: "succeed to connect",
+			Extra:   extra,
+		}
+	}
+
+	if err := c.Subscribe(s.topic, s.qos); err != nil {
+		return api.Record{
+			Status:  api.StatusFailure,
+			Message: "failed to subscribe: " + err.Error(),
+			Extra:   extra,
+		}
+	}
+
+	if s.wait == 0 {
+		return api.Record{
+			Status:  api.StatusHealthy,
+			Message: "succeed to subscribe",
+			Extra:   extra,
+		}
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(s.wait))
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+				err = fmt.Errorf("no new message in %s", s.wait)
+			}
+			return api.Record{
+				Status:  api.StatusFailure,
+				Message: err.Error(),
+				Extra:   extra,
+			}
+		}
+
+		// Retained messages are not fresh, so wait for the next one.
+		if msg.Retain {
+			continue
+		}
+
+		extra["topic"] = msg.Topic
+		extra["payload"] = formatPayload(msg.Payload)
+		return api.Record{
+			Status:  api.StatusHealthy,
+			Message: "received a new message",
+			Extra:   extra,
+		}
+	}
+}
+
+func (s MQTTScheme) Alert(ctx context.Context, r Reporter, lastRecord api.Record) {
+	r = AlertReporter{s.target, r}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := s.alert(ctx, lastRecord)
+	rec.Time = st
+	rec.Target = s.target
+	rec.Latency = time.Since(st)
+
+	r.Report(s.target, timeoutOr(ctx, rec))
+}
+
+func (s MQTTScheme) alert(ctx context.Context, lastRecord api.Record) api.Record {
+	c, rec := s.connect(ctx)
+	if c == nil {
+		return rec
+	}
+	defer c.Close()
+
+	payload := []byte(lastRecord.String())
+
+	if err := c.Publish(s.topic, payload, s.qos, s.retain); err != nil {
+		return api.Record{
+			Status:  api.StatusFailure,
+			Message: "failed to publish: " + err.Error(),
+		}
+	}
+
+	return api.Record{
+		Status:  api.StatusHealthy,
+		Message: fmt.Sprintf("published %d bytes to the topic", len(payload)),
+	}
+}
+
+// mqttMessage is a message that received from the broker.
+type mqttMessage struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// mqttConn is a client side connection of MQTT v3.1.1.
+type mqttConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	stop func() bool
+}
+
+// Close sends DISCONNECT packet, and closes the connection.
+func (c *mqttConn) Close() error {
+	c.stop()
+	c.writePacket(mqttDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+func (c *mqttConn) writePacket(header byte, body []byte) error {
+	buf := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := c.conn.Write(append(buf, body...))
+	return err
+}
+
+func (c *mqttConn) readPacket() (header byte, body []byte, err error) {
+	if header, err = c.r.ReadByte(); err != nil {
+		return
+	}
+
+	size := 0
+	for i := 0; ; i++ {
+		var b byte
+		if b, err = c.r.ReadByte(); err != nil {
+			return
+		}
+		size |= int(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+		if i >= 3 {
+			err = errors.New("malformed packet")
+			return
+		}
+	}
+	if size > maxMQTTPacket {
+		err = errors.New("too large packet")
+		return
+	}
+
+	body = make([]byte, size)
+	_, err = io.ReadFull(c.r, body)
+	return
+}
+
+// expectPacket reads a packet, and checks the type of it.
+// PINGRESP packets are ignored.
+func (c *mqttConn) expectPacket(typ byte) ([]byte, error) {
+	for {
+		header, body, err := c.readPacket()
+		if err != nil {
+			return nil, err
+		}
+		switch header >> 4 {
+		case typ:
+			return body, nil
+		case mqttPingResp:
+			continue
+		case mqttPublish:
+			// Messages may arrive before SUBACK, but they are ignored because they might be retained messages.
+			if err := c.ackPublish(header, body); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			return nil, fmt.Errorf("unexpected packet type: %d", header>>4)
+		}
+	}
+}
+
+func appendMQTTString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+func (c *mqttConn) Connect(username, password string) error {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+
+	flags := byte(0x02) // clean session
+	if username != "" {
+		flags |= 0x80
+		if password != "" {
+			flags |= 0x40
+		}
+	}
+
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags, 0, 0) // protocol level 4 (v3.1.1), flags, and keep alive 0 (disabled)
+	body = appendMQTTString(body, "ayd-"+hex.EncodeToString(id[:]))
+	if username != "" {
+		body = appendMQTTString(body, username)
+		if password != "" {
+			body = appendMQTTString(body, password)
+		}
+	}
+
+	if err := c.writePacket(mqttConnect<<4, body); err != nil {
+		return err
+	}
+
+	resp, err := c.expectPacket(mqttConnAck)
+	if err != nil {
+		return err
+	}
+	if len(resp) < 2 {
+		return errors.New("malformed CONNACK packet")
+	}
+	if resp[1] != 0 {
+		if msg, ok := mqttConnAckErrors[resp[1]]; ok {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("refused with code %d", resp[1])
+	}
+	return nil
+}
+
+func (c *mqttConn) Subscribe(topic string, qos byte) error {
+	body := binary.BigEndian.AppendUint16(nil, mqttPacketID)
+	body = appendMQTTString(body, topic)
+	body = append(body, qos)
+
+	if err := c.writePacket(mqttSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+
+	resp, err := c.expectPacket(mqttSubAck)
+	if err != nil {
+		return err
+	}
+	if len(resp) < 3 {
+		return errors.New("malformed SUBACK packet")
+	}
+	if resp[2]&0x80 != 0 {
+		return ErrMQTTSubscribeRefused
+	}
+	return nil
+}
+
+func (c *mqttConn) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	header := byte(mqttPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+
+	body := appendMQTTString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, mqttPacketID)
+	}
+	body = append(body, payload...)
+
+	if err := c.writePacket(header, body); err != nil {
+		return err
+	}
+
+	if qos > 0 {
+		if _, err := c.expectPacket(mqttPubAck); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ackPublish sends PUBACK for the PUBLISH packet if it is QoS 1.
+func (c *mqttConn) ackPublish(header byte, body []byte) error {
+	if (header>>1)&0x03 == 0 {
+		return nil
+	}
+	if len(body) < 2 {
+		return errors.New("malformed PUBLISH packet")
+	}
+	topicLen := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+topicLen+2 {
+		return errors.New("malformed PUBLISH packet")
+	}
+	return c.writePacket(mqttPubAck<<4, body[2+topicLen:2+topicLen+2])
+}
+
+// ReadMessage waits for a PUBLISH packet from the broker.
+func (c *mqttConn) ReadMessage() (mqttMessage, error) {
+	for {
+		header, body, err := c.readPacket()
+		if err != nil {
+			return mqttMessage{}, err
+		}
+		if header>>4 == mqttPingResp {
+			continue
+		}
+		if header>>4 != mqttPublish {
+			return mqttMessage{}, fmt.Errorf("unexpected packet type: %d", header>>4)
+		}
+
+		if err := c.ackPublish(header, body); err != nil {
+			return mqttMessage{}, err
+		}
+
+		if len(body) < 2 {
+			return mqttMessage{}, errors.New("malformed PUBLISH packet")
+		}
+		topicLen := int(binary.BigEndian.Uint16(body))
+		offset := 2 + topicLen
+		if (header>>1)&0x03 > 0 {
+			offset += 2
+		}
+		if len(body) < offset {
+			return mqttMessage{}, errors.New("malformed PUBLISH packet")
+		}
+
+		return mqttMessage{
+			Topic:   string(body[2 : 2+topicLen]),
+			Payload: body[offset:],
+			Retain:  header&0x01 != 0,
+		}, nil
+	}
+}
@@ -0,0 +1,254 @@
+package scheme_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/macrat/ayd/internal/scheme"
+	"github.com/macrat/ayd/internal/testutil"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// MQTTMessage is a message that published to the stand-in MQTT broker.
+type MQTTMessage struct {
+	Topic   string
+	Payload string
+	QoS     byte
+	Retain  bool
+}
+
+// StartMQTTBroker starts a stand-in MQTT broker.
+//
+// It accepts anonymous clients and a user "hoge" with password "fuga".
+// Subscribing "forbidden" is refused.
+// Subscribers of "sensors/retained" receive a retained message, and subscribers of "sensors/live" receive a retained message and a new message.
+// The messages that published by clients are sent to the returned channel.
+func StartMQTTBroker(t testing.TB) (string, <-chan MQTTMessage) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	published := make(chan MQTTMessage, 10)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				serveMQTT(conn, published)
+			}()
+		}
+	}()
+
+	return l.Addr().String(), published
+}
+
+func writeMQTTPacket(w io.Writer, header byte, body []byte) {
+	buf := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	w.Write(append(buf, body...))
+}
+
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	size := 0
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size |= int(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, size)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+// readMQTTString reads a length-prefixed string, and returns the string and the rest.
+func readMQTTString(b []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func writeMQTTPublish(w io.Writer, topic, payload string, retain bool) {
+	header := byte(3 << 4)
+	if retain {
+		header |= 0x01
+	}
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(topic)))
+	body = append(body, topic...)
+	writeMQTTPacket(w, header, append(body, payload...))
+}
+
+func serveMQTT(conn net.Conn, published chan<- MQTTMessage) {
+	r := bufio.NewReader(conn)
+
+	for {
+		header, body, err := readMQTTPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			_, rest := readMQTTString(body) // protocol name
+			flags := rest[1]
+			_, rest = readMQTTString(rest[4:]) // client ID
+			var username, password string
+			if flags&0x80 != 0 {
+				username, rest = readMQTTString(rest)
+			}
+			if flags&0x40 != 0 {
+				password, _ = readMQTTString(rest)
+			}
+
+			code := byte(0)
+			if username != "" && (username != "hoge" || password != "fuga") {
+				code = 4
+			}
+			writeMQTTPacket(conn, 2<<4, []byte{0, code})
+			if code != 0 {
+				return
+			}
+		case 3: // PUBLISH
+			qos := (header >> 1) & 0x03
+			topic, rest := readMQTTString(body)
+			if qos > 0 {
+				writeMQTTPacket(conn, 4<<4, rest[:2])
+				rest = rest[2:]
+			}
+			published <- MQTTMessage{Topic: topic, Payload: string(rest), QoS: qos, Retain: header&0x01 != 0}
+		case 8: // SUBSCRIBE
+			id := body[:2]
+			topic, rest := readMQTTString(body[2:])
+			granted := rest[0]
+			if topic == "forbidden" {
+				granted = 0x80
+			}
+			writeMQTTPacket(conn, 9<<4, append(id, granted))
+
+			switch topic {
+			case "sensors/retained":
+				writeMQTTPublish(conn, topic, "old", true)
+			case "sensors/live":
+				writeMQTTPublish(conn, topic, "old", true)
+				time.Sleep(50 * time.Millisecond)
+				writeMQTTPublish(conn, topic, "23.5", false)
+			}
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func TestMQTTScheme_Probe(t *testing.T) {
+	t.Parallel()
+
+	addr, _ := StartMQTTBroker(t)
+
+	AssertProbe(t, []ProbeTest{
+		{"mqtt://" + addr, api.StatusHealthy, `succeed to connect`, ""},
+		{"mqtt://hoge:fuga@" + addr, api.StatusHealthy, `succeed to connect`, ""},
+		{"mqtt://hoge:wrong@" + addr, api.StatusFailure, `failed to connect: bad user name or password`, ""},
+		{"mqtt://" + addr + "/sensors/temp", api.StatusHealthy, `succeed to subscribe`, ""},
+		{"mqtt://" + addr + "/forbidden", api.StatusFailure, `failed to subscribe: subscription refused by the broker`, ""},
+		{"mqtt://" + addr + "/sensors/live?wait=1s", api.StatusHealthy, `received a new message\n---\npayload: 23.5\ntopic: sensors/live`, ""},
+		{"mqtt://" + addr + "/sensors/retained?wait=200ms", api.StatusFailure, `no new message in 200ms`, ""},
+		{"mqtt://" + addr + "/sensors/live?qos=2", api.StatusUnknown, "", "invalid QoS, it must be 0 or 1"},
+	}, 5)
+
+	AssertTimeout(t, "mqtt://"+addr+"/sensors/retained?wait=1s")
+}
+
+func TestMQTTScheme_Alert(t *testing.T) {
+	t.Parallel()
+
+	addr, published := StartMQTTBroker(t)
+
+	tests := []struct {
+		Target string
+		QoS    byte
+		Retain bool
+	}{
+		{"mqtt://" + addr + "/ayd/alert", 0, false},
+		{"mqtt://hoge:fuga@" + addr + "/ayd/alert?qos=1&retain=true", 1, true},
+	}
+
+	for _, tt := range tests {
+		a, err := scheme.NewAlerter(tt.Target)
+		if err != nil {
+			t.Fatalf("failed to prepare MQTTScheme: %s", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		rec := api.Record{
+			Time:    time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC),
+			Status:  api.StatusFailure,
+			Latency: 123456 * time.Microsecond,
+			Target:  &api.URL{Scheme: "dummy", Fragment: "hello"},
+			Message: "hello world",
+		}
+		expected := `{"time":"2021-01-02T15:04:05Z", "status":"FAILURE", "latency":123.456, "target":"dummy:#hello", "message":"hello world"}`
+
+		r := &testutil.DummyReporter{}
+		a.Alert(ctx, r, rec)
+
+		if len(r.Records) != 1 {
+			t.Fatalf("%s: unexpected number of records: %v", tt.Target, r.Records)
+		}
+		if r.Records[0].Status != api.StatusHealthy {
+			t.Errorf("%s: unexpected status: %s: %s", tt.Target, r.Records[0].Status, r.Records[0].Message)
+		}
+		if r.Records[0].Message != fmt.Sprintf("published %d bytes to the topic", len(expected)) {
+			t.Errorf("%s: unexpected message: %s", tt.Target, r.Records[0].Message)
+		}
+		if r.Records[0].Target.Scheme != "alert" {
+			t.Errorf("%s: unexpected target: %s", tt.Target, r.Records[0].Target)
+		}
+
+		select {
+		case msg := <-published:
+			want := MQTTMessage{Topic: "ayd/alert", Payload: expected, QoS: tt.QoS, Retain: tt.Retain}
+			if msg != want {
+				t.Errorf("%s: unexpected message\nwant: %#v\n got: %#v", tt.Target, want, msg)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: no message published", tt.Target)
+		}
+	}
+}
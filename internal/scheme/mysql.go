@@ -0,0 +1,162 @@
+package scheme
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrInvalidMySQLURL = errors.New("invalid MySQL URL")
+)
+
+// MySQLProbe is a Prober implementation for MySQL and MariaDB.
+//
+// It connects to the server, and executes "SELECT 1" or the query in the "query" query.
+// The status will be DEGRADE if the server is read-only.
+type MySQLProbe struct {
+	target *api.URL
+	config *mysql.Config
+	query  string
+}
+
+func NewMySQLProbe(u *api.URL) (MySQLProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return MySQLProbe{}, ErrUnsupportedScheme
+	}
+
+	p := MySQLProbe{
+		target: &api.URL{Scheme: scheme, User: u.User, Host: strings.ToLower(u.Host), Path: u.Path, Fragment: u.Fragment},
+		query:  "SELECT 1",
+	}
+	if p.target.ToURL().Hostname() == "" {
+		return MySQLProbe{}, ErrMissingHost
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = p.target.Host
+	if p.target.ToURL().Port() == "" {
+		cfg.Addr = net.JoinHostPort(p.target.ToURL().Hostname(), "3306")
+	}
+	cfg.DBName = strings.TrimPrefix(u.Path, "/")
+	if u.User != nil {
+		cfg.User = u.User.Username()
+		cfg.Passwd, _ = u.User.Password()
+	}
+	cfg.Logger = log.New(io.Discard, "", 0)
+
+	query := u.ToURL().Query()
+	q := url.Values{}
+	if s := query.Get("query"); s != "" {
+		p.query = s
+		q.Set("query", s)
+	}
+	switch s := query.Get("tls"); s {
+	case "":
+	case "true":
+		cfg.TLS = newTLSConfig(p.target.ToURL().Hostname())
+		q.Set("tls", s)
+	case "false", "skip-verify", "preferred":
+		cfg.TLSConfig = s
+		q.Set("tls", s)
+	default:
+		return MySQLProbe{}, ErrInvalidMySQLURL
+	}
+	p.target.RawQuery = q.Encode()
+
+	if _, err := mysql.NewConnector(cfg); err != nil {
+		return MySQLProbe{}, ErrInvalidMySQLURL
+	}
+	p.config = cfg
+
+	return p, nil
+}
+
+func (p MySQLProbe) Target() *api.URL {
+	return p.target
+}
+
+func (p MySQLProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := p.probe(ctx)
+	rec.Time = st
+	rec.Target = p.target
+	rec.Latency = time.Since(st)
+
+	r.Report(p.target, timeoutOr(ctx, rec))
+}
+
+func (p MySQLProbe) probe(ctx context.Context) api.Record {
+	connector, err := mysql.NewConnector(p.config)
+	if err != nil {
+		return api.Record{
+			Status:  api.StatusUnknown,
+			Message: err.Error(),
+		}
+	}
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return dbConnectErrorRecord(err)
+	}
+	defer conn.Close()
+
+	extra := map[string]interface{}{}
+
+	var version string
+	if err := conn.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err == nil {
+		extra["server_version"] = version
+	}
+
+	st := time.Now()
+	rows, err := conn.QueryContext(ctx, p.query)
+	if err == nil {
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		err = rows.Err()
+		rows.Close()
+		extra["rows"] = n
+	}
+	extra["query_latency"] = milliseconds(time.Since(st))
+	if err != nil {
+		delete(extra, "rows")
+		return api.Record{
+			Status:  api.StatusFailure,
+			Message: "failed to execute query: " + err.Error(),
+			Extra:   extra,
+		}
+	}
+
+	rec := api.Record{
+		Status:  api.StatusHealthy,
+		Message: "succeed to execute query",
+		Extra:   extra,
+	}
+
+	var readOnly int
+	if err := conn.QueryRowContext(ctx, "SELECT @@global.read_only").Scan(&readOnly); err == nil && readOnly != 0 {
+		rec.Status = api.StatusDegrade
+		rec.Message = "succeed to execute query, but the server is read-only"
+	}
+
+	return rec
+}
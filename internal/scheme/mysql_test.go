@@ -0,0 +1,205 @@
+package scheme_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// mysqlTestConn is a connection of the stand-in MySQL server.
+type mysqlTestConn struct {
+	conn net.Conn
+	seq  byte
+}
+
+func (c *mysqlTestConn) readPacket() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.conn, header[:]); err != nil {
+		return nil, err
+	}
+	size := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	c.seq = header[3] + 1
+
+	payload := make([]byte, size)
+	_, err := io.ReadFull(c.conn, payload)
+	return payload, err
+}
+
+func (c *mysqlTestConn) writePacket(payload []byte) {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), c.seq}
+	c.seq++
+	c.conn.Write(append(header, payload...))
+}
+
+func (c *mysqlTestConn) writeOK() {
+	c.writePacket([]byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})
+}
+
+func (c *mysqlTestConn) writeError(code uint16, state, message string) {
+	p := []byte{0xff, byte(code), byte(code >> 8), '#'}
+	p = append(p, state...)
+	c.writePacket(append(p, message...))
+}
+
+func (c *mysqlTestConn) writeEOF() {
+	c.writePacket([]byte{0xfe, 0x00, 0x00, 0x02, 0x00})
+}
+
+func mysqlLenEncString(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func (c *mysqlTestConn) writeResult(values ...string) {
+	c.writePacket([]byte{0x01})
+
+	var col []byte
+	for _, s := range []string{"def", "", "", "", "x", ""} {
+		col = append(col, mysqlLenEncString(s)...)
+	}
+	col = append(col, 0x0c, 0x21, 0x00, 0xff, 0x00, 0x00, 0x00, 0xfd, 0x00, 0x00, 0x00, 0x00, 0x00)
+	c.writePacket(col)
+	c.writeEOF()
+
+	for _, v := range values {
+		c.writePacket(mysqlLenEncString(v))
+	}
+	c.writeEOF()
+}
+
+// mysqlNativePassword computes the response of mysql_native_password authentication.
+func mysqlNativePassword(salt []byte, password string) []byte {
+	h1 := sha1.Sum([]byte(password))
+	h2 := sha1.Sum(h1[:])
+	h3 := sha1.Sum(append(append([]byte{}, salt...), h2[:]...))
+	for i := range h3 {
+		h3[i] ^= h1[i]
+	}
+	return h3[:]
+}
+
+// StartMySQLServer starts a stand-in MySQL server that accepts user "hoge" with password "fuga".
+// If readOnly is true, the server behaves as a read-only server.
+func StartMySQLServer(t testing.TB, readOnly bool) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				serveMySQL(&mysqlTestConn{conn: conn}, readOnly)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func serveMySQL(c *mysqlTestConn, readOnly bool) {
+	salt := []byte("abcdefghijklmnopqrst")
+	var capabilities uint32 = 0x00000001 | 0x00000008 | 0x00000200 | 0x00008000 | 0x00080000 | 0x00200000
+
+	var hs []byte
+	hs = append(hs, 0x0a)
+	hs = append(hs, "8.0.36\x00"...)
+	hs = append(hs, 0x01, 0x00, 0x00, 0x00)
+	hs = append(hs, salt[:8]...)
+	hs = append(hs, 0x00)
+	hs = append(hs, byte(capabilities), byte(capabilities>>8))
+	hs = append(hs, 0x21, 0x02, 0x00)
+	hs = append(hs, byte(capabilities>>16), byte(capabilities>>24))
+	hs = append(hs, 21)
+	hs = append(hs, make([]byte, 10)...)
+	hs = append(hs, salt[8:]...)
+	hs = append(hs, 0x00)
+	hs = append(hs, "mysql_native_password\x00"...)
+	c.writePacket(hs)
+
+	resp, err := c.readPacket()
+	if err != nil || len(resp) < 32 {
+		return
+	}
+	clientCaps := binary.LittleEndian.Uint32(resp)
+	rest := resp[32:]
+	user, rest, _ := bytes.Cut(rest, []byte{0})
+	var auth []byte
+	if clientCaps&0x00200000 != 0 || clientCaps&0x00008000 != 0 {
+		n := int(rest[0])
+		auth = rest[1 : 1+n]
+	}
+
+	if string(user) != "hoge" || !bytes.Equal(auth, mysqlNativePassword(salt, "fuga")) {
+		c.writeError(1045, "28000", "Access denied for user '"+string(user)+"'")
+		return
+	}
+	c.writeOK()
+
+	for {
+		cmd, err := c.readPacket()
+		if err != nil || len(cmd) == 0 {
+			return
+		}
+
+		switch cmd[0] {
+		case 0x01: // COM_QUIT
+			return
+		case 0x0e: // COM_PING
+			c.writeOK()
+		case 0x03: // COM_QUERY
+			switch string(cmd[1:]) {
+			case "SELECT VERSION()":
+				c.writeResult("8.0.36")
+			case "SELECT 1":
+				c.writeResult("1")
+			case "SELECT @@global.read_only":
+				if readOnly {
+					c.writeResult("1")
+				} else {
+					c.writeResult("0")
+				}
+			case "SELECT name FROM items":
+				c.writeResult("foo", "bar", "baz")
+			default:
+				c.writeError(1064, "42000", "You have an error in your SQL syntax")
+			}
+		default:
+			c.writeError(1047, "08S01", "Unknown command")
+		}
+	}
+}
+
+func TestMySQLProbe(t *testing.T) {
+	t.Parallel()
+
+	primary := StartMySQLServer(t, false)
+	readOnly := StartMySQLServer(t, true)
+
+	AssertProbe(t, []ProbeTest{
+		{"mysql://hoge:fuga@" + primary + "/db", api.StatusHealthy, `succeed to execute query\n---\nquery_latency: [0-9.]+\nrows: 1\nserver_version: 8.0.36`, ""},
+		{"mysql://hoge:fuga@" + primary + "/db?query=SELECT+name+FROM+items", api.StatusHealthy, `succeed to execute query\n---\nquery_latency: [0-9.]+\nrows: 3\nserver_version: 8.0.36`, ""},
+		{"mysql://hoge:fuga@" + primary + "/db?query=SELEC+1", api.StatusFailure, `failed to execute query: Error 1064 \(42000\): You have an error in your SQL syntax\n---\nquery_latency: [0-9.]+\nserver_version: 8.0.36`, ""},
+		{"mysql://hoge:fuga@" + readOnly + "/db", api.StatusDegrade, `succeed to execute query, but the server is read-only\n---\nquery_latency: [0-9.]+\nrows: 1\nserver_version: 8.0.36`, ""},
+		{"mysql://hoge:foo@" + primary + "/db", api.StatusFailure, `Error 1045 \(28000\): Access denied for user 'hoge'`, ""},
+		{"mysql://hoge:fuga@" + primary + "/db?tls=foobar", api.StatusUnknown, ``, "invalid MySQL URL"},
+	}, 5)
+
+	AssertTimeout(t, "mysql://hoge:fuga@"+primary+"/db")
+}
@@ -0,0 +1,227 @@
+package scheme
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrInvalidNTPThreshold = errors.New("invalid threshold of clock offset")
+)
+
+const (
+	// ntpEpochOffset is the seconds between the NTP epoch (1900-01-01) and the Unix epoch (1970-01-01).
+	ntpEpochOffset = 2208988800
+
+	defaultNTPDegrade = time.Second
+	defaultNTPFailure = 10 * time.Second
+)
+
+// NTPProbe is a Prober implementation for the NTP.
+//
+// It queries the time to the server, and checks the offset of the clock of this machine.
+// The thresholds of the offset can be set by "degrade" and "failure" query, like "ntp://ntp.example.com?degrade=100ms&failure=1s".
+type NTPProbe struct {
+	target  *api.URL
+	degrade time.Duration
+	failure time.Duration
+}
+
+func NewNTPProbe(u *api.URL) (NTPProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return NTPProbe{}, ErrUnsupportedScheme
+	}
+
+	p := NTPProbe{
+		target:  &api.URL{Scheme: scheme, Host: strings.ToLower(u.Host), Fragment: u.Fragment},
+		degrade: defaultNTPDegrade,
+		failure: defaultNTPFailure,
+	}
+	if u.Host == "" {
+		p.target.Host = strings.ToLower(u.Opaque)
+	}
+	if p.target.ToURL().Hostname() == "" {
+		return NTPProbe{}, ErrMissingHost
+	}
+
+	query := u.ToURL().Query()
+	q := url.Values{}
+
+	if s := query.Get("degrade"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return NTPProbe{}, ErrInvalidNTPThreshold
+		}
+		p.degrade = d
+		q.Set("degrade", d.String())
+	}
+	if s := query.Get("failure"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return NTPProbe{}, ErrInvalidNTPThreshold
+		}
+		p.failure = d
+		q.Set("failure", d.String())
+	}
+	if p.failure < p.degrade {
+		return NTPProbe{}, ErrInvalidNTPThreshold
+	}
+	p.target.RawQuery = q.Encode()
+
+	return p, nil
+}
+
+func (p NTPProbe) Target() *api.URL {
+	return p.target
+}
+
+func (p NTPProbe) address() string {
+	u := p.target.ToURL()
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "123")
+	}
+	return u.Host
+}
+
+func (p NTPProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := p.probe(ctx)
+	rec.Time = st
+	rec.Target = p.target
+
+	r.Report(p.target, timeoutOr(ctx, rec))
+}
+
+func (p NTPProbe) probe(ctx context.Context) api.Record {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "udp", p.address())
+	if err != nil {
+		rec := api.Record{
+			Status:  api.StatusFailure,
+			Message: err.Error(),
+		}
+
+		dnsErr := &net.DNSError{}
+		if errors.As(err, &dnsErr) {
+			rec.Status = api.StatusUnknown
+			rec.Message = dnsErrorToMessage(dnsErr)
+		}
+		return rec
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	// LI = 0 (no warning), VN = 4, Mode = 3 (client)
+	req := make([]byte, 48)
+	req[0] = 0<<6 | 4<<3 | 3
+
+	t1 := time.Now()
+	binary.BigEndian.PutUint64(req[40:], toNTPTime(t1))
+
+	if _, err := conn.Write(req); err != nil {
+		return udpErrorRecord(err, time.Since(t1), nil)
+	}
+
+	resp := make([]byte, 48)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return udpErrorRecord(err, time.Since(t1), nil)
+		}
+		// Ignore the packets that are not the response to this request.
+		if n >= 48 && resp[0]&0x07 == 4 && bytes.Equal(resp[24:32], req[40:48]) {
+			break
+		}
+	}
+	t4 := time.Now()
+
+	leap := resp[0] >> 6
+	stratum := resp[1]
+	t2 := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	t3 := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+
+	rec := api.Record{
+		Latency: t4.Sub(t1) - t3.Sub(t2),
+		Extra: map[string]interface{}{
+			"offset":       milliseconds(offset),
+			"stratum":      int(stratum),
+			"root_delay":   milliseconds(fromNTPShort(binary.BigEndian.Uint32(resp[4:]))),
+			"reference_id": ntpReferenceID(stratum, resp[12:16]),
+		},
+	}
+
+	abs := offset
+	if abs < 0 {
+		abs = -abs
+	}
+
+	switch {
+	case stratum == 0:
+		rec.Status = api.StatusFailure
+		rec.Message = fmt.Sprintf("kiss-o'-death: %s", rec.Extra["reference_id"])
+		delete(rec.Extra, "offset")
+	case leap == 3 || stratum > 15:
+		rec.Status = api.StatusFailure
+		rec.Message = "server is not synchronized"
+		delete(rec.Extra, "offset")
+	case abs > p.failure:
+		rec.Status = api.StatusFailure
+		rec.Message = fmt.Sprintf("clock offset is larger than %s", p.failure)
+	case abs > p.degrade:
+		rec.Status = api.StatusDegrade
+		rec.Message = fmt.Sprintf("clock offset is larger than %s", p.degrade)
+	default:
+		rec.Status = api.StatusHealthy
+		rec.Message = "clock is synchronized"
+	}
+
+	return rec
+}
+
+// toNTPTime converts time.Time to the 64-bit NTP timestamp.
+func toNTPTime(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return sec<<32 | frac
+}
+
+// fromNTPTime converts the 64-bit NTP timestamp to time.Time.
+func fromNTPTime(x uint64) time.Time {
+	sec := int64(x>>32) - ntpEpochOffset
+	nsec := int64((x & 0xFFFFFFFF) * 1e9 >> 32)
+	return time.Unix(sec, nsec)
+}
+
+// fromNTPShort converts the 32-bit NTP short format to time.Duration.
+func fromNTPShort(x uint32) time.Duration {
+	return time.Duration(uint64(x) * uint64(time.Second) >> 16)
+}
+
+// ntpReferenceID formats the reference ID in a NTP packet.
+// It is ASCII string like "GPS" for stratum 0 (kiss code) and 1, or IPv4 address for others.
+func ntpReferenceID(stratum uint8, id []byte) string {
+	if stratum <= 1 {
+		return string(bytes.TrimRight(id, "\x00"))
+	}
+	return net.IP(id).String()
+}
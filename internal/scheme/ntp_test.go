@@ -0,0 +1,84 @@
+package scheme_test
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// StartNTPServer starts a stand-in NTP server that answers the time shifted by offset.
+// The reference ID is "GPS" for stratum 1, "DENY" for stratum 0, or 192.0.2.1 for others.
+func StartNTPServer(t testing.TB, offset time.Duration, stratum uint8) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	toNTP := func(t time.Time) uint64 {
+		return uint64(t.Unix()+2208988800)<<32 | uint64(t.Nanosecond())<<32/1e9
+	}
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+			received := time.Now().Add(offset)
+
+			resp := make([]byte, 48)
+			resp[0] = 0<<6 | 4<<3 | 4 // LI = 0, VN = 4, Mode = 4 (server)
+			resp[1] = stratum
+			binary.BigEndian.PutUint32(resp[4:], 0x00000800) // root delay = 31.25ms
+			switch stratum {
+			case 0:
+				copy(resp[12:], "DENY")
+			case 1:
+				copy(resp[12:], "GPS")
+			default:
+				copy(resp[12:], net.IPv4(192, 0, 2, 1).To4())
+			}
+			copy(resp[24:32], buf[40:48])
+			binary.BigEndian.PutUint64(resp[32:], toNTP(received))
+			binary.BigEndian.PutUint64(resp[40:], toNTP(time.Now().Add(offset)))
+
+			conn.WriteTo(resp, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestNTPProbe(t *testing.T) {
+	t.Parallel()
+
+	synced := StartNTPServer(t, 0, 2)
+	primary := StartNTPServer(t, 0, 1)
+	ahead := StartNTPServer(t, 3*time.Second, 2)
+	behind := StartNTPServer(t, -30*time.Second, 2)
+	kod := StartNTPServer(t, 0, 0)
+
+	AssertProbe(t, []ProbeTest{
+		{"ntp://" + synced, api.StatusHealthy, `clock is synchronized\n---\noffset: -?[0-9.]+\nreference_id: 192.0.2.1\nroot_delay: 31.25\nstratum: 2`, ""},
+		{"ntp://" + primary, api.StatusHealthy, `clock is synchronized\n---\noffset: -?[0-9.]+\nreference_id: GPS\nroot_delay: 31.25\nstratum: 1`, ""},
+		{"ntp://" + ahead, api.StatusDegrade, `clock offset is larger than 1s\n---\noffset: (3000(\.[0-9]+)?|2999\.[0-9]+)\nreference_id: 192.0.2.1\nroot_delay: 31.25\nstratum: 2`, ""},
+		{"ntp://" + ahead + "?degrade=5s", api.StatusHealthy, `clock is synchronized\n---\noffset: [0-9.]+\nreference_id: 192.0.2.1\nroot_delay: 31.25\nstratum: 2`, ""},
+		{"ntp://" + ahead + "?degrade=100ms&failure=2s", api.StatusFailure, `clock offset is larger than 2s\n---\noffset: [0-9.]+\nreference_id: 192.0.2.1\nroot_delay: 31.25\nstratum: 2`, ""},
+		{"ntp://" + behind, api.StatusFailure, `clock offset is larger than 10s\n---\noffset: -[0-9.]+\nreference_id: 192.0.2.1\nroot_delay: 31.25\nstratum: 2`, ""},
+		{"ntp://" + kod, api.StatusFailure, `kiss-o'-death: DENY\n---\nreference_id: DENY\nroot_delay: 31.25\nstratum: 0`, ""},
+		{"ntp://" + synced + "?degrade=abc", api.StatusUnknown, "", "invalid threshold of clock offset"},
+		{"ntp://" + synced + "?degrade=2s&failure=1s", api.StatusUnknown, "", "invalid threshold of clock offset"},
+	}, 5)
+}
@@ -0,0 +1,41 @@
+package scheme
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidPayload = errors.New("invalid hex payload")
+)
+
+// parsePayload parses a payload in query.
+// The payload is a plain text, or a hex string with "hex:" prefix like "hex:0a0b0c".
+func parsePayload(s string) ([]byte, error) {
+	if h, ok := strings.CutPrefix(s, "hex:"); ok {
+		b, err := hex.DecodeString(strings.ReplaceAll(h, " ", ""))
+		if err != nil {
+			return nil, ErrInvalidPayload
+		}
+		return b, nil
+	}
+	return []byte(s), nil
+}
+
+// maxPayloadDisplay is the maximum size of payload that formatPayload shows.
+const maxPayloadDisplay = 256
+
+// formatPayload formats a payload to show in messages.
+// The payload is formatted as the same notation as parsePayload, and truncated to maxPayloadDisplay bytes.
+func formatPayload(b []byte) string {
+	if len(b) > maxPayloadDisplay {
+		b = b[:maxPayloadDisplay]
+	}
+	if utf8.Valid(b) && !bytes.ContainsFunc(b, func(r rune) bool { return r < 0x20 && r != '\t' && r != '\n' && r != '\r' }) {
+		return string(b)
+	}
+	return "hex:" + hex.EncodeToString(b)
+}
@@ -0,0 +1,128 @@
+package scheme
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrInvalidPostgresURL = errors.New("invalid PostgreSQL URL")
+)
+
+// PostgresProbe is a Prober implementation for PostgreSQL.
+//
+// It connects to the server, and executes "SELECT 1" or the query in the "query" query.
+// The status will be DEGRADE if the server is a read-only replica.
+type PostgresProbe struct {
+	target *api.URL
+	config *pgconn.Config
+	query  string
+}
+
+func NewPostgresProbe(u *api.URL) (PostgresProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return PostgresProbe{}, ErrUnsupportedScheme
+	}
+
+	p := PostgresProbe{
+		target: &api.URL{Scheme: scheme, User: u.User, Host: strings.ToLower(u.Host), Path: u.Path, RawQuery: u.RawQuery, Fragment: u.Fragment},
+		query:  "SELECT 1",
+	}
+	if p.target.ToURL().Hostname() == "" {
+		return PostgresProbe{}, ErrMissingHost
+	}
+
+	// The "query" is not a parameter for the server, so remove it before parsing.
+	x := *u.ToURL()
+	x.Scheme = "postgres"
+	x.Fragment = ""
+	q := x.Query()
+	if query := q.Get("query"); query != "" {
+		p.query = query
+	}
+	q.Del("query")
+	x.RawQuery = q.Encode()
+
+	config, err := pgconn.ParseConfig(x.String())
+	if err != nil {
+		return PostgresProbe{}, ErrInvalidPostgresURL
+	}
+	p.config = config
+
+	return p, nil
+}
+
+func (p PostgresProbe) Target() *api.URL {
+	return p.target
+}
+
+func (p PostgresProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := p.probe(ctx)
+	rec.Time = st
+	rec.Target = p.target
+	rec.Latency = time.Since(st)
+
+	r.Report(p.target, timeoutOr(ctx, rec))
+}
+
+func (p PostgresProbe) probe(ctx context.Context) api.Record {
+	conn, err := pgconn.ConnectConfig(ctx, p.config)
+	if err != nil {
+		return dbConnectErrorRecord(err)
+	}
+	defer conn.Close(context.Background())
+
+	extra := map[string]interface{}{
+		"server_version": conn.ParameterStatus("server_version"),
+	}
+
+	st := time.Now()
+	results, err := conn.Exec(ctx, p.query).ReadAll()
+	extra["query_latency"] = milliseconds(time.Since(st))
+	if err != nil {
+		return api.Record{
+			Status:  api.StatusFailure,
+			Message: "failed to execute query: " + err.Error(),
+			Extra:   extra,
+		}
+	}
+	if len(results) > 0 {
+		extra["rows"] = len(results[len(results)-1].Rows)
+	}
+
+	rec := api.Record{
+		Status:  api.StatusHealthy,
+		Message: "succeed to execute query",
+		Extra:   extra,
+	}
+
+	if p.isReplica(ctx, conn) {
+		rec.Status = api.StatusDegrade
+		rec.Message = "succeed to execute query, but the server is a read-only replica"
+	}
+
+	return rec
+}
+
+// isReplica checks if the server is in recovery mode, in other words, the server is a read-only replica.
+func (p PostgresProbe) isReplica(ctx context.Context, conn *pgconn.PgConn) bool {
+	if conn.ParameterStatus("in_hot_standby") == "on" {
+		return true
+	}
+
+	results, err := conn.Exec(ctx, "SELECT pg_is_in_recovery()").ReadAll()
+	if err != nil || len(results) == 0 || len(results[0].Rows) == 0 || len(results[0].Rows[0]) == 0 {
+		return false
+	}
+	return string(results[0].Rows[0][0]) == "t"
+}
@@ -0,0 +1,135 @@
+package scheme_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// StartPostgresServer starts a stand-in PostgreSQL server that accepts user "hoge" with password "fuga".
+// If replica is true, the server behaves as a server in recovery mode.
+func StartPostgresServer(t testing.TB, replica bool) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				servePostgres(pgproto3.NewBackend(conn, conn), conn, replica)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func servePostgres(b *pgproto3.Backend, conn net.Conn, replica bool) {
+	var startup *pgproto3.StartupMessage
+	for startup == nil {
+		msg, err := b.ReceiveStartupMessage()
+		if err != nil {
+			return
+		}
+		switch m := msg.(type) {
+		case *pgproto3.SSLRequest, *pgproto3.GSSEncRequest:
+			conn.Write([]byte("N"))
+		case *pgproto3.StartupMessage:
+			startup = m
+		default:
+			return
+		}
+	}
+
+	b.Send(&pgproto3.AuthenticationCleartextPassword{})
+	b.Flush()
+	b.SetAuthType(pgproto3.AuthTypeCleartextPassword)
+
+	msg, err := b.Receive()
+	if err != nil {
+		return
+	}
+	if pw, ok := msg.(*pgproto3.PasswordMessage); !ok || startup.Parameters["user"] != "hoge" || pw.Password != "fuga" {
+		b.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28P01", Message: `password authentication failed for user "` + startup.Parameters["user"] + `"`})
+		b.Flush()
+		return
+	}
+
+	b.Send(&pgproto3.AuthenticationOk{})
+	b.Send(&pgproto3.ParameterStatus{Name: "server_version", Value: "16.2"})
+	b.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	b.Flush()
+
+	row := func(values ...string) {
+		b.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte("x"), DataTypeOID: 25, DataTypeSize: -1}}})
+		for _, v := range values {
+			b.Send(&pgproto3.DataRow{Values: [][]byte{[]byte(v)}})
+		}
+		b.Send(&pgproto3.CommandComplete{CommandTag: []byte("SELECT " + string(rune('0'+len(values))))})
+	}
+
+	for {
+		msg, err := b.Receive()
+		if err != nil {
+			return
+		}
+
+		switch m := msg.(type) {
+		case *pgproto3.Query:
+			switch strings.TrimSpace(m.String) {
+			case "SELECT 1":
+				row("1")
+			case "SELECT pg_is_in_recovery()":
+				if replica {
+					row("t")
+				} else {
+					row("f")
+				}
+			case "SELECT name FROM items":
+				row("foo", "bar", "baz")
+			default:
+				b.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42601", Message: "syntax error"})
+			}
+			b.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			b.Flush()
+		case *pgproto3.Terminate:
+			return
+		default:
+			return
+		}
+	}
+}
+
+func TestPostgresProbe(t *testing.T) {
+	t.Parallel()
+
+	primary := StartPostgresServer(t, false)
+	replica := StartPostgresServer(t, true)
+
+	AssertProbe(t, []ProbeTest{
+		{"postgres://hoge:fuga@" + primary + "/db?sslmode=disable", api.StatusHealthy, `succeed to execute query\n---\nquery_latency: [0-9.]+\nrows: 1\nserver_version: 16.2`, ""},
+		{"postgres://hoge:fuga@" + primary + "/db?query=SELECT+name+FROM+items&sslmode=disable", api.StatusHealthy, `succeed to execute query\n---\nquery_latency: [0-9.]+\nrows: 3\nserver_version: 16.2`, ""},
+		{"postgres://hoge:fuga@" + primary + "/db?query=SELEC+1&sslmode=disable", api.StatusFailure, `failed to execute query: ERROR: syntax error \(SQLSTATE 42601\)\n---\nquery_latency: [0-9.]+\nserver_version: 16.2`, ""},
+		{"postgres://hoge:fuga@" + replica + "/db?sslmode=disable", api.StatusDegrade, `succeed to execute query, but the server is a read-only replica\n---\nquery_latency: [0-9.]+\nrows: 1\nserver_version: 16.2`, ""},
+		{"postgres://hoge:foo@" + primary + "/db?sslmode=disable", api.StatusFailure, `failed to connect to .+: FATAL: password authentication failed for user "hoge" \(SQLSTATE 28P01\)`, ""},
+		{"postgres://hoge:fuga@" + primary + "/db?sslmode=foobar", api.StatusUnknown, ``, "invalid PostgreSQL URL"},
+	}, 5)
+
+	AssertTimeout(t, "postgres://hoge:fuga@"+primary+"/db?sslmode=disable")
+}
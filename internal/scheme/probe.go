@@ -36,6 +36,28 @@ func NewProberFromURL(u *api.URL) (Prober, error) {
 		return NewPingProbe(u)
 	case "tcp", "tcp4", "tcp6":
 		return NewTCPProbe(u)
+	case "udp", "udp4", "udp6":
+		return NewUDPProbe(u)
+	case "smtp", "smtps", "imap", "imaps", "pop3", "pop3s":
+		return NewMailProbe(u)
+	case "postgres", "postgresql":
+		return NewPostgresProbe(u)
+	case "mysql":
+		return NewMySQLProbe(u)
+	case "redis", "rediss":
+		return NewRedisProbe(u)
+	case "grpc", "grpcs":
+		return NewGRPCProbe(u)
+	case "ws", "wss":
+		return NewWebSocketProbe(u)
+	case "ntp":
+		return NewNTPProbe(u)
+	case "snmp":
+		return NewSNMPProbe(u)
+	case "ldap", "ldaps":
+		return NewLDAPProbe(u)
+	case "mqtt", "mqtts":
+		return NewMQTTScheme(u)
 	case "ssh":
 		return NewSSHProbe(u)
 	case "sftp":
@@ -55,8 +77,16 @@ func NewProberFromURL(u *api.URL) (Prober, error) {
 	}
 }
 
+// NewProber makes a Prober from the raw URL.
+// The secret references in the URL, like "${env:NAME}" or "${file:/path/to/file}", are resolved here.
+// The resolved secrets are masked in the Target URL and the reports.
 func NewProber(rawURL string) (Prober, error) {
-	u, err := api.ParseURL(rawURL)
+	resolved, secrets, err := resolveSecretRefs(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := api.ParseURL(resolved)
 	if err != nil {
 		return nil, ErrInvalidURL
 	}
@@ -65,7 +95,11 @@ func NewProber(rawURL string) (Prober, error) {
 		return nil, ErrMissingScheme
 	}
 
-	return NewProberFromURL(u)
+	p, err := NewProberFromURL(u)
+	if err != nil || len(secrets) == 0 {
+		return p, err
+	}
+	return newSecretProber(p, secrets), nil
 }
 
 func timeoutOr(ctx context.Context, r api.Record) api.Record {
@@ -0,0 +1,280 @@
+package scheme
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrInvalidRedisDB = errors.New("invalid Redis database number")
+)
+
+const (
+	// maxRedisBulk is the maximum size of a bulk string that RedisProbe receives.
+	maxRedisBulk = 1024 * 1024
+
+	// maxRedisArray is the maximum number of elements in an array that RedisProbe receives.
+	maxRedisArray = 1024
+)
+
+// RedisProbe is a Prober implementation for Redis.
+//
+// It connects to the server, and sends PING command or the command in the "query" query.
+// The status will be DEGRADE if the server is a replica.
+type RedisProbe struct {
+	target *api.URL
+	db     int
+	query  []string
+}
+
+func NewRedisProbe(u *api.URL) (RedisProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return RedisProbe{}, ErrUnsupportedScheme
+	}
+
+	p := RedisProbe{
+		target: &api.URL{Scheme: scheme, User: u.User, Host: strings.ToLower(u.Host), Fragment: u.Fragment},
+		query:  []string{"PING"},
+	}
+	if p.target.ToURL().Hostname() == "" {
+		return RedisProbe{}, ErrMissingHost
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil || n < 0 {
+			return RedisProbe{}, ErrInvalidRedisDB
+		}
+		p.db = n
+		p.target.Path = "/" + db
+	}
+
+	if q := strings.Fields(u.ToURL().Query().Get("query")); len(q) > 0 {
+		p.query = q
+		p.target.RawQuery = url.Values{"query": {strings.Join(q, " ")}}.Encode()
+	}
+
+	return p, nil
+}
+
+func (p RedisProbe) Target() *api.URL {
+	return p.target
+}
+
+func (p RedisProbe) address() string {
+	u := p.target.ToURL()
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "6379")
+	}
+	return u.Host
+}
+
+func (p RedisProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := p.probe(ctx)
+	rec.Time = st
+	rec.Target = p.target
+	rec.Latency = time.Since(st)
+
+	r.Report(p.target, timeoutOr(ctx, rec))
+}
+
+func (p RedisProbe) dial(ctx context.Context) (net.Conn, error) {
+	if p.target.Scheme == "rediss" {
+		dialer := tls.Dialer{
+			Config: newTLSConfig(p.target.ToURL().Hostname()),
+		}
+		return dialer.DialContext(ctx, "tcp", p.address())
+	}
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", p.address())
+}
+
+func (p RedisProbe) probe(ctx context.Context) api.Record {
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return dbConnectErrorRecord(err)
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	c := redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if p.target.User != nil {
+		args := []string{"AUTH"}
+		if name := p.target.User.Username(); name != "" {
+			args = append(args, name)
+		}
+		password, _ := p.target.User.Password()
+		if _, err := c.Do(append(args, password)...); err != nil {
+			return api.Record{
+				Status:  api.StatusFailure,
+				Message: "failed to authenticate: " + err.Error(),
+			}
+		}
+	}
+
+	if p.db != 0 {
+		if _, err := c.Do("SELECT", strconv.Itoa(p.db)); err != nil {
+			return api.Record{
+				Status:  api.StatusFailure,
+				Message: "failed to select database: " + err.Error(),
+			}
+		}
+	}
+
+	extra := map[string]interface{}{}
+	if tc, ok := conn.(*tls.Conn); ok {
+		setTLSExtra(extra, tc.ConnectionState())
+	}
+
+	info, _ := c.Do("INFO", "server")
+	if v := redisInfoValue(info, "redis_version"); v != "" {
+		extra["server_version"] = v
+	}
+
+	st := time.Now()
+	resp, err := c.Do(p.query...)
+	extra["query_latency"] = milliseconds(time.Since(st))
+	if err != nil {
+		var redisErr redisError
+		if errors.As(err, &redisErr) {
+			err = fmt.Errorf("failed to execute query: %w", err)
+		}
+		return api.Record{
+			Status:  api.StatusFailure,
+			Message: err.Error(),
+			Extra:   extra,
+		}
+	}
+	extra["response"] = formatPayload([]byte(resp))
+
+	rec := api.Record{
+		Status:  api.StatusHealthy,
+		Message: "succeed to execute query",
+		Extra:   extra,
+	}
+
+	if info, err := c.Do("INFO", "replication"); err == nil && redisInfoValue(info, "role") == "slave" {
+		rec.Status = api.StatusDegrade
+		rec.Message = "succeed to execute query, but the server is a replica"
+	}
+
+	return rec
+}
+
+// redisInfoValue gets a value from the response of INFO command.
+func redisInfoValue(info, key string) string {
+	for _, line := range strings.Split(info, "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), key+":"); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// redisError is an error response from Redis server.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisConn is a connection to Redis server in RESP protocol.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Do sends a command, and returns the response as a string.
+// Arrays in the response are joined with newlines.
+func (c redisConn) Do(args ...string) (string, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.conn, sb.String()); err != nil {
+		return "", err
+	}
+
+	return c.read()
+}
+
+func (c redisConn) read() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("unexpected empty response")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", redisError(line[1:])
+	case ':':
+		return line[1:], nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid response: %s", line)
+		}
+		if n < 0 {
+			return "(nil)", nil
+		}
+		if n > maxRedisBulk {
+			return "", errors.New("too large response")
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid response: %s", line)
+		}
+		if n < 0 {
+			return "(nil)", nil
+		}
+		if n > maxRedisArray {
+			return "", errors.New("too large response")
+		}
+		xs := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			x, err := c.read()
+			if err != nil {
+				return "", err
+			}
+			xs = append(xs, x)
+		}
+		return strings.Join(xs, "\n"), nil
+	default:
+		return "", fmt.Errorf("invalid response: %s", line)
+	}
+}
@@ -0,0 +1,151 @@
+package scheme_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// readRedisCommand reads a command in RESP array from the client.
+func readRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// StartRedisServer starts a stand-in Redis server that requires password "fuga".
+// If replica is true, the server behaves as a replica.
+func StartRedisServer(t testing.TB, replica bool) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				serveRedis(conn, replica)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func serveRedis(conn net.Conn, replica bool) {
+	r := bufio.NewReader(conn)
+	authorized := false
+
+	bulk := func(s string) {
+		fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(s), s)
+	}
+
+	for {
+		args, err := readRedisCommand(r)
+		if err != nil || len(args) == 0 {
+			return
+		}
+
+		cmd := strings.ToUpper(args[0])
+		if cmd == "AUTH" {
+			if args[len(args)-1] == "fuga" && (len(args) == 2 || args[1] == "hoge") {
+				authorized = true
+				io.WriteString(conn, "+OK\r\n")
+			} else {
+				io.WriteString(conn, "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+			}
+			continue
+		}
+		if !authorized {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+
+		switch {
+		case cmd == "PING":
+			io.WriteString(conn, "+PONG\r\n")
+		case cmd == "SELECT":
+			io.WriteString(conn, "+OK\r\n")
+		case cmd == "INFO" && len(args) == 2 && args[1] == "server":
+			bulk("# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n")
+		case cmd == "INFO" && len(args) == 2 && args[1] == "replication":
+			if replica {
+				bulk("# Replication\r\nrole:slave\r\nmaster_host:127.0.0.1\r\n")
+			} else {
+				bulk("# Replication\r\nrole:master\r\nconnected_slaves:0\r\n")
+			}
+		case cmd == "GET" && len(args) == 2 && args[1] == "foo":
+			bulk("bar")
+		case cmd == "GET":
+			io.WriteString(conn, "$-1\r\n")
+		case cmd == "BLPOP":
+			io.WriteString(conn, "*-1\r\n")
+		case cmd == "HUGE":
+			io.WriteString(conn, "$9999999999\r\n")
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func TestRedisProbe(t *testing.T) {
+	t.Parallel()
+
+	primary := StartRedisServer(t, false)
+	replica := StartRedisServer(t, true)
+
+	AssertProbe(t, []ProbeTest{
+		{"redis://:fuga@" + primary, api.StatusHealthy, `succeed to execute query\n---\nquery_latency: [0-9.]+\nresponse: PONG\nserver_version: 7.2.4`, ""},
+		{"redis://hoge:fuga@" + primary + "/1?query=GET+foo", api.StatusHealthy, `succeed to execute query\n---\nquery_latency: [0-9.]+\nresponse: bar\nserver_version: 7.2.4`, ""},
+		{"redis://:fuga@" + primary + "?query=HELLO+WORLD", api.StatusFailure, `failed to execute query: ERR unknown command 'HELLO'\n---\nquery_latency: [0-9.]+\nserver_version: 7.2.4`, ""},
+		{"redis://:fuga@" + primary + "?query=BLPOP+foo+1", api.StatusHealthy, `succeed to execute query\n---\nquery_latency: [0-9.]+\nresponse: \(nil\)\nserver_version: 7.2.4`, ""},
+		{"redis://:fuga@" + primary + "?query=HUGE", api.StatusFailure, `too large response\n---\nquery_latency: [0-9.]+\nserver_version: 7.2.4`, ""},
+		{"redis://:fuga@" + replica, api.StatusDegrade, `succeed to execute query, but the server is a replica\n---\nquery_latency: [0-9.]+\nresponse: PONG\nserver_version: 7.2.4`, ""},
+		{"redis://:foo@" + primary, api.StatusFailure, `failed to authenticate: WRONGPASS invalid username-password pair or user is disabled.`, ""},
+		{"redis://" + primary, api.StatusFailure, `failed to execute query: NOAUTH Authentication required.\n---\nquery_latency: [0-9.]+`, ""},
+		{"redis://" + primary + "/abc", api.StatusUnknown, ``, "invalid Redis database number"},
+	}, 5)
+
+	AssertTimeout(t, "redis://:fuga@"+primary)
+}
@@ -0,0 +1,125 @@
+package scheme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// secretRefPattern matches secret references in URLs, like "${env:DB_PASS}" or "${file:/run/secrets/ftp}".
+var secretRefPattern = regexp.MustCompile(`\$\{(env|file):([^}]*)\}`)
+
+func readSecretRef(kind, name string) (string, error) {
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	default:
+		v, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(v), "\r\n"), nil
+	}
+}
+
+// resolveSecretRefs replaces secret references in the raw URL with the actual values.
+// It returns the resolved URL and the secrets in it.
+func resolveSecretRefs(rawURL string) (string, []string, error) {
+	var secrets []string
+	var err error
+
+	resolved := secretRefPattern.ReplaceAllStringFunc(rawURL, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+
+		m := secretRefPattern.FindStringSubmatch(ref)
+
+		var v string
+		v, err = readSecretRef(m[1], m[2])
+		if err != nil {
+			return ref
+		}
+
+		secrets = append(secrets, v)
+		return api.EscapeAll(v)
+	})
+
+	return resolved, secrets, err
+}
+
+// secretReporter is a Reporter that hides secrets in the records.
+type secretReporter struct {
+	masker   api.SecretMasker
+	upstream Reporter
+}
+
+func (r secretReporter) Report(source *api.URL, rec api.Record) {
+	r.upstream.Report(r.masker.MaskURL(source), r.masker.MaskRecord(rec))
+}
+
+func (r secretReporter) DeactivateTarget(source *api.URL, targets ...*api.URL) {
+	masked := make([]*api.URL, len(targets))
+	for i, t := range targets {
+		masked[i] = r.masker.MaskURL(t)
+	}
+	r.upstream.DeactivateTarget(r.masker.MaskURL(source), masked...)
+}
+
+// secretProber is a Prober for the target URL that has secret references.
+// It hides the resolved secrets from the target URL and the reports.
+type secretProber struct {
+	prober Prober
+	target *api.URL
+	masker api.SecretMasker
+}
+
+func newSecretProber(p Prober, secrets []string) secretProber {
+	m := api.SecretMasker{}.WithSecrets(secrets...)
+	return secretProber{
+		prober: p,
+		target: m.MaskURL(p.Target()),
+		masker: m,
+	}
+}
+
+func (p secretProber) Target() *api.URL {
+	return p.target
+}
+
+func (p secretProber) Probe(ctx context.Context, r Reporter) {
+	p.prober.Probe(ctx, secretReporter{p.masker, r})
+}
+
+// secretAlerter is an Alerter for the alert URL that has secret references.
+// It hides the resolved secrets from the alert URL and the reports.
+type secretAlerter struct {
+	alerter Alerter
+	target  *api.URL
+	masker  api.SecretMasker
+}
+
+func newSecretAlerter(a Alerter, secrets []string) secretAlerter {
+	m := api.SecretMasker{}.WithSecrets(secrets...)
+	return secretAlerter{
+		alerter: a,
+		target:  m.MaskURL(a.Target()),
+		masker:  m,
+	}
+}
+
+func (a secretAlerter) Target() *api.URL {
+	return a.target
+}
+
+func (a secretAlerter) Alert(ctx context.Context, r Reporter, lastRecord api.Record) {
+	a.alerter.Alert(ctx, secretReporter{a.masker, r}, lastRecord)
+}
@@ -0,0 +1,109 @@
+package scheme_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/macrat/ayd/internal/scheme"
+	"github.com/macrat/ayd/internal/testutil"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+func TestNewProber_secretRef(t *testing.T) {
+	t.Setenv("AYD_TEST_SECRET", "secret value")
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("fuga\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %s", err)
+	}
+
+	t.Run("env", func(t *testing.T) {
+		p := testutil.NewProber(t, "dummy:failure?message=${env:AYD_TEST_SECRET}")
+
+		if s := p.Target().String(); s != "dummy:failure?message=xxxxx" {
+			t.Errorf("unexpected target: %s", s)
+		}
+
+		rs := testutil.RunProbe(context.Background(), p)
+		if len(rs) != 1 {
+			t.Fatalf("unexpected number of records: %d", len(rs))
+		}
+		if rs[0].Message != "xxxxx" {
+			t.Errorf("secret is not masked in message: %q", rs[0].Message)
+		}
+		if s := rs[0].Target.String(); s != "dummy:failure?message=xxxxx" {
+			t.Errorf("secret is not masked in target: %s", s)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		_, addr := StartFTPServer(t)
+
+		p := testutil.NewProber(t, "ftp://hoge:${file:"+secretFile+"}@"+addr+"/")
+
+		if s := p.Target().String(); s != "ftp://hoge:xxxxx@"+addr+"/" {
+			t.Errorf("unexpected target: %s", s)
+		}
+
+		rs := testutil.RunProbe(context.Background(), p)
+		if len(rs) != 1 {
+			t.Fatalf("unexpected number of records: %d", len(rs))
+		}
+		if rs[0].Status != api.StatusHealthy {
+			t.Errorf("failed to login with the secret: %s: %s", rs[0].Status, rs[0].Message)
+		}
+		if strings.Contains(rs[0].Target.ToURL().String(), "fuga") {
+			t.Errorf("secret is not masked in target: %s", rs[0].Target.ToURL())
+		}
+	})
+
+	t.Run("short", func(t *testing.T) {
+		t.Setenv("AYD_TEST_SHORT_SECRET", "e")
+
+		p := testutil.NewProber(t, "dummy:healthy?message=${env:AYD_TEST_SHORT_SECRET}")
+
+		if s := p.Target().String(); s != "dummy:healthy?message=e" {
+			t.Errorf("too short secret should not be masked: %s", s)
+		}
+	})
+
+	t.Run("missing-env", func(t *testing.T) {
+		_, err := scheme.NewProber("dummy:?message=${env:AYD_TEST_UNDEFINED_SECRET}")
+		if err == nil || err.Error() != "environment variable AYD_TEST_UNDEFINED_SECRET is not set" {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("missing-file", func(t *testing.T) {
+		_, err := scheme.NewProber("dummy:?message=${file:" + filepath.Join(t.TempDir(), "no-such-file") + "}")
+		if err == nil || !strings.HasPrefix(err.Error(), "failed to read secret file: ") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewAlerter_secretRef(t *testing.T) {
+	t.Setenv("AYD_TEST_SECRET", "secret-value")
+
+	a, err := scheme.NewAlerter("dummy:failure?message=${env:AYD_TEST_SECRET}")
+	if err != nil {
+		t.Fatalf("failed to create alerter: %s", err)
+	}
+
+	if s := a.Target().String(); s != "dummy:failure?message=xxxxx" {
+		t.Errorf("unexpected target: %s", s)
+	}
+
+	rs := testutil.RunAlert(context.Background(), a, api.Record{
+		Target: &api.URL{Scheme: "dummy", Opaque: "failure"},
+		Status: api.StatusFailure,
+	})
+	for _, r := range rs {
+		if strings.Contains(r.Message, "secret-value") || strings.Contains(r.Target.ToURL().String(), "secret-value") {
+			t.Errorf("secret is not masked: %v", r)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package scheme
+
+import (
+	"context"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrMissingSNMPOID         = errors.New("missing OID")
+	ErrInvalidSNMPOID         = errors.New("invalid OID")
+	ErrInvalidSNMPThreshold   = errors.New("invalid threshold of SNMP value")
+	ErrUnsupportedSNMPVersion = errors.New("unsupported SNMP version")
+)
+
+// snmpVersion2c is the version number of SNMPv2c in the message.
+const snmpVersion2c = 1
+
+// snmpErrorStatus is the names of the error-status in SNMP response.
+var snmpErrorStatus = []string{
+	"noError", "tooBig", "noSuchName", "badValue", "readOnly", "genErr", "noAccess", "wrongType", "wrongLength",
+	"wrongEncoding", "wrongValue", "noCreation", "inconsistentValue", "resourceUnavailable", "commitFailed",
+	"undoFailed", "authorizationError", "notWritable", "inconsistentName",
+}
+
+// maskedCommunity is shown in the target URL instead of the community string.
+const maskedCommunity = "xxxxx"
+
+// SNMPProbe is a Prober implementation for the SNMPv2c.
+//
+// It gets the values of OIDs in the path, like "snmp://public@192.168.1.1/1.3.6.1.2.1.1.3.0".
+// Multiple OIDs can be separated by comma.
+// The values can be checked with "min", "max", "degrade_min", and "degrade_max" query.
+type SNMPProbe struct {
+	target    *api.URL
+	community string
+	oids      []asn1.ObjectIdentifier
+	bounds    snmpBounds
+}
+
+// snmpBounds is the thresholds of the SNMP values.
+// The nil means no threshold.
+type snmpBounds struct {
+	Min, Max               *float64
+	DegradeMin, DegradeMax *float64
+}
+
+func NewSNMPProbe(u *api.URL) (SNMPProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return SNMPProbe{}, ErrUnsupportedScheme
+	}
+
+	p := SNMPProbe{
+		target:    &api.URL{Scheme: scheme, User: u.User, Host: strings.ToLower(u.Host), Fragment: u.Fragment},
+		community: "public",
+	}
+	if p.target.ToURL().Hostname() == "" {
+		return SNMPProbe{}, ErrMissingHost
+	}
+	if u.User != nil && u.User.Username() != "" {
+		// The community is a credential, so it is masked in the target URL.
+		p.community = u.User.Username()
+		p.target.User = url.User(maskedCommunity)
+	}
+
+	var paths []string
+	for _, s := range strings.Split(strings.Trim(u.Path, "/"), ",") {
+		s = strings.TrimPrefix(strings.TrimSpace(s), ".")
+		if s == "" {
+			continue
+		}
+		oid, err := parseSNMPOID(s)
+		if err != nil {
+			return SNMPProbe{}, err
+		}
+		p.oids = append(p.oids, oid)
+		paths = append(paths, oid.String())
+	}
+	if len(p.oids) == 0 {
+		return SNMPProbe{}, ErrMissingSNMPOID
+	}
+	p.target.Path = "/" + strings.Join(paths, ",")
+
+	query := u.ToURL().Query()
+	q := url.Values{}
+
+	if v := query.Get("version"); v != "" && v != "2c" {
+		return SNMPProbe{}, ErrUnsupportedSNMPVersion
+	}
+
+	for _, x := range []struct {
+		Name string
+		Ptr  **float64
+	}{
+		{"min", &p.bounds.Min},
+		{"max", &p.bounds.Max},
+		{"degrade_min", &p.bounds.DegradeMin},
+		{"degrade_max", &p.bounds.DegradeMax},
+	} {
+		if s := query.Get(x.Name); s != "" {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return SNMPProbe{}, ErrInvalidSNMPThreshold
+			}
+			*x.Ptr = &f
+			q.Set(x.Name, strconv.FormatFloat(f, 'f', -1, 64))
+		}
+	}
+	p.target.RawQuery = q.Encode()
+
+	return p, nil
+}
+
+// parseSNMPOID parses a dotted OID string like "1.3.6.1.2.1.1.3.0".
+func parseSNMPOID(s string) (asn1.ObjectIdentifier, error) {
+	xs := strings.Split(s, ".")
+	if len(xs) < 2 {
+		return nil, ErrInvalidSNMPOID
+	}
+
+	oid := make(asn1.ObjectIdentifier, len(xs))
+	for i, x := range xs {
+		n, err := strconv.ParseUint(x, 10, 31)
+		if err != nil {
+			return nil, ErrInvalidSNMPOID
+		}
+		oid[i] = int(n)
+	}
+	if oid[0] > 2 || (oid[0] < 2 && oid[1] >= 40) {
+		return nil, ErrInvalidSNMPOID
+	}
+
+	return oid, nil
+}
+
+func (p SNMPProbe) Target() *api.URL {
+	return p.target
+}
+
+func (p SNMPProbe) address() string {
+	u := p.target.ToURL()
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "161")
+	}
+	return u.Host
+}
+
+func (p SNMPProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := p.probe(ctx)
+	rec.Time = st
+	rec.Target = p.target
+
+	r.Report(p.target, timeoutOr(ctx, rec))
+}
+
+type snmpVarBind struct {
+	Name  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type snmpPDU struct {
+	RequestID   int32
+	ErrorStatus int
+	ErrorIndex  int
+	VarBinds    []snmpVarBind
+}
+
+type snmpGetRequest struct {
+	Version   int
+	Community []byte
+	PDU       snmpPDU `asn1:"tag:0"`
+}
+
+type snmpResponse struct {
+	Version   int
+	Community []byte
+	PDU       snmpPDU `asn1:"tag:2"`
+}
+
+func (p SNMPProbe) probe(ctx context.Context) api.Record {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "udp", p.address())
+	if err != nil {
+		rec := api.Record{
+			Status:  api.StatusFailure,
+			Message: err.Error(),
+		}
+
+		dnsErr := &net.DNSError{}
+		if errors.As(err, &dnsErr) {
+			rec.Status = api.StatusUnknown
+			rec.Message = dnsErrorToMessage(dnsErr)
+		}
+		return rec
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	req := snmpGetRequest{
+		Version:   snmpVersion2c,
+		Community: []byte(p.community),
+		PDU: snmpPDU{
+			RequestID: rand.Int31(),
+			VarBinds:  make([]snmpVarBind, len(p.oids)),
+		},
+	}
+	for i, oid := range p.oids {
+		req.PDU.VarBinds[i] = snmpVarBind{Name: oid, Value: asn1.NullRawValue}
+	}
+	payload, err := asn1.Marshal(req)
+	if err != nil {
+		return api.Record{
+			Status:  api.StatusUnknown,
+			Message: err.Error(),
+		}
+	}
+
+	st := time.Now()
+	if _, err := conn.Write(payload); err != nil {
+		return udpErrorRecord(err, time.Since(st), nil)
+	}
+
+	var resp snmpResponse
+	buf := make([]byte, maxUDPResponse)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return udpErrorRecord(err, time.Since(st), nil)
+		}
+		// Ignore the packets that are not the response to this request.
+		if _, err := asn1.Unmarshal(buf[:n], &resp); err == nil && resp.PDU.RequestID == req.PDU.RequestID {
+			break
+		}
+	}
+	latency := time.Since(st)
+
+	if resp.PDU.ErrorStatus != 0 {
+		status := strconv.Itoa(resp.PDU.ErrorStatus)
+		if resp.PDU.ErrorStatus < len(snmpErrorStatus) {
+			status = snmpErrorStatus[resp.PDU.ErrorStatus]
+		}
+		return api.Record{
+			Status:  api.StatusFailure,
+			Latency: latency,
+			Message: "SNMP error: " + status,
+		}
+	}
+
+	rec := api.Record{
+		Status:  api.StatusHealthy,
+		Latency: latency,
+		Message: "succeed to get values",
+		Extra:   map[string]interface{}{},
+	}
+
+	for _, vb := range resp.PDU.VarBinds {
+		name := vb.Name.String()
+
+		v, err := decodeSNMPValue(vb.Value)
+		if err != nil {
+			rec.Status = api.StatusFailure
+			rec.Message = fmt.Sprintf("%s: %s", name, err)
+			return rec
+		}
+		rec.Extra[name] = v
+
+		// Report the worst status, and the first reason of it.
+		st, msg := p.bounds.Check(v)
+		if (st == api.StatusFailure && rec.Status != api.StatusFailure) || (st == api.StatusDegrade && rec.Status == api.StatusHealthy) {
+			rec.Status = st
+			rec.Message = fmt.Sprintf("%s: %s", name, msg)
+		}
+	}
+
+	return rec
+}
+
+// decodeSNMPValue decodes a value in a SNMP response.
+// Numbers are returned as int64 or uint64, and others are returned as string.
+func decodeSNMPValue(v asn1.RawValue) (interface{}, error) {
+	switch v.Class {
+	case asn1.ClassUniversal:
+		switch v.Tag {
+		case asn1.TagInteger:
+			var n int64
+			if _, err := asn1.Unmarshal(v.FullBytes, &n); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case asn1.TagOctetString:
+			return formatPayload(v.Bytes), nil
+		case asn1.TagOID:
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(v.FullBytes, &oid); err != nil {
+				return nil, err
+			}
+			return oid.String(), nil
+		case asn1.TagNull:
+			return nil, errors.New("no value")
+		}
+	case asn1.ClassApplication:
+		switch v.Tag {
+		case 0: // IpAddress
+			if len(v.Bytes) == 4 {
+				return net.IP(v.Bytes).String(), nil
+			}
+		case 1, 2, 3, 6: // Counter32, Gauge32, TimeTicks, Counter64
+			n := new(big.Int).SetBytes(v.Bytes)
+			if n.IsUint64() {
+				return n.Uint64(), nil
+			}
+		case 4: // Opaque
+			return formatPayload(v.Bytes), nil
+		}
+	case asn1.ClassContextSpecific:
+		switch v.Tag {
+		case 0:
+			return nil, errors.New("no such object")
+		case 1:
+			return nil, errors.New("no such instance")
+		case 2:
+			return nil, errors.New("end of MIB view")
+		}
+	}
+	return nil, fmt.Errorf("unsupported value type: class %d, tag %d", v.Class, v.Tag)
+}
+
+// Check checks if the value is in the bounds, and returns the status and the reason.
+func (b snmpBounds) Check(v interface{}) (api.Status, string) {
+	if b.Min == nil && b.Max == nil && b.DegradeMin == nil && b.DegradeMax == nil {
+		return api.StatusHealthy, ""
+	}
+
+	var f float64
+	switch x := v.(type) {
+	case int64:
+		f = float64(x)
+	case uint64:
+		f = float64(x)
+	default:
+		return api.StatusFailure, "value is not a number"
+	}
+
+	format := func(x float64) string {
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+
+	switch {
+	case b.Max != nil && f > *b.Max:
+		return api.StatusFailure, fmt.Sprintf("%s is larger than %s", format(f), format(*b.Max))
+	case b.Min != nil && f < *b.Min:
+		return api.StatusFailure, fmt.Sprintf("%s is smaller than %s", format(f), format(*b.Min))
+	case b.DegradeMax != nil && f > *b.DegradeMax:
+		return api.StatusDegrade, fmt.Sprintf("%s is larger than %s", format(f), format(*b.DegradeMax))
+	case b.DegradeMin != nil && f < *b.DegradeMin:
+		return api.StatusDegrade, fmt.Sprintf("%s is smaller than %s", format(f), format(*b.DegradeMin))
+	}
+	return api.StatusHealthy, ""
+}
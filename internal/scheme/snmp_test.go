@@ -0,0 +1,137 @@
+package scheme_test
+
+import (
+	"context"
+	"encoding/asn1"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/macrat/ayd/internal/testutil"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+type testSNMPVarBind struct {
+	Name  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type testSNMPPDU struct {
+	RequestID   int32
+	ErrorStatus int
+	ErrorIndex  int
+	VarBinds    []testSNMPVarBind
+}
+
+type testSNMPRequest struct {
+	Version   int
+	Community []byte
+	PDU       testSNMPPDU `asn1:"tag:0"`
+}
+
+type testSNMPResponse struct {
+	Version   int
+	Community []byte
+	PDU       testSNMPPDU `asn1:"tag:2"`
+}
+
+// StartSNMPAgent starts a stand-in SNMPv2c agent that accepts community "secret".
+// The agent doesn't respond to requests with other community, as the real agents do.
+func StartSNMPAgent(t testing.TB) string {
+	t.Helper()
+
+	integer := func(n int) asn1.RawValue {
+		b, _ := asn1.Marshal(n)
+		return asn1.RawValue{FullBytes: b}
+	}
+	values := map[string]asn1.RawValue{
+		"1.3.6.1.2.1.1.1.0":      {Class: asn1.ClassUniversal, Tag: asn1.TagOctetString, Bytes: []byte("Test Agent")},
+		"1.3.6.1.2.1.1.3.0":      {Class: asn1.ClassApplication, Tag: 3, Bytes: []byte{0x30, 0x39}},                   // TimeTicks 12345
+		"1.3.6.1.2.1.4.20.1.1.1": {Class: asn1.ClassApplication, Tag: 0, Bytes: []byte{192, 0, 2, 1}},                 // IpAddress
+		"1.3.6.1.2.1.31.1.1.1.6": {Class: asn1.ClassApplication, Tag: 6, Bytes: []byte{0x01, 0x00, 0x00, 0x00, 0x00}}, // Counter64 4294967296
+		"1.3.6.1.4.1.9999.1.0":   integer(65),
+		"1.3.6.1.2.1.2.2.1.8.1":  integer(1),
+		"1.3.6.1.2.1.2.2.1.8.2":  integer(2),
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start server: %s", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var req testSNMPRequest
+			if _, err := asn1.Unmarshal(buf[:n], &req); err != nil || string(req.Community) != "secret" {
+				continue
+			}
+
+			resp := testSNMPResponse{
+				Version:   req.Version,
+				Community: req.Community,
+				PDU:       testSNMPPDU{RequestID: req.PDU.RequestID},
+			}
+			for _, vb := range req.PDU.VarBinds {
+				v, ok := values[vb.Name.String()]
+				if !ok {
+					v = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: []byte{}} // noSuchObject
+				}
+				resp.PDU.VarBinds = append(resp.PDU.VarBinds, testSNMPVarBind{Name: vb.Name, Value: v})
+			}
+
+			b, err := asn1.Marshal(resp)
+			if err != nil {
+				panic(err)
+			}
+			conn.WriteTo(b, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestSNMPProbe(t *testing.T) {
+	t.Parallel()
+
+	addr := StartSNMPAgent(t)
+	base := "snmp://secret@" + addr
+
+	AssertProbe(t, []ProbeTest{
+		{base + "/1.3.6.1.2.1.1.1.0", api.StatusHealthy, `succeed to get values\n---\n1.3.6.1.2.1.1.1.0: Test Agent`, ""},
+		{base + "/1.3.6.1.2.1.1.3.0,1.3.6.1.2.1.4.20.1.1.1,1.3.6.1.2.1.31.1.1.1.6", api.StatusHealthy, `succeed to get values\n---\n1.3.6.1.2.1.1.3.0: 12345\n1.3.6.1.2.1.31.1.1.1.6: 4294967296\n1.3.6.1.2.1.4.20.1.1.1: 192.0.2.1`, ""},
+		{base + "/1.3.6.1.4.1.9999.1.0?degrade_max=60&max=80", api.StatusDegrade, `1.3.6.1.4.1.9999.1.0: 65 is larger than 60\n---\n1.3.6.1.4.1.9999.1.0: 65`, ""},
+		{base + "/1.3.6.1.4.1.9999.1.0?max=60", api.StatusFailure, `1.3.6.1.4.1.9999.1.0: 65 is larger than 60\n---\n1.3.6.1.4.1.9999.1.0: 65`, ""},
+		{base + "/1.3.6.1.4.1.9999.1.0?min=70", api.StatusFailure, `1.3.6.1.4.1.9999.1.0: 65 is smaller than 70\n---\n1.3.6.1.4.1.9999.1.0: 65`, ""},
+		{base + "/1.3.6.1.2.1.2.2.1.8.1?max=1", api.StatusHealthy, `succeed to get values\n---\n1.3.6.1.2.1.2.2.1.8.1: 1`, ""},
+		{base + "/1.3.6.1.2.1.2.2.1.8.1,1.3.6.1.4.1.9999.1.0,1.3.6.1.2.1.2.2.1.8.2?degrade_max=1.5&max=10", api.StatusFailure, `1.3.6.1.4.1.9999.1.0: 65 is larger than 10\n---\n1.3.6.1.2.1.2.2.1.8.1: 1\n1.3.6.1.2.1.2.2.1.8.2: 2\n1.3.6.1.4.1.9999.1.0: 65`, ""},
+		{base + "/1.3.6.1.2.1.1.1.0?max=1", api.StatusFailure, `1.3.6.1.2.1.1.1.0: value is not a number\n---\n1.3.6.1.2.1.1.1.0: Test Agent`, ""},
+		{base + "/1.3.6.1.2.1.1.99.0", api.StatusFailure, `1.3.6.1.2.1.1.99.0: no such object`, ""},
+		{base, api.StatusUnknown, "", "missing OID"},
+		{base + "/1.3.abc", api.StatusUnknown, "", "invalid OID"},
+		{base + "/1.3.6.1.2.1.1.1.0?max=abc", api.StatusUnknown, "", "invalid threshold of SNMP value"},
+		{base + "/1.3.6.1.2.1.1.1.0?version=3", api.StatusUnknown, "", "unsupported SNMP version"},
+	}, 5)
+
+	AssertTimeout(t, "snmp://public@"+addr+"/1.3.6.1.2.1.1.1.0")
+
+	p := testutil.NewProber(t, base+"/1.3.6.1.2.1.1.1.0")
+	if s := p.Target().String(); s != "snmp://xxxxx@"+addr+"/1.3.6.1.2.1.1.1.0" {
+		t.Errorf("community is not masked in the target: %s", s)
+	}
+	rs := testutil.RunProbe(context.Background(), p)
+	if len(rs) != 1 || rs[0].Status != api.StatusHealthy {
+		t.Fatalf("failed to probe with the masked target: %v", rs)
+	}
+	if s := rs[0].Target.String(); strings.Contains(s, "secret") {
+		t.Errorf("community is not masked in the record: %s", s)
+	}
+}
@@ -1,9 +1,14 @@
 package scheme
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
+	"io"
 	"net"
+	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
@@ -11,22 +16,39 @@ import (
 )
 
 var (
-	ErrTCPPortMissing = errors.New("TCP target's port number is required")
+	ErrTCPPortMissing   = errors.New("TCP target's port number is required")
+	ErrInvalidTCPExpect = errors.New("invalid regular expression in expect query")
 )
 
+// maxTCPBanner is the maximum size of the response that TCPProbe reads.
+const maxTCPBanner = 4 * 1024
+
 // TCPProbe is a Prober implementation for the TCP.
+//
+// It only checks the connection in default.
+// If the "send" or "expect" query is set, it sends the payload and checks the response, like "tcp://example.com:25?expect=^220".
+// The "tcp+tls" scheme performs TLS handshake after connect.
 type TCPProbe struct {
 	target *api.URL
+	tls    bool
+	send   []byte
+	expect *regexp.Regexp
 }
 
 func NewTCPProbe(u *api.URL) (TCPProbe, error) {
-	scheme, separator, _ := SplitScheme(u.Scheme)
+	scheme, separator, variant := SplitScheme(u.Scheme)
+
+	s := TCPProbe{target: &api.URL{Scheme: scheme, Host: strings.ToLower(u.Host), Fragment: u.Fragment}}
 
-	if separator != 0 {
+	switch {
+	case separator == 0:
+	case separator == '+' && variant == "tls":
+		s.tls = true
+		s.target.Scheme = scheme + "+tls"
+	default:
 		return TCPProbe{}, ErrUnsupportedScheme
 	}
 
-	s := TCPProbe{&api.URL{Scheme: scheme, Host: strings.ToLower(u.Host), Fragment: u.Fragment}}
 	if u.Host == "" {
 		s.target.Host = strings.ToLower(u.Opaque)
 	}
@@ -38,6 +60,24 @@ func NewTCPProbe(u *api.URL) (TCPProbe, error) {
 		return TCPProbe{}, ErrTCPPortMissing
 	}
 
+	query := u.ToURL().Query()
+	q := url.Values{}
+	var err error
+
+	if send := query.Get("send"); send != "" {
+		if s.send, err = parsePayload(send); err != nil {
+			return TCPProbe{}, err
+		}
+		q.Set("send", send)
+	}
+	if expect := query.Get("expect"); expect != "" {
+		if s.expect, err = regexp.Compile(expect); err != nil {
+			return TCPProbe{}, ErrInvalidTCPExpect
+		}
+		q.Set("expect", expect)
+	}
+	s.target.RawQuery = q.Encode()
+
 	return s, nil
 }
 
@@ -45,14 +85,26 @@ func (s TCPProbe) Target() *api.URL {
 	return s.target
 }
 
+func (s TCPProbe) dial(ctx context.Context) (net.Conn, error) {
+	network, _, _ := SplitScheme(s.target.Scheme)
+
+	if s.tls {
+		dialer := tls.Dialer{
+			Config: newTLSConfig(s.target.ToURL().Hostname()),
+		}
+		return dialer.DialContext(ctx, network, s.target.Host)
+	}
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, s.target.Host)
+}
+
 func (s TCPProbe) Probe(ctx context.Context, r Reporter) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	var dialer net.Dialer
-
 	st := time.Now()
-	conn, err := dialer.DialContext(ctx, s.target.Scheme, s.target.Host)
+	conn, err := s.dial(ctx)
 	d := time.Since(st)
 
 	rec := api.Record{
@@ -80,8 +132,71 @@ func (s TCPProbe) Probe(ctx context.Context, r Reporter) {
 			"source_addr": conn.LocalAddr().String(),
 			"target_addr": conn.RemoteAddr().String(),
 		}
+		if c, ok := conn.(*tls.Conn); ok {
+			setTLSExtra(rec.Extra, c.ConnectionState())
+		}
+
+		if s.send != nil || s.expect != nil {
+			s.communicate(ctx, conn, &rec)
+		}
+
 		conn.Close()
 	}
 
 	r.Report(s.target, timeoutOr(ctx, rec))
 }
+
+// communicate sends the payload and reads the response, then checks if the response matches to the expect pattern.
+// The response is recorded as "banner" in the Extra of the record.
+func (s TCPProbe) communicate(ctx context.Context, conn net.Conn, rec *api.Record) {
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if len(s.send) > 0 {
+		if _, err := conn.Write(s.send); err != nil {
+			rec.Status = api.StatusFailure
+			rec.Message = err.Error()
+			return
+		}
+	}
+
+	var resp []byte
+	buf := make([]byte, maxTCPBanner)
+	for len(resp) < maxTCPBanner {
+		n, err := conn.Read(buf[:maxTCPBanner-len(resp)])
+		resp = append(resp, buf[:n]...)
+
+		if n > 0 && ctx.Err() == nil {
+			// Wait a little more for the rest of the response, but don't wait until timeout.
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+		}
+
+		if s.expect == nil && len(resp) > 0 {
+			break
+		}
+		if s.expect != nil && s.expect.Match(resp) {
+			break
+		}
+		if err != nil {
+			var netErr net.Error
+			if len(resp) > 0 && (errors.Is(err, io.EOF) || (errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil)) {
+				break
+			}
+			rec.Status = api.StatusFailure
+			rec.Message = err.Error()
+			if len(resp) > 0 {
+				rec.Extra["banner"] = formatPayload(bytes.TrimRight(resp, "\r\n"))
+			}
+			return
+		}
+	}
+
+	rec.Extra["banner"] = formatPayload(bytes.TrimRight(resp, "\r\n"))
+
+	if s.expect != nil && !s.expect.Match(resp) {
+		rec.Status = api.StatusFailure
+		rec.Message = "unexpected response"
+	}
+}
@@ -1,7 +1,12 @@
 package scheme_test
 
 import (
+	"bufio"
 	"context"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -23,6 +28,68 @@ func TestTCPScheme_Probe(t *testing.T) {
 	}, 10)
 }
 
+// StartTCPBannerServer starts a TCP server that sends the greeting on connect, and replies "echo:" and the received line for each line.
+func StartTCPBannerServer(t testing.TB, greeting string) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start TCP server: %s", err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+				if greeting != "" {
+					conn.Write([]byte(greeting + "\r\n"))
+				}
+				s := bufio.NewScanner(conn)
+				for s.Scan() {
+					conn.Write([]byte("echo:" + s.Text() + "\r\n"))
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestTCPScheme_Probe_banner(t *testing.T) {
+	t.Parallel()
+
+	greet := StartTCPBannerServer(t, "220 hello")
+	echo := StartTCPBannerServer(t, "")
+
+	tlsServer := httptest.NewUnstartedServer(nil)
+	tlsServer.Config.ErrorLog = log.New(io.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	tlsAddr := strings.TrimPrefix(tlsServer.URL, "https://")
+
+	AssertProbe(t, []ProbeTest{
+		{"tcp://" + greet + "?expect=%5E220", api.StatusHealthy, "succeed to connect\n---\nbanner: 220 hello\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + greet, ""},
+		{"tcp://" + greet + "?expect=%5E500", api.StatusFailure, "unexpected response\n---\nbanner: 220 hello\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + greet, ""},
+		{"tcp://" + echo + "?expect=echo%3Ahello&send=hello%0A", api.StatusHealthy, "succeed to connect\n---\nbanner: echo:hello\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + echo, ""},
+		{"tcp://" + echo + "?send=hex%3A776f726c640a", api.StatusHealthy, "succeed to connect\n---\nbanner: echo:world\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + echo, ""},
+
+		{"tcp+tls://" + tlsAddr, api.StatusFailure, "tls: failed to verify certificate: x509: .+", ""},
+		{"tcp://" + greet + "?expect=%28", api.StatusUnknown, "", "invalid regular expression in expect query"},
+		{"tcp://" + greet + "?send=hex%3Axyz", api.StatusUnknown, "", "invalid hex payload"},
+	}, 5)
+
+	AssertTimeout(t, "tcp://"+echo+"?expect=never")
+}
+
 func BenchmarkTCPScheme(b *testing.B) {
 	server := RunDummyHTTPServer()
 	defer server.Close()
@@ -0,0 +1,32 @@
+package scheme
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sync/atomic"
+	"time"
+)
+
+// tlsRootCAs is the certificate pool to verify servers.
+// It uses the system pool if nil.
+var tlsRootCAs atomic.Pointer[x509.CertPool]
+
+// newTLSConfig makes a tls.Config to connect to the server.
+func newTLSConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		ServerName: serverName,
+		RootCAs:    tlsRootCAs.Load(),
+	}
+}
+
+// setTLSExtra records the TLS version and the server certificate into the extra of a record.
+func setTLSExtra(extra map[string]interface{}, state tls.ConnectionState) {
+	extra["tls_version"] = tls.VersionName(state.Version)
+
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		extra["certificate_subject"] = cert.Subject.String()
+		extra["certificate_issuer"] = cert.Issuer.String()
+		extra["certificate_expires"] = cert.NotAfter.UTC().Format(time.RFC3339)
+	}
+}
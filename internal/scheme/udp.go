@@ -0,0 +1,160 @@
+package scheme
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrUDPPortMissing = errors.New("UDP target's port number is required")
+)
+
+// maxUDPResponse is the maximum size of the response that UDPProbe receives.
+const maxUDPResponse = 64 * 1024
+
+// UDPProbe is a Prober implementation for the UDP.
+// It sends a datagram, and checks the response.
+type UDPProbe struct {
+	target *api.URL
+	send   []byte
+	expect []byte
+}
+
+func NewUDPProbe(u *api.URL) (UDPProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+
+	if separator != 0 {
+		return UDPProbe{}, ErrUnsupportedScheme
+	}
+
+	s := UDPProbe{target: &api.URL{Scheme: scheme, Host: strings.ToLower(u.Host), Fragment: u.Fragment}}
+	if u.Host == "" {
+		s.target.Host = strings.ToLower(u.Opaque)
+	}
+
+	if s.target.ToURL().Hostname() == "" {
+		return UDPProbe{}, ErrMissingHost
+	}
+	if s.target.ToURL().Port() == "" {
+		return UDPProbe{}, ErrUDPPortMissing
+	}
+
+	query := u.ToURL().Query()
+	q := url.Values{}
+	var err error
+
+	if send := query.Get("send"); send != "" {
+		if s.send, err = parsePayload(send); err != nil {
+			return UDPProbe{}, err
+		}
+		q.Set("send", send)
+	}
+	if expect := query.Get("expect"); expect != "" {
+		if s.expect, err = parsePayload(expect); err != nil {
+			return UDPProbe{}, err
+		}
+		q.Set("expect", expect)
+	}
+	s.target.RawQuery = q.Encode()
+
+	return s, nil
+}
+
+func (s UDPProbe) Target() *api.URL {
+	return s.target
+}
+
+func (s UDPProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := s.probe(ctx)
+	rec.Time = st
+	rec.Target = s.target
+
+	r.Report(s.target, timeoutOr(ctx, rec))
+}
+
+func (s UDPProbe) probe(ctx context.Context) api.Record {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, s.target.Scheme, s.target.Host)
+	if err != nil {
+		rec := api.Record{
+			Status:  api.StatusFailure,
+			Message: err.Error(),
+		}
+
+		dnsErr := &net.DNSError{}
+		if errors.As(err, &dnsErr) {
+			rec.Status = api.StatusUnknown
+			rec.Message = dnsErrorToMessage(dnsErr)
+		}
+		return rec
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	extra := map[string]interface{}{
+		"source_addr": conn.LocalAddr().String(),
+		"target_addr": conn.RemoteAddr().String(),
+	}
+
+	st := time.Now()
+	if _, err := conn.Write(s.send); err != nil {
+		return udpErrorRecord(err, time.Since(st), extra)
+	}
+
+	buf := make([]byte, maxUDPResponse)
+	n, err := conn.Read(buf)
+	latency := time.Since(st)
+	if err != nil {
+		return udpErrorRecord(err, latency, extra)
+	}
+	resp := buf[:n]
+
+	extra["response_size"] = n
+
+	rec := api.Record{
+		Status:  api.StatusHealthy,
+		Latency: latency,
+		Message: "succeed to receive response",
+		Extra:   extra,
+	}
+
+	if s.expect != nil && !bytes.Contains(resp, s.expect) {
+		rec.Status = api.StatusFailure
+		rec.Message = "unexpected response"
+		extra["response"] = formatPayload(resp)
+	}
+
+	return rec
+}
+
+// udpErrorRecord makes a record for an error while sending or receiving a datagram.
+// The connection refused error, that caused by ICMP port unreachable, is reported as "port unreachable".
+func udpErrorRecord(err error, latency time.Duration, extra map[string]interface{}) api.Record {
+	rec := api.Record{
+		Status:  api.StatusFailure,
+		Latency: latency,
+		Message: err.Error(),
+		Extra:   extra,
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		rec.Message = "port unreachable"
+	}
+	return rec
+}
@@ -0,0 +1,58 @@
+package scheme_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// StartUDPEchoServer starts a UDP server that replies "pong:" and the received payload.
+// It doesn't reply to the payload "ignore".
+func StartUDPEchoServer(t testing.TB) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start UDP server: %s", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if bytes.Equal(buf[:n], []byte("ignore")) {
+				continue
+			}
+			conn.WriteTo(append([]byte("pong:"), buf[:n]...), addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestUDPScheme_Probe(t *testing.T) {
+	t.Parallel()
+
+	addr := StartUDPEchoServer(t)
+
+	AssertProbe(t, []ProbeTest{
+		{"udp://" + addr + "?send=ping", api.StatusHealthy, "succeed to receive response\n---\nresponse_size: 9\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + addr, ""},
+		{"udp://" + addr + "?expect=pong%3Ahello&send=hello", api.StatusHealthy, "succeed to receive response\n---\nresponse_size: 10\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + addr, ""},
+		{"udp://" + addr + "?expect=hex%3A706f6e673a01ff&send=hex%3A01ff", api.StatusHealthy, "succeed to receive response\n---\nresponse_size: 7\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + addr, ""},
+		{"udp://" + addr + "?expect=world&send=hello", api.StatusFailure, "unexpected response\n---\nresponse: pong:hello\nresponse_size: 10\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + addr, ""},
+		{"udp://" + addr + "?expect=world&send=hex%3A00", api.StatusFailure, "unexpected response\n---\nresponse: hex:706f6e673a00\nresponse_size: 6\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + addr, ""},
+
+		{"udp://localhost", api.StatusUnknown, ``, "UDP target's port number is required"},
+		{"udp://localhost:1234?send=hex%3Axyz", api.StatusUnknown, ``, "invalid hex payload"},
+	}, 5)
+
+	AssertTimeout(t, "udp://"+addr+"?send=ignore")
+}
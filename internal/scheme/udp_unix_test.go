@@ -0,0 +1,26 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package scheme_test
+
+import (
+	"net"
+	"testing"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+func TestUDPScheme_portUnreachable(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	AssertProbe(t, []ProbeTest{
+		{"udp://" + addr + "?send=hello", api.StatusFailure, "port unreachable\n---\nsource_addr: 127.0.0.1:[0-9]+\ntarget_addr: " + addr, ""},
+	}, 5)
+}
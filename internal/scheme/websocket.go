@@ -0,0 +1,449 @@
+package scheme
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrInvalidWebSocketExpect = errors.New("invalid regular expression in expect query")
+)
+
+const (
+	// websocketGUID is the magic string to calculate Sec-WebSocket-Accept header.
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// maxWebSocketMessage is the maximum size of a message that WebSocketProbe receives.
+	maxWebSocketMessage = 1024 * 1024
+
+	websocketOpContinuation = 0x0
+	websocketOpText         = 0x1
+	websocketOpBinary       = 0x2
+	websocketOpClose        = 0x8
+	websocketOpPing         = 0x9
+	websocketOpPong         = 0xA
+)
+
+// WebSocketProbe is a Prober implementation for the WebSocket.
+//
+// It performs the opening handshake, and closes the connection.
+// If the "send" or "expect" query is set, it sends the message and waits for the response, like "ws://example.com/chat?send=ping&expect=pong".
+type WebSocketProbe struct {
+	target  *api.URL
+	request *url.URL
+	send    []byte
+	binary  bool
+	expect  *regexp.Regexp
+}
+
+func NewWebSocketProbe(u *api.URL) (WebSocketProbe, error) {
+	scheme, separator, _ := SplitScheme(u.Scheme)
+	if separator != 0 {
+		return WebSocketProbe{}, ErrUnsupportedScheme
+	}
+
+	p := WebSocketProbe{
+		target: &api.URL{Scheme: scheme, Host: strings.ToLower(u.Host), Path: u.Path, RawQuery: u.RawQuery, Fragment: u.Fragment},
+	}
+	if p.target.ToURL().Hostname() == "" {
+		return WebSocketProbe{}, ErrMissingHost
+	}
+	if p.target.Path == "" {
+		p.target.Path = "/"
+	}
+
+	query := u.ToURL().Query()
+	var err error
+
+	if send := query.Get("send"); send != "" {
+		if p.send, err = parsePayload(send); err != nil {
+			return WebSocketProbe{}, err
+		}
+		p.binary = strings.HasPrefix(send, "hex:")
+	}
+	if expect := query.Get("expect"); expect != "" {
+		if p.expect, err = regexp.Compile(expect); err != nil {
+			return WebSocketProbe{}, ErrInvalidWebSocketExpect
+		}
+	}
+
+	// The "send" and "expect" queries are for Ayd, so don't send them to the server.
+	query.Del("send")
+	query.Del("expect")
+	p.request = &url.URL{Path: p.target.Path, RawQuery: query.Encode()}
+
+	return p, nil
+}
+
+func (p WebSocketProbe) Target() *api.URL {
+	return p.target
+}
+
+func (p WebSocketProbe) address() string {
+	u := p.target.ToURL()
+	if u.Port() != "" {
+		return u.Host
+	}
+	if p.target.Scheme == "wss" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+func (p WebSocketProbe) dial(ctx context.Context) (net.Conn, error) {
+	if p.target.Scheme == "wss" {
+		dialer := tls.Dialer{
+			Config: newTLSConfig(p.target.ToURL().Hostname()),
+		}
+		return dialer.DialContext(ctx, "tcp", p.address())
+	}
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", p.address())
+}
+
+func (p WebSocketProbe) Probe(ctx context.Context, r Reporter) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	st := time.Now()
+	rec := p.probe(ctx)
+	rec.Time = st
+	rec.Target = p.target
+	rec.Latency = time.Since(st)
+
+	r.Report(p.target, timeoutOr(ctx, rec))
+}
+
+func (p WebSocketProbe) probe(ctx context.Context) api.Record {
+	st := time.Now()
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		rec := api.Record{
+			Status:  api.StatusFailure,
+			Message: err.Error(),
+		}
+
+		dnsErr := &net.DNSError{}
+		if errors.As(err, &dnsErr) {
+			rec.Status = api.StatusUnknown
+			rec.Message = dnsErrorToMessage(dnsErr)
+		}
+		return rec
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	extra := map[string]interface{}{}
+	if tc, ok := conn.(*tls.Conn); ok {
+		setTLSExtra(extra, tc.ConnectionState())
+	}
+
+	c := websocketConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if err := c.handshake(p.target.Host, p.request.RequestURI()); err != nil {
+		var statusErr websocketStatusError
+		if errors.As(err, &statusErr) {
+			extra["status_code"] = int(statusErr)
+		}
+		return api.Record{
+			Status:  api.StatusFailure,
+			Message: err.Error(),
+			Extra:   extra,
+		}
+	}
+	extra["handshake_latency"] = milliseconds(time.Since(st))
+
+	rec := api.Record{
+		Status:  api.StatusHealthy,
+		Message: "succeed to handshake",
+		Extra:   extra,
+	}
+
+	if p.send != nil || p.expect != nil {
+		if !p.communicate(&c, &rec) {
+			return rec
+		}
+	}
+
+	if code, err := c.close(); err == nil {
+		extra["close_code"] = code
+	}
+
+	return rec
+}
+
+// communicate sends the message and waits for the response that matches to the expect pattern.
+// It returns false if the connection is already closed.
+func (p WebSocketProbe) communicate(c *websocketConn, rec *api.Record) bool {
+	if p.send != nil {
+		op := byte(websocketOpText)
+		if p.binary {
+			op = websocketOpBinary
+		}
+		if err := c.writeFrame(op, p.send); err != nil {
+			rec.Status = api.StatusFailure
+			rec.Message = err.Error()
+			return false
+		}
+	}
+
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			rec.Status = api.StatusFailure
+			rec.Message = err.Error()
+
+			var closeErr websocketCloseError
+			if errors.As(err, &closeErr) {
+				rec.Extra["close_code"] = closeErr.Code
+				if closeErr.Reason != "" {
+					rec.Extra["close_reason"] = closeErr.Reason
+				}
+			}
+			return false
+		}
+
+		rec.Extra["response"] = formatPayload(msg)
+
+		if p.expect == nil || p.expect.Match(msg) {
+			rec.Message = "succeed to receive response"
+			return true
+		}
+	}
+}
+
+// websocketStatusError is an error that the server responded to the handshake with a status other than 101.
+type websocketStatusError int
+
+func (e websocketStatusError) Error() string {
+	return fmt.Sprintf("failed to upgrade: %d %s", int(e), http.StatusText(int(e)))
+}
+
+// websocketCloseError is an error that the server closed the connection.
+type websocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e websocketCloseError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("connection closed by server: %d %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("connection closed by server: %d", e.Code)
+}
+
+// websocketConn is a client side connection of the WebSocket protocol.
+type websocketConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *websocketConn) handshake(host, requestURI string) error {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Opaque: requestURI},
+		Host:   host,
+		Header: http.Header{
+			"User-Agent":            {HTTPUserAgent},
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if err := req.Write(c.conn); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(c.r, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return websocketStatusError(resp.StatusCode)
+	}
+
+	h := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(h[:]) {
+		return errors.New("invalid Sec-WebSocket-Accept header")
+	}
+
+	return nil
+}
+
+// writeFrame sends a single frame with the mask, as the client must do.
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	buf := []byte{0x80 | opcode}
+
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, 0x80|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, 0x80|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 0x80|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	buf = append(buf, mask[:]...)
+
+	for i, b := range payload {
+		buf = append(buf, b^mask[i%4])
+	}
+
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// readFrame reads a single frame.
+func (c *websocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > maxWebSocketMessage {
+		err = errors.New("too large message")
+		return
+	}
+
+	var mask [4]byte
+	if head[1]&0x80 != 0 {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	if head[1]&0x80 != 0 {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return
+}
+
+// readMessage reads a text or binary message.
+// It replies to ping frames, and returns websocketCloseError if the server sent a close frame.
+func (c *websocketConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case websocketOpPing:
+			if err := c.writeFrame(websocketOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case websocketOpPong:
+			continue
+		case websocketOpClose:
+			return nil, parseWebSocketClose(payload)
+		case websocketOpText, websocketOpBinary, websocketOpContinuation:
+			msg = append(msg, payload...)
+			if len(msg) > maxWebSocketMessage {
+				return nil, errors.New("too large message")
+			}
+		default:
+			return nil, fmt.Errorf("unexpected opcode: %d", opcode)
+		}
+
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// close sends a close frame with the normal closure code, and returns the close code that the server replied.
+func (c *websocketConn) close() (int, error) {
+	var payload [2]byte
+	binary.BigEndian.PutUint16(payload[:], 1000)
+	if err := c.writeFrame(websocketOpClose, payload[:]); err != nil {
+		return 0, err
+	}
+
+	// Don't wait long for the reply, because some servers just close the connection.
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	for {
+		_, err := c.readMessage()
+		var closeErr websocketCloseError
+		if errors.As(err, &closeErr) {
+			return closeErr.Code, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// parseWebSocketClose parses the payload of a close frame.
+func parseWebSocketClose(payload []byte) websocketCloseError {
+	if len(payload) < 2 {
+		// 1005 means that no status code was present.
+		return websocketCloseError{Code: 1005}
+	}
+	return websocketCloseError{
+		Code:   int(binary.BigEndian.Uint16(payload[:2])),
+		Reason: string(payload[2:]),
+	}
+}
@@ -0,0 +1,60 @@
+package scheme_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	api "github.com/macrat/ayd/lib-ayd"
+	"golang.org/x/net/websocket"
+)
+
+// StartWebSocketServer starts a WebSocket server for testing.
+//
+// The server has below endpoints.
+//   - /echo replies "pong:" and the received message.
+//   - /close closes the connection without any message.
+//   - /http is just a HTTP endpoint that doesn't upgrade.
+func StartWebSocketServer(t testing.TB) string {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle("/echo", websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		var msg string
+		for websocket.Message.Receive(ws, &msg) == nil {
+			websocket.Message.Send(ws, "pong:"+msg)
+		}
+	}})
+	mux.Handle("/close", websocket.Server{Handler: func(ws *websocket.Conn) {
+		ws.Close()
+	}})
+	mux.HandleFunc("/http", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello world")
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestWebSocketProbe(t *testing.T) {
+	t.Parallel()
+
+	addr := StartWebSocketServer(t)
+
+	AssertProbe(t, []ProbeTest{
+		{"ws://" + addr + "/echo", api.StatusHealthy, `succeed to handshake\n---\nclose_code: 1000\nhandshake_latency: [0-9.]+`, ""},
+		{"ws://" + addr + "/echo?send=hello", api.StatusHealthy, `succeed to receive response\n---\nclose_code: 1000\nhandshake_latency: [0-9.]+\nresponse: pong:hello`, ""},
+		{"ws://" + addr + "/echo?send=hello&expect=^pong:hel%2Bo$", api.StatusHealthy, `succeed to receive response\n---\nclose_code: 1000\nhandshake_latency: [0-9.]+\nresponse: pong:hello`, ""},
+		{"ws://" + addr + "/close?expect=hello", api.StatusFailure, `connection closed by server: 1000\n---\nclose_code: 1000\nhandshake_latency: [0-9.]+`, ""},
+		{"ws://" + addr + "/http", api.StatusFailure, `failed to upgrade: 200 OK\n---\nstatus_code: 200`, ""},
+		{"ws://" + addr + "/echo?expect=(", api.StatusUnknown, "", "invalid regular expression in expect query"},
+	}, 5)
+
+	AssertTimeout(t, "ws://"+addr+"/echo?send=hello&expect=never")
+}
@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/macrat/ayd/internal/logconv"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// fileWriter appends records to a file, like "file:/var/log/ayd.ltsv?format=ltsv".
+// The file is opened for each batch, so that it works well with external log rotation tools.
+type fileWriter struct {
+	path   string
+	format logconv.Format
+}
+
+func newFileWriter(u *url.URL, format logconv.Format) (*fileWriter, error) {
+	path := u.Opaque
+	if path == "" {
+		path = u.Path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("missing file path")
+	}
+
+	return &fileWriter{
+		path:   filepath.FromSlash(path),
+		format: format,
+	}, nil
+}
+
+func (w *fileWriter) WriteRecords(rs []api.Record) error {
+	var sb strings.Builder
+	for _, r := range rs {
+		sb.WriteString(w.format.Line(r, false))
+		sb.WriteByte('\n')
+	}
+
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(sb.String())
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (w *fileWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/macrat/ayd/internal/logconv"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// httpWriter sends records to a HTTP server by POST method, in batch.
+// The request body has a record per line, in JSON Lines format by default.
+type httpWriter struct {
+	url         string
+	user        *url.Userinfo
+	format      logconv.Format
+	contentType string
+	client      *http.Client
+}
+
+func newHTTPWriter(u *url.URL, format logconv.Format) (*httpWriter, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing HTTP server host")
+	}
+
+	x := *u
+	x.User = nil
+	q := x.Query()
+	if q.Has("format") {
+		q.Del("format")
+		x.RawQuery = q.Encode()
+	}
+
+	contentType := "application/x-ndjson"
+	if format != logconv.FormatJSON {
+		contentType = "text/plain; charset=UTF-8"
+	}
+
+	return &httpWriter{
+		url:         x.String(),
+		user:        u.User,
+		format:      format,
+		contentType: contentType,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (w *httpWriter) WriteRecords(rs []api.Record) error {
+	var body bytes.Buffer
+	for _, r := range rs {
+		body.WriteString(w.format.Line(r, false))
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.contentType)
+	if w.user != nil {
+		password, _ := w.user.Password()
+		req.SetBasicAuth(w.user.Username(), password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// The error from http.Client includes the URL that can have secrets, so it is removed here.
+		// The errors are reported with the masked URL by Sink.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			return ue.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *httpWriter) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
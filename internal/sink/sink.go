@@ -0,0 +1,240 @@
+// Package sink implements log sinks that receive every record in addition to the log file, like syslog or remote HTTP servers.
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/macrat/ayd/internal/logconv"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+const (
+	// queueSize is the number of records that can be buffered in a Sink.
+	// The new records are dropped if the queue is full, so that a slow sink never blocks the caller.
+	queueSize = 1024
+
+	// maxBatch is the maximum number of records passed to Writer at once.
+	maxBatch = 100
+
+	// errorInterval is the minimum interval to report errors of a Sink.
+	errorInterval = time.Minute
+)
+
+var (
+	ErrUnsupportedScheme = errors.New("unsupported scheme for log sink")
+)
+
+// Writer writes records to somewhere.
+type Writer interface {
+	// WriteRecords writes records.
+	WriteRecords([]api.Record) error
+
+	// Close closes the Writer.
+	Close() error
+}
+
+// NewWriter makes a Writer from URL.
+// It doesn't connect to the destination until the first write.
+func NewWriter(u *url.URL) (Writer, error) {
+	format, err := logconv.ParseFormat(u.Query().Get("format"))
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "syslog", "syslog+udp", "syslog+tcp", "syslog+unix":
+		return newSyslogWriter(u, format)
+	case "http", "https":
+		return newHTTPWriter(u, format)
+	case "file":
+		return newFileWriter(u, format)
+	default:
+		return nil, ErrUnsupportedScheme
+	}
+}
+
+// Check checks if the URL is valid as a log sink.
+func Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	w, err := NewWriter(u)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// Sink sends records to a Writer in background.
+type Sink struct {
+	// URL is the URL of the sink, that the secrets are masked.
+	URL string
+
+	target  *api.URL
+	masker  api.SecretMasker
+	writer  Writer
+	queue   chan api.Record
+	stopped chan struct{}
+	onError func(name string, err error)
+
+	// interval is the time to wait for more records before writing a batch.
+	interval time.Duration
+
+	mu        sync.Mutex
+	closed    bool
+	dropped   uint64
+	errors    uint64
+	lastError time.Time
+}
+
+// Open opens a Sink by URL.
+// The secrets in the URL are masked by masker, in both of Sink.URL and the errors.
+// The errors in background, like failed to send or dropped records, are passed to onError with Sink.URL at most once a minute.
+// The onError is called from the goroutine of the Sink, never from Send.
+func Open(rawURL string, masker api.SecretMasker, onError func(name string, err error)) (*Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := NewWriter(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSink((*api.URL)(u), masker, w, onError), nil
+}
+
+func newSink(target *api.URL, masker api.SecretMasker, w Writer, onError func(name string, err error)) *Sink {
+	s := &Sink{
+		URL:     masker.MaskURL(target).String(),
+		target:  target,
+		masker:  masker,
+		writer:  w,
+		queue:   make(chan api.Record, queueSize),
+		stopped: make(chan struct{}),
+		onError: onError,
+	}
+	if _, ok := w.(*httpWriter); ok {
+		s.interval = time.Second
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Send queues a record to send.
+// It never blocks. The record is dropped if the queue is full, or the Sink is already closed.
+func (s *Sink) Send(r api.Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.queue <- r:
+	default:
+		// The dropped records are reported by the goroutine of the Sink, because Send can be called while reporting an error.
+		s.dropped++
+	}
+}
+
+// reportError reports an error, and the number of dropped records, to onError.
+// It suppresses errors that happen within errorInterval since the last report, and reports them with the next one.
+// The err can be nil to report only the dropped records.
+func (s *Sink) reportError(err error) {
+	s.mu.Lock()
+	if err != nil {
+		s.errors++
+	}
+	if s.onError == nil || (err == nil && s.dropped == 0) || time.Since(s.lastError) < errorInterval {
+		s.mu.Unlock()
+		return
+	}
+	dropped, errCount := s.dropped, s.errors
+	s.dropped, s.errors = 0, 0
+	s.lastError = time.Now()
+	s.mu.Unlock()
+
+	var msgs []string
+	if err != nil {
+		msgs = append(msgs, err.Error())
+	}
+	if errCount > 1 {
+		msgs = append(msgs, fmt.Sprintf("%d errors in total", errCount))
+	}
+	if dropped > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d records dropped because the sink is too slow", dropped))
+	}
+	s.onError(s.URL, errors.New(s.masker.MaskMessage(s.target, strings.Join(msgs, ", "))))
+}
+
+func (s *Sink) run() {
+	defer close(s.stopped)
+
+	batch := make([]api.Record, 0, maxBatch)
+
+	for r := range s.queue {
+		batch = s.collect(append(batch[:0], r))
+
+		s.reportError(s.writer.WriteRecords(batch))
+	}
+}
+
+// collect appends the queued records to the batch.
+// It waits for more records up to the interval, or returns immediately if the interval is 0.
+func (s *Sink) collect(batch []api.Record) []api.Record {
+	var timeout <-chan time.Time
+	if s.interval > 0 {
+		t := time.NewTimer(s.interval)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	for len(batch) < maxBatch {
+		if timeout == nil {
+			select {
+			case r, ok := <-s.queue:
+				if !ok {
+					return batch
+				}
+				batch = append(batch, r)
+			default:
+				return batch
+			}
+		} else {
+			select {
+			case r, ok := <-s.queue:
+				if !ok {
+					return batch
+				}
+				batch = append(batch, r)
+			case <-timeout:
+				return batch
+			}
+		}
+	}
+
+	return batch
+}
+
+// Close sends the queued records, and closes the Sink.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	<-s.stopped
+	return s.writer.Close()
+}
@@ -0,0 +1,289 @@
+package sink_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/ayd/internal/sink"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+func testRecords() []api.Record {
+	return []api.Record{
+		{
+			Time:    time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC),
+			Status:  api.StatusHealthy,
+			Target:  &api.URL{Scheme: "dummy", Opaque: "healthy"},
+			Message: "hello",
+		},
+		{
+			Time:    time.Date(2021, 1, 2, 15, 4, 6, 0, time.UTC),
+			Status:  api.StatusFailure,
+			Target:  &api.URL{Scheme: "dummy", Opaque: "failure"},
+			Message: "world",
+		},
+	}
+}
+
+func openSink(t *testing.T, u string) *sink.Sink {
+	t.Helper()
+
+	s, err := sink.Open(u, api.SecretMasker{}, func(_ string, err error) {
+		t.Errorf("unexpected error: %s", err)
+	})
+	if err != nil {
+		t.Fatalf("failed to open sink: %s", err)
+	}
+	return s
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		URL   string
+		Error string
+	}{
+		{"syslog://localhost", ""},
+		{"syslog+tcp://localhost:1514?facility=local0", ""},
+		{"syslog:", ""},
+		{"syslog:/var/run/syslog", ""},
+		{"https://example.com/logs?format=ltsv", ""},
+		{"file:/path/to/file.log?format=text", ""},
+		{"ftp://example.com", "unsupported scheme for log sink"},
+		{"syslog+tcp://", "missing syslog server host"},
+		{"syslog://localhost?facility=foo", "unsupported syslog facility: foo"},
+		{"https:///logs", "missing HTTP server host"},
+		{"file:", "missing file path"},
+		{"file:/path/to/file.log?format=csv", "unsupported log format: csv"},
+	}
+
+	for _, tt := range tests {
+		err := sink.Check(tt.URL)
+		if tt.Error == "" && err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.URL, err)
+		} else if tt.Error != "" && (err == nil || err.Error() != tt.Error) {
+			t.Errorf("%s: expected error %q but got %v", tt.URL, tt.Error, err)
+		}
+	}
+}
+
+func TestSink_file(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sink.ltsv")
+
+	s := openSink(t, "file:"+filepath.ToSlash(path)+"?format=ltsv")
+	for _, r := range testRecords() {
+		s.Send(r)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close sink: %s", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %s", err)
+	}
+
+	want := "time:2021-01-02T15:04:05Z\tstatus:HEALTHY\tlatency:0.000\ttarget:dummy:healthy\tmessage:hello\n" +
+		"time:2021-01-02T15:04:06Z\tstatus:FAILURE\tlatency:0.000\ttarget:dummy:failure\tmessage:world\n"
+	if string(raw) != want {
+		t.Errorf("unexpected output\nexpected: %q\n but got: %q", want, string(raw))
+	}
+}
+
+func TestSink_http(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var lines []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("unexpected content type: %s", ct)
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "foo" || pass != "bar" {
+			t.Errorf("unexpected basic auth: %s:%s", user, pass)
+		}
+		if r.URL.RawQuery != "key=value" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	u := strings.Replace(srv.URL, "http://", "http://foo:bar@", 1) + "/logs?key=value"
+	s := openSink(t, u)
+	if s.URL != strings.Replace(u, ":bar@", ":xxxxx@", 1) {
+		t.Errorf("password is not masked: %s", s.URL)
+	}
+
+	for _, r := range testRecords() {
+		s.Send(r)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close sink: %s", err)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("unexpected number of lines: %d", len(lines))
+	}
+	for i, r := range testRecords() {
+		var got api.Record
+		if err := got.UnmarshalJSON([]byte(lines[i])); err != nil {
+			t.Fatalf("failed to parse line: %s", err)
+		}
+		if got.String() != r.String() {
+			t.Errorf("%d: unexpected record: %s", i, got)
+		}
+	}
+}
+
+func TestSink_http_maskSecrets(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	var mu sync.Mutex
+	var names, errs []string
+
+	u := "http://" + addr + "/ingest?token=s3cret-token&key=an0ther-secret"
+	s, err := sink.Open(u, api.NewSecretMasker("key"), func(name string, err error) {
+		mu.Lock()
+		names = append(names, name)
+		errs = append(errs, err.Error())
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("failed to open sink: %s", err)
+	}
+
+	if want := "http://" + addr + "/ingest?token=xxxxx&key=xxxxx"; s.URL != want {
+		t.Errorf("unexpected sink URL\nexpected: %s\n but got: %s", want, s.URL)
+	}
+
+	s.Send(testRecords()[0])
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close sink: %s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(errs) == 0 {
+		t.Fatalf("connection error is not reported")
+	}
+	for i := range errs {
+		if names[i] != s.URL {
+			t.Errorf("unexpected sink name: %s", names[i])
+		}
+		for _, secret := range []string{"s3cret-token", "an0ther-secret"} {
+			if strings.Contains(errs[i], secret) {
+				t.Errorf("secret is not masked in the error: %s", errs[i])
+			}
+		}
+	}
+}
+
+func TestSink_syslogUDP(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer conn.Close()
+
+	s := openSink(t, "syslog://"+conn.LocalAddr().String()+"?facility=local0&format=text")
+	s.Send(testRecords()[1])
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	s.Close()
+
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<131>1 2021-01-02T15:04:06Z ") {
+		t.Errorf("unexpected header: %q", msg)
+	}
+	if !strings.HasSuffix(msg, " - - 2021-01-02T15:04:06Z FAILURE     0.000ms dummy:failure  world") {
+		t.Errorf("unexpected message: %q", msg)
+	}
+}
+
+func TestSink_syslogTCP(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer l.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		body, _ := io.ReadAll(bufio.NewReader(conn))
+		received <- string(body)
+	}()
+
+	s := openSink(t, "syslog+tcp://"+l.Addr().String())
+	for _, r := range testRecords() {
+		s.Send(r)
+	}
+	s.Close()
+
+	var body string
+	select {
+	case body = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out")
+	}
+
+	// Each message is prefixed by its length, in octet counting framing.
+	for i := 0; i < 2; i++ {
+		size, rest, ok := strings.Cut(body, " ")
+		if !ok {
+			t.Fatalf("%d: broken framing: %q", i, body)
+		}
+		var n int
+		for _, c := range size {
+			n = n*10 + int(c-'0')
+		}
+		if len(rest) < n || !strings.HasPrefix(rest, "<") {
+			t.Fatalf("%d: broken message: %q", i, rest)
+		}
+		body = rest[n:]
+	}
+	if body != "" {
+		t.Errorf("unexpected trailing data: %q", body)
+	}
+}
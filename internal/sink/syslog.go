@@ -0,0 +1,161 @@
+package sink
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/macrat/ayd/internal/logconv"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverity converts a status to syslog severity.
+func syslogSeverity(s api.Status) int {
+	switch s {
+	case api.StatusHealthy:
+		return 6 // informational
+	case api.StatusDegrade, api.StatusUnknown:
+		return 4 // warning
+	case api.StatusFailure:
+		return 3 // error
+	default:
+		return 5 // notice
+	}
+}
+
+// syslogWriter sends records to a syslog server in RFC 5424 format.
+//
+// The URL is like "syslog://example.com:514" for UDP, "syslog+tcp://example.com:514" for TCP, or "syslog:" for the local syslog daemon.
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	format   logconv.Format
+	hostname string
+
+	conn net.Conn
+}
+
+func newSyslogWriter(u *url.URL, format logconv.Format) (*syslogWriter, error) {
+	w := &syslogWriter{
+		facility: syslogFacilities["daemon"],
+		format:   format,
+	}
+
+	if f := u.Query().Get("facility"); f != "" {
+		n, ok := syslogFacilities[strings.ToLower(f)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported syslog facility: %s", f)
+		}
+		w.facility = n
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "syslog", "syslog+udp":
+		w.network = "udp"
+	case "syslog+tcp":
+		w.network = "tcp"
+	case "syslog+unix":
+		w.network = "unixgram"
+	}
+
+	if w.network == "unixgram" || (u.Scheme == "syslog" && u.Host == "") {
+		w.network = "unixgram"
+		w.address = u.Path
+		if w.address == "" {
+			w.address = u.Opaque
+		}
+		if w.address == "" {
+			w.address = "/dev/log"
+		}
+	} else {
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("missing syslog server host")
+		}
+		w.address = u.Host
+		if u.Port() == "" {
+			w.address = net.JoinHostPort(u.Hostname(), "514")
+		}
+	}
+
+	w.hostname, _ = os.Hostname()
+	if w.hostname == "" {
+		w.hostname = "-"
+	}
+
+	return w, nil
+}
+
+// message makes a syslog message in RFC 5424 format.
+func (w *syslogWriter) message(r api.Record) string {
+	return fmt.Sprintf(
+		"<%d>1 %s %s ayd %d - - %s",
+		w.facility*8+syslogSeverity(r.Status),
+		r.Time.Format(time.RFC3339Nano),
+		w.hostname,
+		os.Getpid(),
+		w.format.Line(r, false),
+	)
+}
+
+func (w *syslogWriter) WriteRecords(rs []api.Record) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.address, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+
+	for _, r := range rs {
+		msg := w.message(r)
+		if w.network == "tcp" {
+			// Use octet counting framing of RFC 6587, because messages can include newlines.
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+
+		w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := w.conn.Write([]byte(msg)); err != nil {
+			w.conn.Close()
+			w.conn = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *syslogWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
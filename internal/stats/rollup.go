@@ -0,0 +1,138 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/goccy/go-json"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// RollupInterval is the period of a rollup.
+type RollupInterval string
+
+const (
+	RollupHourly RollupInterval = "hourly"
+	RollupDaily  RollupInterval = "daily"
+)
+
+// RollupIntervalFor returns a suitable rollup interval for showing the period.
+// It returns false if the period is short enough to show raw records.
+func RollupIntervalFor(period time.Duration) (RollupInterval, bool) {
+	switch {
+	case period > 60*24*time.Hour:
+		return RollupDaily, true
+	case period > 2*24*time.Hour:
+		return RollupHourly, true
+	default:
+		return "", false
+	}
+}
+
+// Duration returns the length of the interval.
+func (i RollupInterval) Duration() time.Duration {
+	if i == RollupDaily {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// Truncate returns the beginning of the period that includes t.
+// Periods are separated in UTC.
+func (i RollupInterval) Truncate(t time.Time) time.Time {
+	return t.UTC().Truncate(i.Duration())
+}
+
+// Rollup is a summary of the records of a target in an hour or a day.
+type Rollup struct {
+	// Time is the beginning of the period.
+	Time time.Time
+
+	Target *api.URL
+
+	// Count is the number of records by status.
+	Count map[api.Status]int
+
+	LatencyMin time.Duration
+	LatencyAvg time.Duration
+	LatencyMax time.Duration
+	LatencyP95 time.Duration
+}
+
+// Total returns the number of records in the period.
+func (r Rollup) Total() int {
+	n := 0
+	for _, c := range r.Count {
+		n += c
+	}
+	return n
+}
+
+// Availability returns the ratio of healthy records.
+// DEGRADE is counted as the half of HEALTHY, and UNKNOWN and ABORTED are not counted.
+// It returns false if there is no record to calculate.
+func (r Rollup) Availability() (float64, bool) {
+	healthy := r.Count[api.StatusHealthy]
+	degrade := r.Count[api.StatusDegrade]
+	total := healthy + degrade + r.Count[api.StatusFailure]
+	if total == 0 {
+		return 0, false
+	}
+	return (float64(healthy) + float64(degrade)/2) / float64(total), true
+}
+
+type rollupJSON struct {
+	Time       string             `json:"time"`
+	Target     string             `json:"target"`
+	Count      map[api.Status]int `json:"count"`
+	LatencyMin float64            `json:"latency_min"`
+	LatencyAvg float64            `json:"latency_avg"`
+	LatencyMax float64            `json:"latency_max"`
+	LatencyP95 float64            `json:"latency_p95"`
+}
+
+func durationToMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func msToDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func (r Rollup) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rollupJSON{
+		Time:       r.Time.UTC().Format(time.RFC3339),
+		Target:     r.Target.String(),
+		Count:      r.Count,
+		LatencyMin: durationToMs(r.LatencyMin),
+		LatencyAvg: durationToMs(r.LatencyAvg),
+		LatencyMax: durationToMs(r.LatencyMax),
+		LatencyP95: durationToMs(r.LatencyP95),
+	})
+}
+
+func (r *Rollup) UnmarshalJSON(data []byte) error {
+	var raw rollupJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	t, err := api.ParseTime(raw.Time)
+	if err != nil {
+		return err
+	}
+	target, err := api.ParseURL(raw.Target)
+	if err != nil {
+		return err
+	}
+
+	*r = Rollup{
+		Time:       t,
+		Target:     target,
+		Count:      raw.Count,
+		LatencyMin: msToDuration(raw.LatencyMin),
+		LatencyAvg: msToDuration(raw.LatencyAvg),
+		LatencyMax: msToDuration(raw.LatencyMax),
+		LatencyP95: msToDuration(raw.LatencyP95),
+	}
+	return nil
+}
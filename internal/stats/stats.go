@@ -0,0 +1,44 @@
+// Package stats is the types of statistics about the targets, like the metrics since Ayd started and the rollups for long-term history.
+//
+// The store package collects the statistics, and the endpoint package exports them.
+package stats
+
+import (
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// LatencyBuckets is the upper bounds of the latency histogram, in seconds.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// TargetMetrics is the statistics about a target since Ayd started.
+type TargetMetrics struct {
+	Target *api.URL
+
+	// Probes is the count of records for each status.
+	Probes map[api.Status]uint64
+
+	// LatencyBuckets is the cumulative count of records for each LatencyBuckets.
+	// The count of records that exceeds the last bucket is only included in LatencyCount.
+	LatencyBuckets []uint64
+	LatencySum     time.Duration
+	LatencyCount   uint64
+
+	// LastHealthy is the timestamp of the last HEALTHY record.
+	// It is zero if the target has never been HEALTHY.
+	LastHealthy time.Time
+
+	// SchedulerLag is how late the last probe started from the schedule.
+	// It is valid only if Scheduled is true.
+	SchedulerLag time.Duration
+	Scheduled    bool
+}
+
+// Metrics is the statistics of Ayd since started.
+type Metrics struct {
+	Targets []TargetMetrics
+
+	// LogErrors is the count of errors when writing the log file.
+	LogErrors uint64
+}
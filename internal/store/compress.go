@@ -0,0 +1,218 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is a compression method for rotated log files.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+var (
+	ErrUnsupportedCompression = errors.New("unsupported compression method")
+
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// compressionExts is the list of extensions of compressed log files.
+	compressionExts = []string{".gz", ".zst"}
+)
+
+// ParseCompression parses a compression method name.
+func ParseCompression(s string) (Compression, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return CompressionNone, nil
+	case "gzip", "gz":
+		return CompressionGzip, nil
+	case "zstd", "zst":
+		return CompressionZstd, nil
+	default:
+		return CompressionNone, fmt.Errorf("%w: %s", ErrUnsupportedCompression, s)
+	}
+}
+
+// Ext returns the file extension for the compression method, like ".gz".
+func (c Compression) Ext() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// trimCompressionExt removes the extension of a compressed file from the path.
+func trimCompressionExt(path string) string {
+	for _, ext := range compressionExts {
+		if p, ok := strings.CutSuffix(path, ext); ok {
+			return p
+		}
+	}
+	return path
+}
+
+// detectCompression detects the compression method by the magic number at the head of a file.
+func detectCompression(head []byte) Compression {
+	switch {
+	case len(head) >= len(gzipMagic) && string(head[:len(gzipMagic)]) == string(gzipMagic):
+		return CompressionGzip
+	case len(head) >= len(zstdMagic) && string(head[:len(zstdMagic)]) == string(zstdMagic):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+type decompressReader struct {
+	io.Reader
+	decoder  io.Closer
+	upstream io.Closer
+}
+
+func (r decompressReader) Close() error {
+	if r.decoder != nil {
+		r.decoder.Close()
+	}
+	return r.upstream.Close()
+}
+
+func newDecompressReader(r io.ReadCloser, br io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		d, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return decompressReader{d, d, r}, nil
+	case CompressionZstd:
+		d, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		rc := d.IOReadCloser()
+		return decompressReader{rc, rc, r}, nil
+	default:
+		return decompressReader{br, nil, r}, nil
+	}
+}
+
+// NewDecompressReader makes a reader that decompresses gzip or zstd stream.
+// The compression method is detected by the magic number, so uncompressed stream is read as is.
+// Closing the returned reader also closes r.
+func NewDecompressReader(r io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(zstdMagic))
+	return newDecompressReader(r, br, detectCompression(head))
+}
+
+// openLogFile opens a log file for reading, and reports the compression method of it.
+// Compressed files are decompressed transparently, but they are not seekable.
+func openLogFile(path string) (rc io.ReadCloser, f *os.File, c Compression, err error) {
+	f, err = os.OpenFile(path, os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, nil, CompressionNone, err
+	}
+
+	head := make([]byte, len(zstdMagic))
+	n, _ := f.ReadAt(head, 0)
+	c = detectCompression(head[:n])
+	if c == CompressionNone {
+		return f, f, c, nil
+	}
+
+	rc, err = newDecompressReader(f, f, c)
+	if err != nil {
+		f.Close()
+		return nil, nil, CompressionNone, err
+	}
+	return rc, f, c, nil
+}
+
+type compressWriter interface {
+	io.Writer
+	Close() error
+}
+
+func newCompressWriter(w io.Writer, c Compression) (compressWriter, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+}
+
+// compressFile compresses the file and removes the original file.
+// If the compressed file already exists, the data is added as a new gzip member or a new zstd frame, so that the both of data can be read.
+func compressFile(path string, c Compression) (err error) {
+	dst := path + c.Ext()
+	tmp := dst + ".tmp"
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	if old, err := os.Open(dst); err == nil {
+		_, err = io.Copy(out, old)
+		old.Close()
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	w, err := newCompressWriter(out, c)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	src.Close()
+
+	if err = os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	removeLogIndex(path)
+	return os.Remove(path)
+}
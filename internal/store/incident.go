@@ -3,7 +3,9 @@ package store
 import (
 	"net"
 	"regexp"
+	"sort"
 	"strconv"
+	"time"
 
 	api "github.com/macrat/ayd/lib-ayd"
 )
@@ -71,3 +73,228 @@ func isSameIncidentMessage(a, b string) bool {
 
 	return a == b
 }
+
+// incidentBuilder derives incidents from records in time order.
+type incidentBuilder struct {
+	current map[string]*api.Incident
+	done    []*api.Incident
+
+	// seen is the set of targets that have been added at least once.
+	seen map[string]struct{}
+
+	// leading is the incidents caused by the first record of each target.
+	// These incidents may have started before the first record.
+	leading []*api.Incident
+}
+
+func (b *incidentBuilder) Add(r api.Record) {
+	if r.Status == api.StatusAborted || r.Target.Scheme == "alert" || r.Target.Scheme == "ayd" {
+		return
+	}
+
+	if b.current == nil {
+		b.current = make(map[string]*api.Incident)
+		b.seen = make(map[string]struct{})
+	}
+
+	target := r.Target.String()
+
+	_, seen := b.seen[target]
+	b.seen[target] = struct{}{}
+
+	if incident, ok := b.current[target]; ok {
+		if incident.Status == r.Status && isSameIncidentMessage(incident.Message, r.Message) {
+			incident.Message = r.Message
+			return
+		}
+
+		incident.EndsAt = r.Time
+		b.done = append(b.done, incident)
+		delete(b.current, target)
+	}
+
+	if r.Status != api.StatusHealthy {
+		incident := newIncident(r)
+		b.current[target] = incident
+		if !seen {
+			b.leading = append(b.leading, incident)
+		}
+	}
+}
+
+// Incidents returns the derived incidents sorted by the time caused.
+// The incidents that are not resolved yet have zero EndsAt.
+func (b *incidentBuilder) Incidents() []*api.Incident {
+	rs := append([]*api.Incident{}, b.done...)
+	for _, x := range b.current {
+		rs = append(rs, x)
+	}
+	sort.Sort(byIncidentCaused(rs))
+	return rs
+}
+
+// Unresolved returns the incidents that are not resolved yet.
+func (b *incidentBuilder) Unresolved() []*api.Incident {
+	rs := make([]*api.Incident, 0, len(b.current))
+	for _, x := range b.current {
+		rs = append(rs, x)
+	}
+	return rs
+}
+
+const (
+	// incidentLookbackStep is the first period to look back before the queried period, to find the actual start of incidents.
+	// The period is quadrupled until incidentLookbackLimit.
+	incidentLookbackStep = time.Hour
+
+	// incidentLookbackLimit is the maximum period to look back before the queried period.
+	incidentLookbackLimit = 30 * 24 * time.Hour
+)
+
+// IncidentsBetween derives incidents from the log between since and until, of the targets that match.
+// The match function can be nil to get all targets.
+//
+// Unlike [Store.IncidentHistory], it reads the log, so it can find incidents older than the history limit or before restart.
+// The incidents that continue over the edges of the period are looked up in the log outside the period, to report their actual StartsAt and EndsAt.
+// The StartsAt is looked up to 30 days before since.
+// Only the incidents that are not resolved yet at now have zero EndsAt.
+func (s *Store) IncidentsBetween(since, until time.Time, match func(*api.URL) bool) ([]*api.Incident, error) {
+	scanner, err := s.OpenLogByTarget(since, until, match)
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Close()
+
+	var b incidentBuilder
+	for scanner.Scan() {
+		b.Add(scanner.Record())
+	}
+
+	if err := s.lookupIncidentStarts(since, b.leading); err != nil {
+		return nil, err
+	}
+	if err := s.lookupIncidentEnds(until, b.Unresolved()); err != nil {
+		return nil, err
+	}
+
+	return b.Incidents(), nil
+}
+
+// incidentsByTarget makes a map from target URL to incident.
+func incidentsByTarget(xs []*api.Incident) map[string]*api.Incident {
+	m := make(map[string]*api.Incident, len(xs))
+	for _, x := range xs {
+		m[x.Target.String()] = x
+	}
+	return m
+}
+
+// scanIncidentRecords calls f with the records of the pending incidents' targets between since and until.
+// ABORTED records are skipped because they never change incidents.
+func (s *Store) scanIncidentRecords(since, until time.Time, pending map[string]*api.Incident, f func(x *api.Incident, r api.Record)) error {
+	scanner, err := s.OpenLogByTarget(since, until, func(u *api.URL) bool {
+		_, ok := pending[u.String()]
+		return ok
+	})
+	if err != nil {
+		return err
+	}
+	defer scanner.Close()
+
+	for scanner.Scan() {
+		r := scanner.Record()
+		if r.Status == api.StatusAborted {
+			continue
+		}
+		if x, ok := pending[r.Target.String()]; ok {
+			f(x, r)
+		}
+	}
+	return nil
+}
+
+// lookupIncidentStarts looks back the log before since, and updates StartsAt of the incidents to when they actually started.
+func (s *Store) lookupIncidentStarts(since time.Time, incidents []*api.Incident) error {
+	pending := incidentsByTarget(incidents)
+
+	end := since
+	for step := incidentLookbackStep; len(pending) > 0; step *= 4 {
+		if step > incidentLookbackLimit {
+			step = incidentLookbackLimit
+		}
+		start := since.Add(-step)
+
+		// starts is the first record that continues to the incident, after the last record that is not a part of the incident.
+		starts := make(map[*api.Incident]time.Time)
+		broken := make(map[*api.Incident]bool)
+
+		err := s.scanIncidentRecords(start, end, pending, func(x *api.Incident, r api.Record) {
+			if r.Status == x.Status && isSameIncidentMessage(x.Message, r.Message) {
+				if _, ok := starts[x]; !ok {
+					starts[x] = r.Time
+				}
+			} else {
+				delete(starts, x)
+				broken[x] = true
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		for target, x := range pending {
+			if t, ok := starts[x]; ok {
+				x.StartsAt = t
+			}
+			if broken[x] {
+				delete(pending, target)
+			}
+		}
+
+		if step == incidentLookbackLimit {
+			break
+		}
+		end = start
+	}
+
+	return nil
+}
+
+// lookupIncidentEnds looks forward the log after until, and updates EndsAt of the incidents to when they actually resolved.
+// The incidents that are not resolved yet at now keep zero EndsAt.
+func (s *Store) lookupIncidentEnds(until time.Time, incidents []*api.Incident) error {
+	pending := incidentsByTarget(incidents)
+
+	now := time.Now()
+	start := until
+	for step := incidentLookbackStep; len(pending) > 0 && start.Before(now); step *= 4 {
+		end := start.Add(step)
+		if end.After(now) {
+			end = now.Add(time.Second)
+		}
+
+		err := s.scanIncidentRecords(start, end, pending, func(x *api.Incident, r api.Record) {
+			if !x.EndsAt.IsZero() {
+				return
+			}
+			if r.Status == x.Status && isSameIncidentMessage(x.Message, r.Message) {
+				x.Message = r.Message
+			} else {
+				x.EndsAt = r.Time
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		for target, x := range pending {
+			if !x.EndsAt.IsZero() {
+				delete(pending, target)
+			}
+		}
+
+		start = end
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/goccy/go-json"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+const (
+	// indexBucket is the time width of an entry in the log index.
+	indexBucket = 10 * time.Minute
+
+	indexVersion = 2
+
+	// fingerprintSize is the size of the head and the tail of the log file to calculate the fingerprint.
+	fingerprintSize = 4096
+)
+
+// indexPath returns the path to the index file of the log file, like "ayd.log.idx".
+func indexPath(path string) string {
+	return path + ".idx"
+}
+
+// removeLogIndex removes the index file of the log file if exists.
+func removeLogIndex(path string) {
+	os.Remove(indexPath(path))
+}
+
+type logIndexEntry struct {
+	// Time is the unix time of the beginning of the time bucket.
+	Time int64 `json:"time"`
+
+	Target string `json:"target"`
+
+	// Start is the offset of the first record in the bucket of the target.
+	Start int64 `json:"start"`
+
+	// End is the offset just after the last record in the bucket of the target.
+	End int64 `json:"end"`
+}
+
+type logIndexKey struct {
+	time   int64
+	target string
+}
+
+// logIndex is a small index of a log file, that has offsets of records per time bucket and per target.
+// It is stored as a sidecar file next to the log file, and used to seek the log file without scanning the whole file.
+type logIndex struct {
+	Version int `json:"version"`
+
+	// Size is the size of the log file that indexed.
+	// The records after this offset are not indexed yet.
+	Size int64 `json:"size"`
+
+	// Fingerprint is the checksum of the head and the tail of the indexed part of the log file.
+	// It is used to detect that the log file is replaced or rewritten.
+	Fingerprint uint32 `json:"fingerprint"`
+
+	Entries []logIndexEntry `json:"entries"`
+
+	lookup map[logIndexKey]int
+	dirty  bool
+}
+
+func newLogIndex() *logIndex {
+	return &logIndex{Version: indexVersion}
+}
+
+// add adds a record at the offset to the index.
+func (idx *logIndex) add(t time.Time, target string, offset, size int64) {
+	if idx.lookup == nil {
+		idx.lookup = make(map[logIndexKey]int, len(idx.Entries))
+		for i, e := range idx.Entries {
+			idx.lookup[logIndexKey{e.Time, e.Target}] = i
+		}
+	}
+
+	key := logIndexKey{t.Truncate(indexBucket).Unix(), target}
+	end := offset + size
+
+	if i, ok := idx.lookup[key]; ok {
+		e := &idx.Entries[i]
+		e.Start = min(e.Start, offset)
+		e.End = max(e.End, end)
+	} else {
+		idx.lookup[key] = len(idx.Entries)
+		idx.Entries = append(idx.Entries, logIndexEntry{
+			Time:   key.time,
+			Target: target,
+			Start:  offset,
+			End:    end,
+		})
+	}
+
+	idx.Size = max(idx.Size, end)
+	idx.dirty = true
+}
+
+// update indexes the records in the log file after idx.Size.
+// The last line is not indexed if it is not terminated by a newline, because it may be being written.
+func (idx *logIndex) update(f io.ReaderAt, size int64) error {
+	r := bufio.NewReader(io.NewSectionReader(f, idx.Size, size-idx.Size))
+	offset := idx.Size
+
+	var rec struct {
+		Time   string `json:"time"`
+		Target string `json:"target"`
+	}
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if json.Unmarshal(line, &rec) == nil {
+			if t, err := api.ParseTime(rec.Time); err == nil {
+				idx.add(t, rec.Target, offset, int64(len(line)))
+			}
+		}
+
+		offset += int64(len(line))
+		if idx.Size < offset {
+			idx.Size = offset
+			idx.dirty = true
+		}
+	}
+}
+
+// logSpan is a range of a log file to read.
+type logSpan struct {
+	Start int64
+	End   int64
+}
+
+// spans returns the ranges in the log file to read for the records between since and until, of the targets that match.
+// The match function can be nil to read all targets.
+// The records after idx.Size are always included, because they are not indexed yet.
+func (idx *logIndex) spans(since, until time.Time, match func(*api.URL) bool) []logSpan {
+	matched := make(map[string]bool)
+	matchTarget := func(target string) bool {
+		if match == nil {
+			return true
+		}
+		if m, ok := matched[target]; ok {
+			return m
+		}
+		u, err := api.ParseURL(target)
+		m := err != nil || match(u)
+		matched[target] = m
+		return m
+	}
+
+	var ss []logSpan
+	for _, e := range idx.Entries {
+		bucket := time.Unix(e.Time, 0)
+		if !bucket.Add(indexBucket).After(since) || !bucket.Before(until) {
+			continue
+		}
+		if matchTarget(e.Target) {
+			ss = append(ss, logSpan{e.Start, e.End})
+		}
+	}
+	ss = append(ss, logSpan{idx.Size, 1<<63 - 1})
+
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].Start < ss[j].Start
+	})
+
+	merged := ss[:1]
+	for _, s := range ss[1:] {
+		last := &merged[len(merged)-1]
+		if s.Start <= last.End {
+			last.End = max(last.End, s.End)
+		} else {
+			merged = append(merged, s)
+		}
+	}
+
+	return merged
+}
+
+// readLogIndex reads the index file of the log file.
+// It returns nil if the file doesn't exist or is broken.
+func readLogIndex(path string) *logIndex {
+	raw, err := os.ReadFile(indexPath(path))
+	if err != nil {
+		return nil
+	}
+
+	var idx logIndex
+	if err := json.Unmarshal(raw, &idx); err != nil || idx.Version != indexVersion {
+		return nil
+	}
+	return &idx
+}
+
+// logFingerprint calculates the checksum of the head and the tail of the first size bytes of the log file.
+func logFingerprint(f io.ReaderAt, size int64) (uint32, error) {
+	h := crc32.NewIEEE()
+
+	head := min(size, fingerprintSize)
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, head)); err != nil {
+		return 0, err
+	}
+
+	tail := max(head, size-fingerprintSize)
+	if _, err := io.Copy(h, io.NewSectionReader(f, tail, size-tail)); err != nil {
+		return 0, err
+	}
+
+	return h.Sum32(), nil
+}
+
+// save writes the index as the sidecar file of the log file.
+// The file is replaced atomically, so readers never see the broken index even if some processes save it at the same time.
+// The index of the log file being written should be saved only by the writer, because readers may have an older index than the writer.
+func (idx *logIndex) save(path string) error {
+	dst := indexPath(path)
+
+	log, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	idx.Fingerprint, err = logFingerprint(log, idx.Size)
+	log.Close()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(f).Encode(idx)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	idx.dirty = false
+	return nil
+}
+
+// loadLogIndex loads the index of the log file that has the given size.
+// The index is rebuilt if it is missing or stale, but it is not saved; the caller should save it if idx.dirty is true.
+func loadLogIndex(path string, size int64) (*logIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idx := readLogIndex(path)
+	if idx != nil && idx.Size <= size {
+		if fp, err := logFingerprint(f, idx.Size); err != nil || fp != idx.Fingerprint {
+			idx = nil
+		}
+	}
+	if idx == nil || idx.Size > size {
+		idx = newLogIndex()
+	}
+
+	if idx.Size < size {
+		if err := idx.update(f, size); err != nil {
+			return nil, err
+		}
+	}
+
+	return idx, nil
+}
@@ -0,0 +1,245 @@
+package store
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+func Test_loadLogIndex(t *testing.T) {
+	t.Parallel()
+
+	lines := []string{
+		`{"time":"2021-01-02T15:00:00Z", "status":"HEALTHY", "target":"dummy:a", "message":"a-1"}`,
+		`{"time":"2021-01-02T15:01:00Z", "status":"HEALTHY", "target":"dummy:b", "message":"b-1"}`,
+		`{"time":"2021-01-02T15:30:00Z", "status":"HEALTHY", "target":"dummy:a", "message":"a-2"}`,
+		`invalid line`,
+		`{"time":"2021-01-02T15:02:00Z", "status":"HEALTHY", "target":"dummy:a", "message":"delayed"}`,
+	}
+	path := filepath.Join(t.TempDir(), "ayd.log")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("failed to prepare log: %s", err)
+	}
+	size := int64(len(strings.Join(lines, "\n")) + 1)
+
+	idx, err := loadLogIndex(path, size)
+	if err != nil {
+		t.Fatalf("failed to load index: %s", err)
+	}
+	if idx.Size != size {
+		t.Errorf("unexpected indexed size: %d", idx.Size)
+	}
+
+	if readLogIndex(path) != nil {
+		t.Fatalf("index file should not be saved by readers")
+	}
+	if err := idx.save(path); err != nil {
+		t.Fatalf("failed to save index: %s", err)
+	}
+	if saved := readLogIndex(path); saved == nil {
+		t.Fatalf("index file is not saved")
+	} else if diff := cmp.Diff(idx.Entries, saved.Entries); diff != "" {
+		t.Errorf("unexpected saved index\n%s", diff)
+	}
+
+	offset := func(i int) int64 {
+		return int64(len(strings.Join(lines[:i], "\n")) + min(i, 1))
+	}
+	bucket := time.Date(2021, 1, 2, 15, 0, 0, 0, time.UTC).Unix()
+	want := []logIndexEntry{
+		{bucket, "dummy:a", offset(0), offset(5)},
+		{bucket, "dummy:b", offset(1), offset(2)},
+		{bucket + 30*60, "dummy:a", offset(2), offset(3)},
+	}
+	if diff := cmp.Diff(want, idx.Entries); diff != "" {
+		t.Errorf("unexpected index\n%s", diff)
+	}
+
+	matchB := func(u *api.URL) bool { return u.Opaque == "b" }
+	since := time.Date(2021, 1, 2, 15, 0, 0, 0, time.UTC)
+	until := time.Date(2021, 1, 2, 15, 10, 0, 0, time.UTC)
+	if diff := cmp.Diff([]logSpan{{offset(1), offset(2)}, {size, 1<<63 - 1}}, idx.spans(since, until, matchB)); diff != "" {
+		t.Errorf("unexpected spans for target b\n%s", diff)
+	}
+	if diff := cmp.Diff([]logSpan{{offset(0), 1<<63 - 1}}, idx.spans(since, until, nil)); diff != "" {
+		t.Errorf("unexpected spans for all targets\n%s", diff)
+	}
+
+	// Append a record without updating the index file, and check the index is updated.
+	extra := `{"time":"2021-01-02T16:00:00Z", "status":"HEALTHY", "target":"dummy:b", "message":"b-2"}` + "\n"
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("failed to open log: %s", err)
+	}
+	partial := `{"time":"2021-01-02T16:00:00Z", "status":"HEALTHY", "targ`
+	f.WriteString(extra + partial)
+	f.Close()
+
+	idx, err = loadLogIndex(path, size+int64(len(extra)+len(partial)))
+	if err != nil {
+		t.Fatalf("failed to load index: %s", err)
+	}
+	if idx.Size != size+int64(len(extra)) {
+		t.Errorf("unexpected indexed size after append: %d", idx.Size)
+	}
+	if len(idx.Entries) != 4 || idx.Entries[3].Target != "dummy:b" || idx.Entries[3].Start != size {
+		t.Errorf("unexpected index after append: %v", idx.Entries)
+	}
+
+	// Replace the log file by a larger one, and check the stale index is not used.
+	replaced := strings.Repeat(`{"time":"2021-01-02T17:00:00Z", "status":"HEALTHY", "target":"dummy:c", "message":"replaced"}`+"\n", 10)
+	if err := os.WriteFile(path, []byte(replaced), 0644); err != nil {
+		t.Fatalf("failed to replace log: %s", err)
+	}
+	idx, err = loadLogIndex(path, int64(len(replaced)))
+	if err != nil {
+		t.Fatalf("failed to load index: %s", err)
+	}
+	bucketC := time.Date(2021, 1, 2, 17, 0, 0, 0, time.UTC).Unix()
+	if diff := cmp.Diff([]logIndexEntry{{bucketC, "dummy:c", 0, int64(len(replaced))}}, idx.Entries); diff != "" {
+		t.Errorf("unexpected index after replace\n%s", diff)
+	}
+
+	// Truncate the log file, and check the index is rebuilt.
+	if err := os.WriteFile(path, []byte(lines[0]+"\n"), 0644); err != nil {
+		t.Fatalf("failed to truncate log: %s", err)
+	}
+	idx, err = loadLogIndex(path, int64(len(lines[0])+1))
+	if err != nil {
+		t.Fatalf("failed to load index: %s", err)
+	}
+	if diff := cmp.Diff([]logIndexEntry{{bucket, "dummy:a", 0, int64(len(lines[0]) + 1)}}, idx.Entries); diff != "" {
+		t.Errorf("unexpected index after truncate\n%s", diff)
+	}
+}
+
+func TestStore_writeIndex(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "ayd.log")
+
+	s, err := New("", path, io.Discard)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	for i, target := range []string{"dummy:a", "dummy:b", "dummy:a"} {
+		u, _ := api.ParseURL(target)
+		s.Report(u, api.Record{
+			Time:   time.Date(2021, 1, 2, 15, i, 0, 0, time.UTC),
+			Status: api.StatusHealthy,
+			Target: u,
+		})
+	}
+	s.Close()
+
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat log: %s", err)
+	}
+
+	idx := readLogIndex(path)
+	if idx == nil {
+		t.Fatalf("index file is not written")
+	}
+	if idx.Size != st.Size() {
+		t.Errorf("index size is %d but log size is %d", idx.Size, st.Size())
+	}
+	if len(idx.Entries) != 2 || idx.Entries[0].Target != "dummy:a" || idx.Entries[1].Target != "dummy:b" {
+		t.Errorf("unexpected index: %v", idx.Entries)
+	}
+}
+
+func TestStore_OpenLog_saveIndexOfRotatedFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	rotated := filepath.Join(dir, "ayd_20210102.log")
+
+	base := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+	var log strings.Builder
+	for i := 0; i < 24*6; i++ {
+		target := []string{"dummy:a", "dummy:b"}[i%2]
+		log.WriteString(api.Record{
+			Time:    base.Add(time.Duration(i) * 10 * time.Minute),
+			Status:  api.StatusHealthy,
+			Target:  &api.URL{Scheme: "dummy", Opaque: target[len("dummy:"):]},
+			Message: strconv.Itoa(i),
+		}.String() + "\n")
+	}
+	if err := os.WriteFile(rotated, []byte(log.String()), 0644); err != nil {
+		t.Fatalf("failed to prepare log: %s", err)
+	}
+
+	s, err := New("", filepath.Join(dir, "ayd_%Y%m%d.log"), io.Discard)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	defer s.Close()
+
+	since := base.Add(15 * time.Hour)
+	until := base.Add(16 * time.Hour)
+	matchA := func(u *api.URL) bool { return u.Opaque == "a" }
+
+	query := func() []string {
+		t.Helper()
+
+		r, err := s.OpenLogByTarget(since, until, matchA)
+		if err != nil {
+			t.Fatalf("failed to open log: %s", err)
+		}
+		defer r.Close()
+
+		var msgs []string
+		for r.Scan() {
+			msgs = append(msgs, r.Record().Message)
+		}
+		return msgs
+	}
+
+	want := []string{"90", "92", "94"}
+	if diff := cmp.Diff(want, query()); diff != "" {
+		t.Errorf("unexpected records in the first query\n%s", diff)
+	}
+
+	saved := readLogIndex(rotated)
+	if saved == nil {
+		t.Fatalf("index of the rotated file is not saved")
+	}
+	if saved.Size != int64(log.Len()) {
+		t.Errorf("unexpected indexed size: %d", saved.Size)
+	}
+	before, err := os.Stat(indexPath(rotated))
+	if err != nil {
+		t.Fatalf("failed to stat index: %s", err)
+	}
+
+	if diff := cmp.Diff(want, query()); diff != "" {
+		t.Errorf("unexpected records in the second query\n%s", diff)
+	}
+
+	after, err := os.Stat(indexPath(rotated))
+	if err != nil {
+		t.Fatalf("failed to stat index: %s", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Errorf("index is rebuilt in the second query")
+	}
+
+	idx, err := loadLogIndex(rotated, int64(log.Len()))
+	if err != nil {
+		t.Fatalf("failed to load index: %s", err)
+	}
+	if idx.dirty {
+		t.Errorf("saved index is not reused")
+	}
+	if ss := idx.spans(since, until, matchA); len(ss) == 0 || ss[0].Start == 0 {
+		t.Errorf("the whole file is scanned: %v", ss)
+	}
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/macrat/ayd/internal/stats"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// metricsMap holds TargetMetrics for each targets.
+type metricsMap struct {
+	sync.Mutex
+	targets map[string]*stats.TargetMetrics
+}
+
+func (m *metricsMap) get(target *api.URL) *stats.TargetMetrics {
+	if m.targets == nil {
+		m.targets = make(map[string]*stats.TargetMetrics)
+	}
+
+	key := target.String()
+	tm, ok := m.targets[key]
+	if !ok {
+		tm = &stats.TargetMetrics{
+			Target:         target,
+			Probes:         make(map[api.Status]uint64),
+			LatencyBuckets: make([]uint64, len(stats.LatencyBuckets)),
+		}
+		m.targets[key] = tm
+	}
+	return tm
+}
+
+// Observe updates statistics by a record.
+func (m *metricsMap) Observe(r api.Record) {
+	m.Lock()
+	defer m.Unlock()
+
+	tm := m.get(r.Target)
+
+	tm.Probes[r.Status]++
+
+	sec := r.Latency.Seconds()
+	for i, b := range stats.LatencyBuckets {
+		if sec <= b {
+			tm.LatencyBuckets[i]++
+		}
+	}
+	tm.LatencySum += r.Latency
+	tm.LatencyCount++
+
+	if r.Status == api.StatusHealthy && r.Time.After(tm.LastHealthy) {
+		tm.LastHealthy = r.Time
+	}
+}
+
+// SetSchedulerLag records the lag of the scheduler.
+func (m *metricsMap) SetSchedulerLag(target *api.URL, lag time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	tm := m.get(target)
+	tm.SchedulerLag = lag
+	tm.Scheduled = true
+}
+
+// Snapshot returns copy of all TargetMetrics sorted by target URL.
+func (m *metricsMap) Snapshot() []stats.TargetMetrics {
+	m.Lock()
+	defer m.Unlock()
+
+	result := make([]stats.TargetMetrics, 0, len(m.targets))
+	for _, tm := range m.targets {
+		x := *tm
+
+		x.Probes = make(map[api.Status]uint64, len(tm.Probes))
+		for k, v := range tm.Probes {
+			x.Probes[k] = v
+		}
+		x.LatencyBuckets = append([]uint64(nil), tm.LatencyBuckets...)
+
+		result = append(result, x)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Target.String() < result[j].Target.String()
+	})
+
+	return result
+}
+
+// SetSchedulerLag records how late the probe for the target started from the schedule.
+func (s *Store) SetSchedulerLag(target *api.URL, lag time.Duration) {
+	s.metrics.SetSchedulerLag(target, lag)
+}
+
+// Metrics returns the statistics since Ayd started.
+// The LastHealthy of each targets is filled using the restored log if there is no HEALTHY record since started.
+func (s *Store) Metrics() stats.Metrics {
+	targets := s.metrics.Snapshot()
+
+	s.historyLock.RLock()
+	for i, tm := range targets {
+		if !tm.LastHealthy.IsZero() {
+			continue
+		}
+		if hs, ok := s.probeHistory[tm.Target.String()]; ok {
+			for j := len(hs.Records) - 1; j >= 0; j-- {
+				if hs.Records[j].Status == api.StatusHealthy {
+					targets[i].LastHealthy = hs.Records[j].Time
+					break
+				}
+			}
+		}
+	}
+	s.historyLock.RUnlock()
+
+	for i, tm := range targets {
+		targets[i].Target = s.Masker.MaskURL(tm.Target)
+	}
+
+	s.errorsLock.RLock()
+	defer s.errorsLock.RUnlock()
+
+	return stats.Metrics{
+		Targets:   targets,
+		LogErrors: s.errorCount,
+	}
+}
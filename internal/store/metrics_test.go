@@ -0,0 +1,68 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/macrat/ayd/internal/testutil"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+func TestStore_Metrics(t *testing.T) {
+	s := testutil.NewStore(t)
+	defer s.Close()
+
+	target := &api.URL{Scheme: "dummy", Fragment: "metrics"}
+	base := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	records := []api.Record{
+		{Time: base, Status: api.StatusHealthy, Latency: 3 * time.Millisecond},
+		{Time: base.Add(time.Minute), Status: api.StatusHealthy, Latency: 200 * time.Millisecond},
+		{Time: base.Add(2 * time.Minute), Status: api.StatusFailure, Latency: 2 * time.Second},
+		{Time: base.Add(3 * time.Minute), Status: api.StatusFailure, Latency: 10 * time.Minute},
+	}
+	for _, r := range records {
+		r.Target = target
+		s.Report(target, r)
+	}
+	s.ReportInternalError("test", "this should not be counted")
+	s.SetSchedulerLag(target, 42*time.Millisecond)
+
+	m := s.Metrics()
+	if len(m.Targets) != 1 {
+		t.Fatalf("unexpected number of targets: %d", len(m.Targets))
+	}
+	tm := m.Targets[0]
+
+	if tm.Target.String() != target.String() {
+		t.Errorf("unexpected target: %s", tm.Target)
+	}
+
+	if diff := cmp.Diff(map[api.Status]uint64{api.StatusHealthy: 2, api.StatusFailure: 2}, tm.Probes); diff != "" {
+		t.Errorf("unexpected probe counts:\n%s", diff)
+	}
+
+	// buckets: 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300
+	if diff := cmp.Diff([]uint64{1, 1, 1, 1, 1, 2, 2, 2, 3, 3, 3, 3, 3, 3}, tm.LatencyBuckets); diff != "" {
+		t.Errorf("unexpected latency buckets:\n%s", diff)
+	}
+	if tm.LatencyCount != 4 {
+		t.Errorf("unexpected latency count: %d", tm.LatencyCount)
+	}
+	if want := 3*time.Millisecond + 200*time.Millisecond + 2*time.Second + 10*time.Minute; tm.LatencySum != want {
+		t.Errorf("unexpected latency sum: %s", tm.LatencySum)
+	}
+
+	if !tm.LastHealthy.Equal(base.Add(time.Minute)) {
+		t.Errorf("unexpected last healthy time: %s", tm.LastHealthy)
+	}
+
+	if !tm.Scheduled || tm.SchedulerLag != 42*time.Millisecond {
+		t.Errorf("unexpected scheduler lag: %v %s", tm.Scheduled, tm.SchedulerLag)
+	}
+
+	if m.LogErrors != 0 {
+		t.Errorf("unexpected log errors: %d", m.LogErrors)
+	}
+}
@@ -191,6 +191,32 @@ func (m minuteFragment) FillTimePattern(s string, tp *timePattern) (ok bool) {
 	return true
 }
 
+// seqFragment is the sequence number of files in the same period, for size-based rotation.
+// It has variable length, unlike the other fragments.
+type seqFragment struct{}
+
+func (q seqFragment) Build(_ time.Time) string {
+	return "1"
+}
+
+func (q seqFragment) Len() int {
+	return 0
+}
+
+func (q seqFragment) Glob() string {
+	return "[0-9]*"
+}
+
+func (q seqFragment) FillTimePattern(s string, tp *timePattern) (ok bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return false
+	}
+
+	tp.Seq = n
+	return true
+}
+
 type PathPattern struct {
 	pattern   string
 	fragments []pathFragment
@@ -235,6 +261,8 @@ func ParsePathPattern(s string) PathPattern {
 				p.fragments = append(p.fragments, hourFragment{})
 			case 'M':
 				p.fragments = append(p.fragments, minuteFragment{})
+			case 'N':
+				p.fragments = append(p.fragments, seqFragment{})
 			default:
 				buf = append(buf, "%", string(s[i]))
 			}
@@ -255,20 +283,122 @@ func (p PathPattern) IsEmpty() bool {
 	return len(p.fragments) == 0
 }
 
+// HasTimeSpec returns true if the pattern has any time spec like %Y.
+func (p PathPattern) HasTimeSpec() bool {
+	for _, f := range p.fragments {
+		switch f.(type) {
+		case constFragment, seqFragment:
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// HasSeq returns true if the pattern has the sequence number spec %N.
+func (p PathPattern) HasSeq() bool {
+	for _, f := range p.fragments {
+		if _, ok := f.(seqFragment); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// BaseDir returns the deepest directory that doesn't include any time spec.
+func (p PathPattern) BaseDir() string {
+	if len(p.fragments) == 0 {
+		return "."
+	}
+	c, ok := p.fragments[0].(constFragment)
+	if !ok {
+		return "."
+	}
+	if len(p.fragments) == 1 {
+		return filepath.Dir(string(c))
+	}
+	i := strings.LastIndexAny(string(c), `/`+string(filepath.Separator))
+	if i < 0 {
+		return "."
+	}
+	if i == 0 {
+		return string(c[:1])
+	}
+	return string(c[:i])
+}
+
+// Build makes the file path for the time, with the first sequence number.
 func (p PathPattern) Build(t time.Time) string {
+	return p.BuildSeq(t, 1)
+}
+
+// BuildSeq makes the file path for the time and the sequence number.
+// The sequence number is ignored if the pattern doesn't have %N.
+func (p PathPattern) BuildSeq(t time.Time, seq int) string {
 	ss := make([]string, len(p.fragments))
 	for i, f := range p.fragments {
-		ss[i] = f.Build(t)
+		if _, ok := f.(seqFragment); ok {
+			ss[i] = strconv.Itoa(seq)
+		} else {
+			ss[i] = f.Build(t)
+		}
 	}
 	return strings.Join(ss, "")
 }
 
+// LastSeq returns the largest sequence number of the existing files for the time.
+// It returns 1 if there is no file, and compressed is true if the file for the returned number is compressed.
+func (p PathPattern) LastSeq(t time.Time) (seq int, compressed bool) {
+	if !p.HasSeq() {
+		return 1, false
+	}
+
+	for _, x := range p.globAll() {
+		tp, ok := p.parseTimePattern(x)
+		if !ok || tp.Seq < seq {
+			continue
+		}
+		plain := trimCompressionExt(x)
+		if p.BuildSeq(t, tp.Seq) != plain {
+			continue
+		}
+		if tp.Seq > seq {
+			seq = tp.Seq
+			compressed = plain != x
+		} else if plain == x {
+			compressed = false
+		}
+	}
+
+	if seq == 0 {
+		return 1, false
+	}
+	return seq, compressed
+}
+
+// parseTimePattern parses a file name.
+// The file name can have an extension of compressed file, like ".gz".
 func (p PathPattern) parseTimePattern(filename string) (tp timePattern, ok bool) {
+	if tp, ok = p.parseTimePatternStrict(filename); ok {
+		return tp, true
+	}
+	if trimmed := trimCompressionExt(filename); trimmed != filename {
+		return p.parseTimePatternStrict(trimmed)
+	}
+	return tp, false
+}
+
+func (p PathPattern) parseTimePatternStrict(filename string) (tp timePattern, ok bool) {
 	tp = emptyTimePattern
 
 	l := 0
 	for _, f := range p.fragments {
 		r := l + f.Len()
+		if _, ok := f.(seqFragment); ok {
+			for r < len(filename) && '0' <= filename[r] && filename[r] <= '9' {
+				r++
+			}
+		}
 		if r > len(filename) {
 			return tp, false
 		}
@@ -307,13 +437,23 @@ func (p PathPattern) Glob() string {
 	return strings.Join(ss, "")
 }
 
-// ListAll returns all log file pathes.
+// globAll returns all files that match to the pattern, including compressed files.
+func (p PathPattern) globAll() []string {
+	var result []string
+	for _, ext := range append(compressionExts, "") {
+		xs, err := filepath.Glob(p.Glob() + ext)
+		if err != nil {
+			return nil
+		}
+		result = append(result, xs...)
+	}
+	return result
+}
+
+// ListAll returns all log file pathes, including compressed files.
 // The result is sorted by time order.
 func (p PathPattern) ListAll() []string {
-	xs, err := filepath.Glob(p.Glob())
-	if err != nil {
-		return nil
-	}
+	xs := p.globAll()
 
 	rs := make([]string, 0, len(xs))
 	tps := make([]timePattern, 0, len(xs))
@@ -325,20 +465,25 @@ func (p PathPattern) ListAll() []string {
 		}
 	}
 
-	sort.Slice(rs, func(i, j int) bool {
-		return tps[i].Less(tps[j])
+	idx := make([]int, len(rs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return tps[idx[i]].Less(tps[idx[j]])
 	})
 
-	return rs
+	sorted := make([]string, len(rs))
+	for i, x := range idx {
+		sorted[i] = rs[x]
+	}
+	return sorted
 }
 
-// ListBetween returns log file pathes.
+// ListBetween returns log file pathes, including compressed files.
 // The result is filtered by since and until query, but not sorted.
 func (p PathPattern) ListBetween(since, until time.Time) []string {
-	xs, err := filepath.Glob(p.Glob())
-	if err != nil {
-		return nil
-	}
+	xs := p.globAll()
 
 	rs := make([]string, 0, len(xs))
 
@@ -359,12 +504,13 @@ type timePattern struct {
 	Minute     int
 	Second     int
 	Nanosecond int
+	Seq        int
 }
 
 var (
-	emptyTimePattern = timePattern{-1, -1, -1, -1, -1, 0, 0}
-	minTimePattern   = timePattern{0, 1, 1, 0, 0, 0, 0}
-	maxTimePattern   = timePattern{9999, 12, 31, 23, 59, 59, int(time.Second - 1)}
+	emptyTimePattern = timePattern{-1, -1, -1, -1, -1, 0, 0, 0}
+	minTimePattern   = timePattern{0, 1, 1, 0, 0, 0, 0, 0}
+	maxTimePattern   = timePattern{9999, 12, 31, 23, 59, 59, int(time.Second - 1), 0}
 )
 
 func (p timePattern) Exec(t time.Time, base timePattern) time.Time {
@@ -433,5 +579,8 @@ func (p timePattern) Less(x timePattern) bool {
 	if p.Hour != x.Hour {
 		return p.Hour < x.Hour
 	}
-	return p.Minute < x.Minute
+	if p.Minute != x.Minute {
+		return p.Minute < x.Minute
+	}
+	return p.Seq < x.Seq
 }
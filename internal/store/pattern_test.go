@@ -24,6 +24,7 @@ func TestPathPattern_parseAndBuild(t *testing.T) {
 		{"ayd_%Y%m%d%H%M.log", []string{"ayd_200102030405.log", "ayd_123411292042.log"}},
 		{"year=%y/month=%m/day=%d/ayd.log", []string{"year=01/month=02/day=03/ayd.log", "year=34/month=11/day=29/ayd.log"}},
 		{"ayd_%ignore%%%Y.log", []string{"ayd_%ignore%2001.log", "ayd_%ignore%1234.log"}},
+		{"ayd_%Y%m%d.%N.log", []string{"ayd_20010203.1.log", "ayd_12341129.1.log"}},
 	}
 
 	for _, tt := range tests {
@@ -151,3 +152,73 @@ func FuzzPathPattern(f *testing.F) {
 		}
 	})
 }
+
+func TestPathPattern_ListAll_compressed(t *testing.T) {
+	dir := t.TempDir()
+
+	os.WriteFile(filepath.Join(dir, "20210102.log.gz"), []byte{}, 0644)
+	os.WriteFile(filepath.Join(dir, "20210103.log"), []byte{}, 0644)
+	os.WriteFile(filepath.Join(dir, "20210101.log.zst"), []byte{}, 0644)
+	os.WriteFile(filepath.Join(dir, "20210104.log.bz2"), []byte{}, 0644)
+
+	p := store.ParsePathPattern(filepath.Join(dir, "%Y%m%d.log"))
+
+	want := []string{
+		filepath.Join(dir, "20210101.log.zst"),
+		filepath.Join(dir, "20210102.log.gz"),
+		filepath.Join(dir, "20210103.log"),
+	}
+	if actual := p.ListAll(); !reflect.DeepEqual(want, actual) {
+		t.Errorf("unexpected files found\nwant:\n%s\nactual:\n%s", strings.Join(want, "\n"), strings.Join(actual, "\n"))
+	}
+
+	if !p.Match(filepath.Join(dir, "20210102.log.gz"), time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2021, 1, 2, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("compressed file should match")
+	}
+}
+
+func TestPathPattern_seq(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"20210102.1.log.gz", "20210102.2.log", "20210102.10.log", "20210101.1.log", "20210103.x.log"} {
+		os.WriteFile(filepath.Join(dir, name), []byte{}, 0644)
+	}
+
+	p := store.ParsePathPattern(filepath.Join(dir, "%Y%m%d.%N.log"))
+
+	if !p.HasSeq() {
+		t.Errorf("pattern should have sequence number")
+	}
+
+	want := []string{
+		filepath.Join(dir, "20210101.1.log"),
+		filepath.Join(dir, "20210102.1.log.gz"),
+		filepath.Join(dir, "20210102.2.log"),
+		filepath.Join(dir, "20210102.10.log"),
+	}
+	if actual := p.ListAll(); !reflect.DeepEqual(want, actual) {
+		t.Errorf("unexpected files found\nwant:\n%s\nactual:\n%s", strings.Join(want, "\n"), strings.Join(actual, "\n"))
+	}
+
+	tests := []struct {
+		Time       time.Time
+		Seq        int
+		Compressed bool
+	}{
+		{time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC), 1, false},
+		{time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC), 10, false},
+		{time.Date(2021, 1, 3, 12, 0, 0, 0, time.UTC), 1, false},
+	}
+	for _, tt := range tests {
+		seq, compressed := p.LastSeq(tt.Time)
+		if seq != tt.Seq || compressed != tt.Compressed {
+			t.Errorf("%s: unexpected last sequence: want=%d,%v actual=%d,%v", tt.Time, tt.Seq, tt.Compressed, seq, compressed)
+		}
+	}
+
+	os.Remove(filepath.Join(dir, "20210102.2.log"))
+	os.Remove(filepath.Join(dir, "20210102.10.log"))
+	if seq, compressed := p.LastSeq(time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC)); seq != 1 || !compressed {
+		t.Errorf("unexpected last sequence: want=1,true actual=%d,%v", seq, compressed)
+	}
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+var (
+	ErrRetentionWithoutTimeSpec = errors.New("log retention requires time specs in the log file name")
+)
+
+// RetentionPolicy is the policy to remove old log files.
+type RetentionPolicy struct {
+	// MaxAge is the maximum age of log files.
+	// The age is calculated from the time specs in the file name, not from the modification time.
+	MaxAge time.Duration
+
+	// MaxSize is the maximum total size of log files in bytes.
+	// The oldest files are removed first if exceeded.
+	MaxSize int64
+
+	// ArchiveDir is the directory to move old log files into.
+	// The files are removed instead of moving if it is empty.
+	ArchiveDir string
+}
+
+// IsEmpty returns true if the policy doesn't remove any file.
+func (p RetentionPolicy) IsEmpty() bool {
+	return p.MaxAge <= 0 && p.MaxSize <= 0
+}
+
+// selectFiles selects files to prune from the files sorted in time order.
+func (p RetentionPolicy) selectFiles(pattern PathPattern, files []string, now time.Time) []string {
+	var result []string
+
+	farFuture := time.Date(9999, 12, 31, 23, 59, 59, 0, now.Location())
+
+	var sizes []int64
+	var total int64
+	for _, f := range files {
+		var size int64
+		if st, err := os.Stat(f); err == nil {
+			size = st.Size()
+		}
+		sizes = append(sizes, size)
+		total += size
+	}
+
+	for i, f := range files {
+		// The log files for the last 70 minutes can be written, because the records from plugins can be delayed by up to 60 minutes.
+		if pattern.Match(f, now.Add(-70*time.Minute), now) {
+			break
+		}
+
+		expired := p.MaxAge > 0 && !pattern.Match(f, now.Add(-p.MaxAge), farFuture)
+		tooLarge := p.MaxSize > 0 && total > p.MaxSize
+
+		if !expired && !tooLarge {
+			break
+		}
+
+		result = append(result, f)
+		total -= sizes[i]
+	}
+
+	return result
+}
+
+// PruneLogs removes or archives the old log files according to s.Retention.
+// The files that don't match to the log file pattern are never touched.
+// The pruned files are reported as an "ayd:log" record.
+func (s *Store) PruneLogs() error {
+	if s.Retention.IsEmpty() || s.path.IsEmpty() {
+		return nil
+	}
+	if !s.path.HasTimeSpec() {
+		return ErrRetentionWithoutTimeSpec
+	}
+
+	s.maintainLock.Lock()
+	defer s.maintainLock.Unlock()
+
+	files := s.Retention.selectFiles(s.path, s.path.ListAll(), time.Now())
+	if len(files) == 0 {
+		return nil
+	}
+
+	var pruned []any
+	var err error
+	for _, f := range files {
+		if s.Retention.ArchiveDir != "" {
+			err = archiveFile(f, s.path.BaseDir(), s.Retention.ArchiveDir)
+		} else {
+			err = os.Remove(f)
+		}
+		if err != nil {
+			break
+		}
+		removeLogIndex(f)
+		pruned = append(pruned, f)
+	}
+
+	if len(pruned) > 0 {
+		u := &api.URL{Scheme: "ayd", Opaque: "log"}
+		rec := api.Record{
+			Time:    time.Now(),
+			Status:  api.StatusHealthy,
+			Target:  u,
+			Message: fmt.Sprintf("removed %d old log files", len(pruned)),
+			Extra: map[string]any{
+				"files": pruned,
+			},
+		}
+		if s.Retention.ArchiveDir != "" {
+			rec.Message = fmt.Sprintf("archived %d old log files", len(pruned))
+			rec.Extra["archive_dir"] = s.Retention.ArchiveDir
+		}
+		s.Report(u, rec)
+	}
+
+	return err
+}
+
+// archiveFile moves the file into archiveDir, keeping the relative path from baseDir.
+func archiveFile(path, baseDir, archiveDir string) error {
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(path)
+	}
+	dst := filepath.Join(archiveDir, rel)
+
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("archive file already exists: %s", dst)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path, dst); err == nil {
+		return nil
+	}
+
+	// Rename doesn't work across file systems, so copy and remove.
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	src.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,404 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/macrat/ayd/internal/stats"
+	api "github.com/macrat/ayd/lib-ayd"
+)
+
+// rollupIntervals is the list of intervals that Ayd writes, from the finest.
+var rollupIntervals = []stats.RollupInterval{stats.RollupHourly, stats.RollupDaily}
+
+// rollupFileStart returns the beginning of the period of the rollup file that includes t.
+// Hourly rollups are stored in monthly files, and daily rollups are stored in yearly files.
+func rollupFileStart(i stats.RollupInterval, t time.Time) time.Time {
+	t = t.UTC()
+	if i == stats.RollupDaily {
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// rollupNextFile returns the beginning of the period of the next rollup file.
+func rollupNextFile(i stats.RollupInterval, t time.Time) time.Time {
+	t = rollupFileStart(i, t)
+	if i == stats.RollupDaily {
+		return t.AddDate(1, 0, 0)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+// rollupFileName returns the name of the rollup file that includes t, like "hourly_202101.jsonl".
+func rollupFileName(i stats.RollupInterval, t time.Time) string {
+	if i == stats.RollupDaily {
+		return t.UTC().Format("daily_2006.jsonl")
+	}
+	return t.UTC().Format("hourly_200601.jsonl")
+}
+
+type rollupKey struct {
+	time   int64
+	target string
+}
+
+// rollupAccumulator collects records of a target in a period.
+type rollupAccumulator struct {
+	target    *api.URL
+	count     map[api.Status]int
+	latencies []time.Duration
+}
+
+func (a *rollupAccumulator) Rollup(t time.Time) stats.Rollup {
+	sort.Slice(a.latencies, func(i, j int) bool {
+		return a.latencies[i] < a.latencies[j]
+	})
+
+	var sum time.Duration
+	for _, l := range a.latencies {
+		sum += l
+	}
+	n := len(a.latencies)
+
+	return stats.Rollup{
+		Time:       t,
+		Target:     a.target,
+		Count:      a.count,
+		LatencyMin: a.latencies[0],
+		LatencyAvg: sum / time.Duration(n),
+		LatencyMax: a.latencies[n-1],
+		LatencyP95: a.latencies[int(math.Ceil(float64(n)*0.95))-1],
+	}
+}
+
+// rollupBuilder aggregates records into rollups of an interval.
+// Only the periods between from and until are aggregated.
+type rollupBuilder struct {
+	interval stats.RollupInterval
+	from     time.Time
+	until    time.Time
+	buckets  map[rollupKey]*rollupAccumulator
+}
+
+func newRollupBuilder(interval stats.RollupInterval, from, until time.Time) *rollupBuilder {
+	return &rollupBuilder{
+		interval: interval,
+		from:     from,
+		until:    until,
+		buckets:  make(map[rollupKey]*rollupAccumulator),
+	}
+}
+
+func (b *rollupBuilder) Add(r api.Record) {
+	if r.Time.Before(b.from) || !r.Time.Before(b.until) {
+		return
+	}
+
+	key := rollupKey{b.interval.Truncate(r.Time).Unix(), r.Target.String()}
+	acc, ok := b.buckets[key]
+	if !ok {
+		acc = &rollupAccumulator{
+			target: r.Target,
+			count:  make(map[api.Status]int),
+		}
+		b.buckets[key] = acc
+	}
+	acc.count[r.Status]++
+	acc.latencies = append(acc.latencies, r.Latency)
+}
+
+// Flush returns the rollups of the periods that end before t, and removes them from the builder.
+// The result is sorted by time and target.
+func (b *rollupBuilder) Flush(t time.Time) []stats.Rollup {
+	var rs []stats.Rollup
+	for key, acc := range b.buckets {
+		start := time.Unix(key.time, 0).UTC()
+		if start.Add(b.interval.Duration()).After(t) {
+			continue
+		}
+		rs = append(rs, acc.Rollup(start))
+		delete(b.buckets, key)
+	}
+
+	sort.Slice(rs, func(i, j int) bool {
+		if !rs[i].Time.Equal(rs[j].Time) {
+			return rs[i].Time.Before(rs[j].Time)
+		}
+		return rs[i].Target.String() < rs[j].Target.String()
+	})
+
+	return rs
+}
+
+// rollupDir returns the directory to store rollup files.
+func (s *Store) rollupDir() string {
+	return filepath.Join(s.path.BaseDir(), "rollup")
+}
+
+// appendRollups appends rollups into the rollup files in dir.
+func appendRollups(dir string, interval stats.RollupInterval, rs []stats.Rollup) error {
+	if len(rs) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var f *os.File
+	var name string
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	for _, r := range rs {
+		if n := rollupFileName(interval, r.Time); f == nil || n != name {
+			if f != nil {
+				if err := f.Close(); err != nil {
+					f = nil
+					return err
+				}
+			}
+
+			var err error
+			name = n
+			f, err = os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				return err
+			}
+		}
+
+		raw, err := r.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(raw, '\n')); err != nil {
+			return err
+		}
+	}
+
+	err := f.Close()
+	f = nil
+	return err
+}
+
+// lastRollupEnd returns the end of the last period in the rollup files in dir.
+// It returns zero time if there is no rollup file.
+func lastRollupEnd(dir string, interval stats.RollupInterval) (time.Time, error) {
+	files, err := filepath.Glob(filepath.Join(dir, string(interval)+"_*.jsonl"))
+	if err != nil || len(files) == 0 {
+		return time.Time{}, err
+	}
+	sort.Strings(files)
+	last := files[len(files)-1]
+
+	f, err := os.Open(last)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	// Read only the tail of the file, because the rollups are written in time order.
+	if st, err := f.Stat(); err == nil && st.Size() > 64*1024 {
+		f.Seek(-64*1024, io.SeekEnd)
+	}
+
+	var end time.Time
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r stats.Rollup
+		if r.UnmarshalJSON(scanner.Bytes()) != nil {
+			continue
+		}
+		if e := r.Time.Add(interval.Duration()); e.After(end) {
+			end = e
+		}
+	}
+	return end, scanner.Err()
+}
+
+// rollupEnd returns the end of the last rollup period of the interval, that means all records before it are summarized.
+func (s *Store) rollupEnd(interval stats.RollupInterval) (time.Time, error) {
+	s.rollupLock.Lock()
+	defer s.rollupLock.Unlock()
+
+	if t, ok := s.rollupEnds[interval]; ok {
+		return t, nil
+	}
+
+	t, err := lastRollupEnd(s.rollupDir(), interval)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if s.rollupEnds == nil {
+		s.rollupEnds = make(map[stats.RollupInterval]time.Time)
+	}
+	s.rollupEnds[interval] = t
+	return t, nil
+}
+
+func (s *Store) setRollupEnd(interval stats.RollupInterval, t time.Time) {
+	s.rollupLock.Lock()
+	defer s.rollupLock.Unlock()
+
+	if s.rollupEnds == nil {
+		s.rollupEnds = make(map[stats.RollupInterval]time.Time)
+	}
+	s.rollupEnds[interval] = t
+}
+
+// UpdateRollups aggregates the records that are no longer updated into the hourly and daily rollup files.
+// It continues from the end of the last rollup, so it reads all log files at the first time.
+func (s *Store) UpdateRollups() error {
+	if !s.Rollup || s.path.IsEmpty() {
+		return nil
+	}
+
+	s.maintainLock.Lock()
+	defer s.maintainLock.Unlock()
+
+	// The log records from plugins can be delayed by up to 60 minutes. To make sure all records are summarized, make 70 minutes clearance.
+	settled := time.Now().Add(-70 * time.Minute)
+
+	var builders []*rollupBuilder
+	since := settled
+	for _, interval := range rollupIntervals {
+		from, err := s.rollupEnd(interval)
+		if err != nil {
+			return err
+		}
+		until := interval.Truncate(settled)
+		if !from.Before(until) {
+			continue
+		}
+		builders = append(builders, newRollupBuilder(interval, from, until))
+		if from.Before(since) {
+			since = from
+		}
+	}
+	if len(builders) == 0 {
+		return nil
+	}
+
+	scanner, err := s.OpenLog(since, settled)
+	if err != nil {
+		return err
+	}
+	defer scanner.Close()
+
+	dir := s.rollupDir()
+
+	flush := func(b *rollupBuilder, t time.Time) error {
+		rs := b.Flush(t)
+		if err := appendRollups(dir, b.interval, rs); err != nil {
+			return err
+		}
+		if len(rs) > 0 {
+			s.setRollupEnd(b.interval, rs[len(rs)-1].Time.Add(b.interval.Duration()))
+		}
+		return nil
+	}
+
+	var lastFlush time.Time
+	for scanner.Scan() {
+		r := scanner.Record()
+		for _, b := range builders {
+			b.Add(r)
+		}
+
+		// Write the periods that can no longer be updated, to reduce memory usage.
+		if t := r.Time.Truncate(time.Hour); t.After(lastFlush) {
+			lastFlush = t
+			if s.isClosing() {
+				return nil
+			}
+			for _, b := range builders {
+				if err := flush(b, t.Add(-70*time.Minute)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, b := range builders {
+		if err := flush(b, b.until); err != nil {
+			return err
+		}
+		s.setRollupEnd(b.interval, b.until)
+	}
+
+	return nil
+}
+
+// Rollups returns the rollups of the targets that match, between since and until, sorted by time.
+// The match function can be nil to get all targets.
+// The end is the end of the last rollup period; the records before it are summarized in the rollups, but the records after it are not.
+func (s *Store) Rollups(interval stats.RollupInterval, since, until time.Time, match func(*api.URL) bool) (rs []stats.Rollup, end time.Time, err error) {
+	if !s.Rollup || s.path.IsEmpty() {
+		return nil, time.Time{}, nil
+	}
+
+	end, err = s.rollupEnd(interval)
+	if err != nil || end.IsZero() {
+		return nil, end, err
+	}
+
+	dir := s.rollupDir()
+	for t := rollupFileStart(interval, since); t.Before(until) && t.Before(end); t = rollupNextFile(interval, t) {
+		rs, err = readRollupFile(filepath.Join(dir, rollupFileName(interval, t)), since, until, match, rs)
+		if err != nil {
+			return nil, end, err
+		}
+	}
+
+	return rs, end, nil
+}
+
+// readRollupFile reads the rollups between since and until from the file, and appends them to rs.
+func readRollupFile(path string, since, until time.Time, match func(*api.URL) bool, rs []stats.Rollup) ([]stats.Rollup, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rs, nil
+	} else if err != nil {
+		return rs, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r stats.Rollup
+		if r.UnmarshalJSON(scanner.Bytes()) != nil {
+			continue
+		}
+		if r.Time.Before(since) || !r.Time.Before(until) {
+			continue
+		}
+		if match != nil && !match(r.Target) {
+			continue
+		}
+		rs = append(rs, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return rs, fmt.Errorf("failed to read rollup file: %w", err)
+	}
+	return rs, nil
+}
+
+// isClosing returns true if the store is closing.
+func (s *Store) isClosing() bool {
+	s.closingLock.Lock()
+	defer s.closingLock.Unlock()
+	return s.closing
+}
@@ -3,38 +3,89 @@ package store
 import (
 	"bufio"
 	"errors"
+	"io"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
 	api "github.com/macrat/ayd/lib-ayd"
 )
 
 type fileScanner struct {
-	file   *os.File
+	file   io.ReadCloser
 	reader *bufio.Reader
 	since  time.Time
 	until  time.Time
+	match  func(*api.URL) bool
 	rec    api.Record
+
+	// section and spans are the file and the rest ranges to read, if the file is indexed.
+	section io.ReaderAt
+	spans   []logSpan
 }
 
-// newFileScanner creates a new [fileScanner] from file path, with period specification.
-func newFileScanner(path string, since, until time.Time) (*fileScanner, error) {
-	f, err := os.OpenFile(path, os.O_RDONLY, 0644)
+// newFileScanner creates a new [fileScanner] from file path, with period and target specification.
+// The match function can be nil to read records of all targets.
+// Uncompressed files are read only the ranges that the index file points.
+// Compressed files are scanned from the beginning, because they can not be seeked.
+// If saveIndex is true, the index is saved when it is rebuilt or updated, to reuse it in the next time.
+func newFileScanner(path string, since, until time.Time, match func(*api.URL) bool, saveIndex bool) (*fileScanner, error) {
+	rc, f, c, err := openLogFile(path)
 	if err != nil {
 		return nil, err
 	}
-	// The log records from plugins can be delayed by up to 60 minutes. To make sure find all records, make 70 minutes clearance.
-	if err := searchLog(f, since.Add(-70*time.Minute), 10*1024); err != nil {
+
+	r := &fileScanner{
+		file:  rc,
+		since: since,
+		until: until,
+		match: match,
+	}
+
+	if c != CompressionNone {
+		r.reader = bufio.NewReader(rc)
+		return r, nil
+	}
+
+	st, err := f.Stat()
+	if err != nil {
 		f.Close()
 		return nil, err
 	}
-	return &fileScanner{
-		file:   f,
-		reader: bufio.NewReader(f),
-		since:  since,
-		until:  until,
-	}, nil
+
+	idx, err := loadLogIndex(path, st.Size())
+	if err != nil {
+		// Fallback to searching the file, if failed to use the index.
+		// The log records from plugins can be delayed by up to 60 minutes. To make sure find all records, make 70 minutes clearance.
+		if err := searchLog(f, since.Add(-70*time.Minute), 10*1024); err != nil {
+			f.Close()
+			return nil, err
+		}
+		r.reader = bufio.NewReader(rc)
+		return r, nil
+	}
+
+	if saveIndex && idx.dirty {
+		// The index is a cache, so the error is ignored. The file will be indexed again in the next time.
+		idx.save(path)
+	}
+
+	r.section = f
+	r.spans = idx.spans(since, until, match)
+	r.reader = bufio.NewReader(strings.NewReader(""))
+	return r, nil
+}
+
+// nextSpan prepares to read the next range of the file.
+func (r *fileScanner) nextSpan() bool {
+	if len(r.spans) == 0 {
+		return false
+	}
+	s := r.spans[0]
+	r.spans = r.spans[1:]
+	r.reader.Reset(io.NewSectionReader(r.section, s.Start, s.End-s.Start))
+	return true
 }
 
 func (r *fileScanner) Close() error {
@@ -51,7 +102,9 @@ func (r *fileScanner) Scan() bool {
 			}
 			b = append(b, rest...)
 		}
-		if err != nil {
+		if errors.Is(err, io.EOF) && len(b) == 0 && r.nextSpan() {
+			continue
+		} else if err != nil {
 			return false
 		}
 
@@ -59,7 +112,7 @@ func (r *fileScanner) Scan() bool {
 			continue
 		}
 
-		if !r.rec.Time.Before(r.since) && r.until.After(r.rec.Time) {
+		if !r.rec.Time.Before(r.since) && r.until.After(r.rec.Time) && (r.match == nil || r.match(r.rec.Target)) {
 			return true
 		}
 		// The log records from plugins can be delayed by up to 60 minutes. To make sure find all records, make 70 minutes clearance.
@@ -79,12 +132,14 @@ type fileScannerSet struct {
 	earliest int
 }
 
-func newFileScannerSet(pathes []string, since, until time.Time) (*fileScannerSet, error) {
+// newFileScannerSet creates a new [fileScannerSet] for the log files.
+// The writing is the path of the log file that the writer is writing. Its index is not saved by readers, because the writer saves it.
+func newFileScannerSet(pathes []string, since, until time.Time, match func(*api.URL) bool, writing string) (*fileScannerSet, error) {
 	min := time.Unix(1<<60-1, 0)
 
 	var ss fileScannerSet
 	for _, p := range pathes {
-		s, err := newFileScanner(p, since, until)
+		s, err := newFileScanner(p, since, until, match, p != writing)
 		if errors.Is(err, os.ErrNotExist) {
 			continue
 		} else if err != nil {
@@ -154,11 +209,11 @@ type inMemoryScanner struct {
 	index   int
 }
 
-func newInMemoryScanner(s *Store, since, until time.Time) *inMemoryScanner {
+func newInMemoryScanner(s *Store, since, until time.Time, match func(*api.URL) bool) *inMemoryScanner {
 	r := &inMemoryScanner{index: -1}
 	for _, xs := range s.ProbeHistory() {
 		for _, x := range xs.Records {
-			if !x.Time.Before(since) && x.Time.Before(until) {
+			if !x.Time.Before(since) && x.Time.Before(until) && (match == nil || match(x.Target)) {
 				r.records = append(r.records, x)
 			}
 		}
@@ -198,11 +253,23 @@ func (r *inMemoryScanner) Record() api.Record {
 	return r.records[r.index]
 }
 
+// OpenLog opens a scanner for records between since and until.
 func (s *Store) OpenLog(since, until time.Time) (api.LogScanner, error) {
+	return s.OpenLogByTarget(since, until, nil)
+}
+
+// OpenLogByTarget opens a scanner for records between since and until, of the targets that match.
+// The match function can be nil to read all targets.
+// It is faster than filtering the result of [Store.OpenLog], because the records of other targets are skipped using the index.
+func (s *Store) OpenLogByTarget(since, until time.Time, match func(*api.URL) bool) (api.LogScanner, error) {
+	if s.db != nil {
+		return s.db.OpenLog(since, until, match)
+	}
+
 	if s.path.IsEmpty() {
-		return newInMemoryScanner(s, since, until), nil
+		return newInMemoryScanner(s, since, until, match), nil
 	}
 
-	r, err := newFileScannerSet(s.path.ListBetween(since, until), since, until)
+	r, err := newFileScannerSet(s.path.ListBetween(since, until), since, until, match, s.getWritingPath())
 	return r, err
 }
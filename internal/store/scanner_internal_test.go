@@ -11,10 +11,32 @@ import (
 	api "github.com/macrat/ayd/lib-ayd"
 )
 
+// copyTestdata copies the files in testdata into a temporary directory, to avoid creating index files in testdata.
+func copyTestdata(t testing.TB, names ...string) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	pathes := make([]string, len(names))
+	for i, name := range names {
+		pathes[i] = filepath.Join(dir, name)
+
+		raw, err := os.ReadFile(filepath.Join("testdata", name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			t.Fatalf("failed to read testdata: %s", err)
+		}
+		if err := os.WriteFile(pathes[i], raw, 0644); err != nil {
+			t.Fatalf("failed to copy testdata: %s", err)
+		}
+	}
+	return pathes
+}
+
 func Test_fileScanner_longPeriod(t *testing.T) {
 	t.Parallel()
 
-	s, err := newFileScanner("testdata/long-period.log", time.Date(2021, 1, 2, 15, 0, 0, 0, time.UTC), time.Date(2021, 1, 2, 17, 0, 0, 0, time.UTC))
+	s, err := newFileScanner(copyTestdata(t, "long-period.log")[0], time.Date(2021, 1, 2, 15, 0, 0, 0, time.UTC), time.Date(2021, 1, 2, 17, 0, 0, 0, time.UTC), nil, true)
 	if err != nil {
 		t.Fatalf("failed to open scanner: %s", err)
 	}
@@ -34,7 +56,7 @@ func Test_fileScanner_longPeriod(t *testing.T) {
 func Test_fileScannerSet(t *testing.T) {
 	t.Parallel()
 
-	s, err := newFileScannerSet([]string{"testdata/dummy-a.log", "testdata/no-such-file.log", "testdata/dummy-b.log", "testdata/invalid.log"}, time.Unix(0, 0), time.Unix(1<<60-1, 0))
+	s, err := newFileScannerSet(copyTestdata(t, "dummy-a.log", "no-such-file.log", "dummy-b.log", "invalid.log"), time.Unix(0, 0), time.Unix(1<<60-1, 0), nil, "")
 	if err != nil {
 		t.Fatalf("failed to open scanner set: %s", err)
 	}
@@ -62,7 +84,7 @@ func Test_fileScannerSet(t *testing.T) {
 func Test_fileScannerSet_empty(t *testing.T) {
 	t.Parallel()
 
-	s, err := newFileScannerSet([]string{"testdata/no-such-file.log"}, time.Unix(0, 0), time.Unix(1<<60-1, 0))
+	s, err := newFileScannerSet([]string{"testdata/no-such-file.log"}, time.Unix(0, 0), time.Unix(1<<60-1, 0), nil, "")
 	if err != nil {
 		t.Fatalf("failed to open scanner set: %s", err)
 	}
@@ -105,7 +127,7 @@ func Benchmark_fileScanner(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		s, err := newFileScanner(p, time.Unix(0, 0), time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC))
+		s, err := newFileScanner(p, time.Unix(0, 0), time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), nil, true)
 		if err != nil {
 			b.Fatalf("failed to open scanner: %s", err)
 		}
@@ -20,7 +20,9 @@ func Test_fileScannerSet_permissionDenied(t *testing.T) {
 		t.Fatalf("failed to make test directory: %s", err)
 	}
 
-	s, err := newFileScannerSet([]string{"testdata/dummy-a.log", path, "testdata/dummy-b.log"}, time.Unix(0, 0), time.Unix(1<<60-1, 0))
+	pathes := copyTestdata(t, "dummy-a.log", "dummy-b.log")
+
+	s, err := newFileScannerSet([]string{pathes[0], path, pathes[1]}, time.Unix(0, 0), time.Unix(1<<60-1, 0), nil, "")
 	if err == nil {
 		s.Close()
 		t.Fatalf("expected error but got nil")
@@ -3,6 +3,7 @@ package store_test
 import (
 	"io"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -126,3 +127,91 @@ func TestStore_OpenLog_logRemoved(t *testing.T) {
 		r.Close()
 	}
 }
+
+func TestStore_OpenLogByTarget(t *testing.T) {
+	inMemory, err := store.New("", "", io.Discard)
+	if err != nil {
+		t.Fatalf("failed to create in-memory store: %s", err)
+	}
+	defer inMemory.Close()
+	inStorage := testutil.NewStore(t, testutil.WithLog())
+	defer inStorage.Close()
+
+	dbpath := filepath.Join(t.TempDir(), "ayd.db")
+	if _, err := store.ImportToSQLite(dbpath, api.NewLogScanner(io.NopCloser(strings.NewReader(testutil.DummyLog)))); err != nil {
+		t.Fatalf("failed to prepare database: %s", err)
+	}
+	inDatabase, err := store.New("", store.SQLitePrefix+dbpath, io.Discard)
+	if err != nil {
+		t.Fatalf("failed to create SQLite store: %s", err)
+	}
+	defer inDatabase.Close()
+
+	if scanner, err := inStorage.OpenLog(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Now()); err != nil {
+		t.Fatalf("failed to prepare in-memory store: %s", err)
+	} else {
+		for scanner.Scan() {
+			inMemory.Report(scanner.Record().Target, scanner.Record())
+		}
+		scanner.Close()
+	}
+
+	stores := []struct {
+		Name  string
+		Store *store.Store
+	}{
+		{"in-memory", inMemory},
+		{"storage", inStorage},
+		{"sqlite", inDatabase},
+	}
+
+	tests := []struct {
+		Name     string
+		Match    func(*api.URL) bool
+		Messages []string
+	}{
+		{
+			"single-target",
+			func(u *api.URL) bool { return u.Host == "b.example.com" },
+			[]string{"this is failure", "this is healthy"},
+		},
+		{
+			"multiple-targets",
+			func(u *api.URL) bool { return u.Host != "a.example.com" },
+			[]string{"this is failure", "this is healthy", "this is aborted", "this is unknown"},
+		},
+		{
+			"no-target",
+			func(u *api.URL) bool { return false },
+			nil,
+		},
+		{
+			"all-targets",
+			nil,
+			[]string{"hello world", "this is failure", "hello world!", "this is healthy", "hello world!!", "this is aborted", "this is unknown"},
+		},
+	}
+
+	for _, s := range stores {
+		t.Run(s.Name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.Name, func(t *testing.T) {
+					scanner, err := s.Store.OpenLogByTarget(time.Date(2021, 1, 2, 15, 4, 0, 0, time.UTC), time.Date(2021, 1, 2, 15, 4, 10, 0, time.UTC), tt.Match)
+					if err != nil {
+						t.Fatalf("failed to open scanner: %s", err)
+					}
+					defer scanner.Close()
+
+					var actual []string
+					for scanner.Scan() {
+						actual = append(actual, scanner.Record().Message)
+					}
+
+					if diff := cmp.Diff(tt.Messages, actual); diff != "" {
+						t.Error(diff)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	api "github.com/macrat/ayd/lib-ayd"
+	_ "modernc.org/sqlite"
+)
+
+// SQLitePrefix is the prefix of the log path to use SQLite database instead of log files, like "sqlite:/path/to/ayd.db".
+const SQLitePrefix = "sqlite:"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS records (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	time   INTEGER NOT NULL,
+	target TEXT    NOT NULL,
+	status TEXT    NOT NULL,
+	record TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS records_time ON records (time, id);
+CREATE INDEX IF NOT EXISTS records_target_time ON records (target, time);
+`
+
+// IsSQLitePath returns true if the log path means SQLite database.
+func IsSQLitePath(path string) bool {
+	return strings.HasPrefix(path, SQLitePrefix)
+}
+
+// sqliteDB is a log storage in SQLite database.
+// Each record is stored as the same JSON as the log file, with indexed columns for searching.
+type sqliteDB struct {
+	path   string
+	db     *sql.DB
+	insert *sql.Stmt
+}
+
+// openSQLite opens or creates SQLite database for logs.
+func openSQLite(path string) (*sqliteDB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA synchronous = NORMAL", "PRAGMA busy_timeout = 5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	insert, err := db.Prepare(`INSERT INTO records (time, target, status, record) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteDB{
+		path:   path,
+		db:     db,
+		insert: insert,
+	}, nil
+}
+
+func (d *sqliteDB) Close() error {
+	d.insert.Close()
+	return d.db.Close()
+}
+
+// Insert adds a record to the database.
+func (d *sqliteDB) Insert(r api.Record) error {
+	_, err := d.insert.Exec(r.Time.UnixNano(), r.Target.String(), r.Status.String(), r.String())
+	return err
+}
+
+// InsertAll adds all records in the scanner to the database in a transaction.
+func (d *sqliteDB) InsertAll(s api.LogScanner) (count int, err error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	stmt := tx.Stmt(d.insert)
+
+	for s.Scan() {
+		r := s.Record()
+		if _, err := stmt.Exec(r.Time.UnixNano(), r.Target.String(), r.Status.String(), r.String()); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		count++
+	}
+
+	return count, tx.Commit()
+}
+
+// OpenLog opens a scanner for records between since and until, of the targets that match.
+// The match function can be nil to read all targets.
+func (d *sqliteDB) OpenLog(since, until time.Time, match func(*api.URL) bool) (api.LogScanner, error) {
+	query := `SELECT record FROM records WHERE time >= ? AND time < ?`
+	args := []any{since.UnixNano(), until.UnixNano()}
+
+	if match != nil {
+		targets, all, err := d.matchTargets(match)
+		if err != nil {
+			return nil, err
+		}
+		if !all {
+			query += ` AND target IN (` + strings.TrimSuffix(strings.Repeat(`?, `, len(targets)), `, `) + `)`
+			args = append(args, targets...)
+		}
+	}
+
+	rows, err := d.db.Query(query+` ORDER BY time, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteScanner{rows: rows}, nil
+}
+
+// matchTargets returns the targets in the database that match.
+// The all is true if all targets match.
+func (d *sqliteDB) matchTargets(match func(*api.URL) bool) (targets []any, all bool, err error) {
+	rows, err := d.db.Query(`SELECT DISTINCT target FROM records`)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	all = true
+	for rows.Next() {
+		var target string
+		if err := rows.Scan(&target); err != nil {
+			return nil, false, err
+		}
+		if u, err := api.ParseURL(target); err != nil || match(u) {
+			targets = append(targets, target)
+		} else {
+			all = false
+		}
+	}
+	return targets, all, rows.Err()
+}
+
+// Latest returns the latest records up to maxSize bytes in JSON, sorted by time.
+func (d *sqliteDB) Latest(maxSize int64) ([]api.Record, error) {
+	rows, err := d.db.Query(`SELECT record FROM records ORDER BY time DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rs []api.Record
+	var size int64
+	for size < maxSize && rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		size += int64(len(raw)) + 1
+
+		var r api.Record
+		if err := r.UnmarshalJSON([]byte(raw)); err != nil {
+			continue
+		}
+		rs = append(rs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+		rs[i], rs[j] = rs[j], rs[i]
+	}
+
+	return rs, nil
+}
+
+type sqliteScanner struct {
+	rows *sql.Rows
+	rec  api.Record
+}
+
+func (s *sqliteScanner) Scan() bool {
+	for s.rows.Next() {
+		var raw string
+		if err := s.rows.Scan(&raw); err != nil {
+			return false
+		}
+		if err := s.rec.UnmarshalJSON([]byte(raw)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sqliteScanner) Record() api.Record {
+	return s.rec
+}
+
+func (s *sqliteScanner) Close() error {
+	return s.rows.Close()
+}
+
+// ImportToSQLite imports all records in the scanner into the SQLite database at path.
+// The database is created if not exists.
+func ImportToSQLite(path string, s api.LogScanner) (count int, err error) {
+	path = strings.TrimPrefix(path, SQLitePrefix)
+	if path == "" {
+		return 0, errors.New("path to SQLite database is empty")
+	}
+
+	db, err := openSQLite(path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return db.InsertAll(s)
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -13,6 +12,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/macrat/ayd/internal/logconv"
+	"github.com/macrat/ayd/internal/stats"
 	api "github.com/macrat/ayd/lib-ayd"
 )
 
@@ -31,9 +32,34 @@ type RecordHandler func(api.Record)
 type Store struct {
 	name string
 	path PathPattern
+	db   *sqliteDB
 
 	Console io.Writer
 
+	// ConsoleFormat is the format of the log lines written to Console.
+	ConsoleFormat logconv.Format
+
+	// ConsoleColor colorizes the log lines written to Console, if ConsoleFormat is logconv.FormatText.
+	ConsoleColor bool
+
+	// Compression is the compression method for log files that no longer be written.
+	// Log files are not compressed if it is CompressionNone.
+	Compression Compression
+
+	// Retention is the policy to remove old log files.
+	Retention RetentionPolicy
+
+	// MaxFileSize is the size in bytes to rotate log files.
+	// It works only if the log file path has the sequence number spec %N.
+	MaxFileSize int64
+
+	// Rollup enables writing hourly and daily rollups into the "rollup" directory next to log files.
+	Rollup bool
+
+	// Masker hides secrets in target URLs when records leave this Store, like logs, callbacks, and the results of methods.
+	// Store keeps the original URLs inside, to distinguish targets that differ only in secrets.
+	Masker api.SecretMasker
+
 	historyLock      sync.RWMutex
 	probeHistory     probeHistoryMap
 	currentIncidents map[string]*api.Incident
@@ -42,19 +68,46 @@ type Store struct {
 	OnStatusChanged []RecordHandler
 	incidentCount   int
 
+	// OnReport is called with every record reported to this Store, including records about Ayd itself and alerts.
+	OnReport []RecordHandler
+
+	metrics metricsMap
+
 	writeCh       chan<- api.Record
 	writerStopped chan struct{}
+	writingLock   sync.Mutex
+	writingPath   string
+	maintainLock  sync.Mutex
+	maintainWG    sync.WaitGroup
+	rollupLock    sync.Mutex
+	rollupEnds    map[stats.RollupInterval]time.Time
+	closingLock   sync.Mutex
+	closing       bool
 	errorsLock    sync.RWMutex
 	errors        []string
+	errorCount    uint64
 	healthy       bool
 }
 
+// New creates a new Store.
+// The path is a pattern of log file names, or a path to SQLite database with "sqlite:" prefix.
 func New(name, path string, console io.Writer) (*Store, error) {
+	var db *sqliteDB
+	if IsSQLitePath(path) {
+		var err error
+		db, err = openSQLite(strings.TrimPrefix(path, SQLitePrefix))
+		if err != nil {
+			return nil, err
+		}
+		path = ""
+	}
+
 	ch := make(chan api.Record, 32)
 
 	store := &Store{
 		name:             name,
 		path:             ParsePathPattern(path),
+		db:               db,
 		Console:          console,
 		probeHistory:     make(probeHistoryMap),
 		currentIncidents: make(map[string]*api.Incident),
@@ -73,8 +126,11 @@ func (s *Store) Name() string {
 	return s.name
 }
 
-// Path returns pathes to log files.
+// Path returns pathes to log files, or the path to the database if SQLite is used.
 func (s *Store) Pathes() []string {
+	if s.db != nil {
+		return []string{s.db.path}
+	}
 	return s.path.ListAll()
 }
 
@@ -115,13 +171,30 @@ func (s *Store) writer(ch <-chan api.Record, stopped chan struct{}) {
 
 	var f *os.File
 	var fpath string
+	var fperiod string
+	var fseq int
+	var fsize int64
 	var closeTimer <-chan time.Time
+	var lastMaintained time.Time
+
+	var idx *logIndex
+	var idxSaved time.Time
 
-	closeFile := func() {
+	// saveIndex saves the index of the current log file.
+	// The index is saved at most once per minute unless forced, because the records after the saved index are indexed by readers when needed.
+	saveIndex := func(force bool) {
+		if idx != nil && idx.dirty && (force || time.Since(idxSaved) >= time.Minute) {
+			idxSaved = time.Now()
+			s.handleError(idx.save(fpath), "failed to save log index")
+		}
+	}
+
+	closeFile := func(force bool) {
 		err = f.Close()
 		s.handleError(err, "failed to close log file")
 		f = nil
 		closeTimer = nil
+		saveIndex(force)
 	}
 
 	for {
@@ -131,14 +204,16 @@ func (s *Store) writer(ch <-chan api.Record, stopped chan struct{}) {
 		case r, ok = <-ch:
 			if !ok {
 				if f != nil {
-					closeFile()
+					closeFile(true)
+				} else {
+					saveIndex(true)
 				}
 				close(stopped)
 				return
 			}
 		case <-closeTimer:
 			if f != nil {
-				closeFile()
+				closeFile(false)
 			}
 			continue
 		}
@@ -146,7 +221,17 @@ func (s *Store) writer(ch <-chan api.Record, stopped chan struct{}) {
 		msg := r.String() + "\n"
 
 		reader.Reset(msg)
-		reader.WriteTo(s.Console)
+		if s.ConsoleFormat == logconv.FormatJSON {
+			reader.WriteTo(s.Console)
+		} else {
+			io.WriteString(s.Console, s.ConsoleFormat.Line(r, s.ConsoleColor)+"\n")
+		}
+
+		if s.db != nil {
+			s.setHealthy()
+			s.handleError(s.db.Insert(r), "failed to write log database")
+			continue
+		}
 
 		if s.path.IsEmpty() {
 			continue
@@ -154,14 +239,42 @@ func (s *Store) writer(ch <-chan api.Record, stopped chan struct{}) {
 
 		s.setHealthy()
 
-		p := s.path.Build(r.Time)
+		period := s.path.Build(r.Time)
+		rotateBySize := s.MaxFileSize > 0 && s.path.HasSeq()
 
-		if fpath != p && f != nil {
-			closeFile()
+		if f != nil && (fperiod != period || rotateBySize && fsize >= s.MaxFileSize) {
+			closeFile(true)
 		}
 
 		if f == nil {
-			fpath = p
+			if fperiod != period {
+				fperiod = period
+				fseq = 1
+				if rotateBySize {
+					seq, compressed := s.path.LastSeq(r.Time)
+					fseq = seq
+					if compressed {
+						fseq++
+					}
+				}
+			}
+
+			newPath := s.path.BuildSeq(r.Time, fseq)
+			for rotateBySize {
+				if st, err := os.Stat(newPath); err != nil || st.Size() < s.MaxFileSize {
+					break
+				}
+				fseq++
+				newPath = s.path.BuildSeq(r.Time, fseq)
+			}
+
+			if newPath != fpath {
+				saveIndex(true)
+				idx = nil
+				fpath = newPath
+				s.setWritingPath(fpath)
+			}
+
 			if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
 				s.handleError(err, "failed to create log directory")
 			}
@@ -172,20 +285,121 @@ func (s *Store) writer(ch <-chan api.Record, stopped chan struct{}) {
 				continue
 			}
 
+			fsize = 0
+			if st, err := f.Stat(); err == nil {
+				fsize = st.Size()
+			}
+
+			if idx == nil || idx.Size != fsize {
+				idx, err = loadLogIndex(fpath, fsize)
+				s.handleError(err, "failed to load log index")
+			}
+
 			// Ayd uses log file handler for 100 milliseconds.
 			// It is long enough to write logs from probes they run at the same time, yet short enough to avoid causing trouble when log rotation or file deletion happened.
 			closeTimer = time.After(100 * time.Millisecond)
+
+			if time.Since(lastMaintained) >= time.Minute {
+				lastMaintained = time.Now()
+				s.startMaintenance()
+			}
 		}
 
 		reader.Seek(0, io.SeekStart)
-		_, err = reader.WriteTo(f)
+		var n int64
+		n, err = reader.WriteTo(f)
+		if err == nil && idx != nil {
+			idx.add(r.Time, r.Target.String(), fsize, n)
+		}
+		fsize += n
 		s.handleError(err, "failed to write log file")
 	}
 }
 
+// setWritingPath sets the path of the log file that the writer is writing.
+func (s *Store) setWritingPath(path string) {
+	s.writingLock.Lock()
+	defer s.writingLock.Unlock()
+	s.writingPath = path
+}
+
+// getWritingPath returns the path of the log file that the writer is writing.
+// The index of this file is saved only by the writer.
+func (s *Store) getWritingPath() string {
+	s.writingLock.Lock()
+	defer s.writingLock.Unlock()
+	return s.writingPath
+}
+
 func (s *Store) Close() error {
+	s.closingLock.Lock()
+	s.closing = true
+	s.closingLock.Unlock()
+
+	s.maintainWG.Wait()
+
 	close(s.writeCh)
 	<-s.writerStopped
+
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
+
+// startMaintenance starts summarizing, pruning, and compressing old log files in background.
+func (s *Store) startMaintenance() {
+	if s.Compression == CompressionNone && s.Retention.IsEmpty() && !s.Rollup {
+		return
+	}
+
+	s.closingLock.Lock()
+	defer s.closingLock.Unlock()
+
+	if s.closing {
+		return
+	}
+
+	s.maintainWG.Add(1)
+	go func() {
+		defer s.maintainWG.Done()
+		// Rollups should be updated before pruning, to summarize records in the files to be removed.
+		if err := s.UpdateRollups(); err != nil {
+			s.ReportInternalError("log", "failed to update rollup: "+err.Error())
+		}
+		if err := s.PruneLogs(); err != nil {
+			s.ReportInternalError("log", "failed to prune log file: "+err.Error())
+		}
+		if err := s.CompressLogs(); err != nil {
+			s.ReportInternalError("log", "failed to compress log file: "+err.Error())
+		}
+	}()
+}
+
+// CompressLogs compresses the log files that no longer be written, by the method in s.Compression.
+// The log files for the last 70 minutes are not compressed, because the records from plugins can be delayed by up to 60 minutes.
+func (s *Store) CompressLogs() error {
+	if s.Compression == CompressionNone || s.path.IsEmpty() {
+		return nil
+	}
+
+	s.maintainLock.Lock()
+	defer s.maintainLock.Unlock()
+
+	now := time.Now()
+
+	for _, p := range s.path.ListAll() {
+		if trimCompressionExt(p) != p {
+			continue
+		}
+		if s.path.Match(p, now.Add(-70*time.Minute), now) {
+			continue
+		}
+		if err := compressFile(p, s.Compression); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -198,7 +412,7 @@ func (s *Store) ProbeHistory() []api.ProbeHistory {
 	var result []api.ProbeHistory
 	for _, x := range s.probeHistory {
 		if x.isActive() {
-			result = append(result, x.MakeReport(PROBE_HISTORY_LEN))
+			result = append(result, s.maskProbeHistory(x.MakeReport(PROBE_HISTORY_LEN)))
 		}
 	}
 
@@ -216,7 +430,7 @@ func (s *Store) Targets() []string {
 	result := make([]string, len(s.probeHistory))
 	i := 0
 	for _, x := range s.probeHistory {
-		result[i] = x.Target.String()
+		result[i] = s.Masker.MaskURL(x.Target).String()
 		i++
 	}
 
@@ -243,7 +457,7 @@ func (s *Store) CurrentIncidents() []*api.Incident {
 	s.historyLock.RLock()
 	defer s.historyLock.RUnlock()
 
-	return s.currentIncidentsWithoutLock()
+	return s.maskIncidents(s.currentIncidentsWithoutLock())
 }
 
 func (s *Store) incidentHistoryWithoutLock() []*api.Incident {
@@ -262,7 +476,31 @@ func (s *Store) IncidentHistory() []*api.Incident {
 	s.historyLock.RLock()
 	defer s.historyLock.RUnlock()
 
-	return s.incidentHistoryWithoutLock()
+	return s.maskIncidents(s.incidentHistoryWithoutLock())
+}
+
+// maskProbeHistory returns a copy of the ProbeHistory that the secrets in the target URLs are masked by s.Masker.
+func (s *Store) maskProbeHistory(h api.ProbeHistory) api.ProbeHistory {
+	h.Target = s.Masker.MaskURL(h.Target)
+
+	rs := make([]api.Record, len(h.Records))
+	for i, r := range h.Records {
+		rs[i] = s.Masker.MaskRecord(r)
+	}
+	h.Records = rs
+
+	return h
+}
+
+// maskIncidents returns copies of the incidents that the secrets in the target URLs are masked by s.Masker.
+func (s *Store) maskIncidents(xs []*api.Incident) []*api.Incident {
+	result := make([]*api.Incident, len(xs))
+	for i, x := range xs {
+		y := *x
+		y.Target = s.Masker.MaskURL(x.Target)
+		result[i] = &y
+	}
+	return result
 }
 
 func (s *Store) searchLastIncident(target string, t time.Time) *api.Incident {
@@ -331,7 +569,7 @@ func (s *Store) setIncidentIfNeed(r api.Record, needCallback bool) {
 		// kick incident callback when recover
 		if r.Status == api.StatusHealthy && needCallback {
 			for _, cb := range s.OnStatusChanged {
-				cb(r)
+				cb(s.Masker.MaskRecord(r))
 			}
 		}
 	}
@@ -355,9 +593,9 @@ func (s *Store) setIncidentIfNeed(r api.Record, needCallback bool) {
 			if needCallback {
 				s.incidentCount++
 				for _, cb := range s.OnStatusChanged {
-					cb(r)
+					cb(s.Masker.MaskRecord(r))
 					if next.Status == api.StatusHealthy {
-						cb(next)
+						cb(s.Masker.MaskRecord(next))
 					}
 				}
 			}
@@ -368,7 +606,7 @@ func (s *Store) setIncidentIfNeed(r api.Record, needCallback bool) {
 			if needCallback {
 				s.incidentCount++
 				for _, cb := range s.OnStatusChanged {
-					cb(r)
+					cb(s.Masker.MaskRecord(r))
 				}
 			}
 		}
@@ -379,20 +617,33 @@ func (s *Store) setIncidentIfNeed(r api.Record, needCallback bool) {
 //
 // See also probeHistoryMap.Append about the arguments.
 func (s *Store) Report(source *api.URL, r api.Record) {
-	r.Message = strings.Trim(r.Message, "\r\n")
+	r.Message = s.Masker.MaskMessage(r.Target, strings.Trim(r.Message, "\r\n"))
+
+	masked := s.Masker.MaskRecord(r)
 
-	s.writeCh <- r
+	s.writeCh <- masked
+
+	for _, cb := range s.OnReport {
+		cb(masked)
+	}
 
 	if r.Target.Scheme != "alert" && r.Target.Scheme != "ayd" {
+		s.metrics.Observe(r)
+
 		s.historyLock.Lock()
 		defer s.historyLock.Unlock()
 
+		s.takeOverRestored(r.Target)
 		s.setIncidentIfNeed(r, true)
 		s.probeHistory.Append(source, r)
 	}
 }
 
 func (s *Store) Restore() error {
+	if s.db != nil {
+		return s.restoreFromDB()
+	}
+
 	if s.path.IsEmpty() {
 		return nil
 	}
@@ -427,23 +678,27 @@ func (s *Store) Restore() error {
 }
 
 func (s *Store) restoreOneFile(path string, maxSize int64) (int64, error) {
-	f, err := os.OpenFile(path, os.O_RDONLY, 0644)
+	rc, f, c, err := openLogFile(path)
 	if errors.Is(err, os.ErrNotExist) {
 		return 0, nil
 	} else if err != nil {
 		return 0, err
 	}
-	defer f.Close()
+	defer rc.Close()
+
+	if c != CompressionNone {
+		return s.restoreCompressedFile(rc, maxSize)
+	}
 
-	size, err := f.Seek(0, os.SEEK_END)
+	size, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
 		return 0, err
 	}
 
 	if size > maxSize {
-		f.Seek(-maxSize, os.SEEK_END)
+		f.Seek(-maxSize, io.SeekEnd)
 	} else {
-		f.Seek(0, os.SEEK_SET)
+		f.Seek(0, io.SeekStart)
 	}
 
 	reader := bufio.NewReader(f)
@@ -452,23 +707,114 @@ func (s *Store) restoreOneFile(path string, maxSize int64) (int64, error) {
 		if err != nil {
 			break
 		}
+		s.restoreLine(line)
+	}
 
-		var r api.Record
-		if err = r.UnmarshalJSON(line); err != nil {
-			continue
+	return size, nil
+}
+
+// restoreCompressedFile restores the last maxSize bytes of decompressed log.
+// Compressed files can not seek, so it reads whole file and keeps only the last lines in memory.
+func (s *Store) restoreCompressedFile(r io.Reader, maxSize int64) (int64, error) {
+	var lines [][]byte
+	var size, total int64
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
 		}
 
-		if _, ok := r.Target.User.Password(); ok {
-			r.Target.User = url.UserPassword(r.Target.User.Username(), "xxxxx")
+		lines = append(lines, line)
+		size += int64(len(line))
+		total += int64(len(line))
+		for size > maxSize && len(lines) > 0 {
+			size -= int64(len(lines[0]))
+			lines = lines[1:]
+		}
+	}
+
+	for _, line := range lines {
+		s.restoreLine(line)
+	}
+
+	return total, nil
+}
+
+func (s *Store) restoreFromDB() error {
+	rs, err := s.db.Latest(LogRestoreBytes)
+	if err != nil {
+		return err
+	}
+
+	s.historyLock.Lock()
+	defer s.historyLock.Unlock()
+
+	s.probeHistory = make(probeHistoryMap)
+
+	for _, r := range rs {
+		s.restoreRecord(r)
+	}
+
+	for k := range s.probeHistory {
+		s.probeHistory[k].setInactive()
+	}
+
+	return nil
+}
+
+func (s *Store) restoreLine(line []byte) {
+	var r api.Record
+	if err := r.UnmarshalJSON(line); err != nil {
+		return
+	}
+	s.restoreRecord(r)
+}
+
+func (s *Store) restoreRecord(r api.Record) {
+	// The log may be written with the other masking settings, so mask it again to match with the masked targets.
+	r = s.Masker.MaskRecord(r)
+
+	if r.Target.Scheme != "alert" && r.Target.Scheme != "ayd" {
+		s.setIncidentIfNeed(r, false)
+		s.probeHistory.Append(r.Target, r)
+	}
+}
+
+// takeOverRestored moves the history and incidents restored from the log to the target.
+// The log has masked URLs, so the restored ones are not the same as the target if it has secrets.
+func (s *Store) takeOverRestored(target *api.URL) {
+	t := target.String()
+	m := s.Masker.MaskURL(target).String()
+	if t == m {
+		return
+	}
+
+	if h, ok := s.probeHistory[m]; ok {
+		if _, exists := s.probeHistory[t]; !exists {
+			delete(s.probeHistory, m)
+			h.Target = target
+			for i := range h.Records {
+				h.Records[i].Target = target
+			}
+			s.probeHistory[t] = h
 		}
+	}
 
-		if r.Target.Scheme != "alert" && r.Target.Scheme != "ayd" {
-			s.setIncidentIfNeed(r, false)
-			s.probeHistory.Append(r.Target, r)
+	if x, ok := s.currentIncidents[m]; ok {
+		if _, exists := s.currentIncidents[t]; !exists {
+			delete(s.currentIncidents, m)
+			x.Target = target
+			s.currentIncidents[t] = x
 		}
 	}
 
-	return size, nil
+	for _, x := range s.incidentHistory {
+		if x.Target.String() == m {
+			x.Target = target
+		}
+	}
 }
 
 // ActivateTarget marks the target will reported via specified source.
@@ -477,6 +823,8 @@ func (s *Store) ActivateTarget(source, target *api.URL) {
 	s.historyLock.Lock()
 	defer s.historyLock.Unlock()
 
+	s.takeOverRestored(target)
+
 	t := target.String()
 
 	if _, ok := s.probeHistory[t]; !ok {
@@ -516,6 +864,7 @@ func (s *Store) addError(message string) {
 	defer s.errorsLock.Unlock()
 
 	s.healthy = false
+	s.errorCount++
 	s.errors = append(
 		s.errors,
 		fmt.Sprintf("%s\t%s", time.Now().Format(time.RFC3339), message),
@@ -540,8 +889,8 @@ func (s *Store) MakeReport(probeHistoryLength int) api.Report {
 	s.historyLock.RLock()
 	defer s.historyLock.RUnlock()
 
-	ci := s.currentIncidentsWithoutLock()
-	ih := s.incidentHistoryWithoutLock()
+	ci := s.maskIncidents(s.currentIncidentsWithoutLock())
+	ih := s.maskIncidents(s.incidentHistoryWithoutLock())
 
 	report := api.Report{
 		InstanceName:     s.name,
@@ -559,9 +908,10 @@ func (s *Store) MakeReport(probeHistoryLength int) api.Report {
 		report.IncidentHistory[i] = *x
 	}
 
-	for k, v := range s.probeHistory {
+	for _, v := range s.probeHistory {
 		if v.isActive() {
-			report.ProbeHistory[k] = v.MakeReport(probeHistoryLength)
+			h := s.maskProbeHistory(v.MakeReport(probeHistoryLength))
+			report.ProbeHistory[h.Target.String()] = h
 		}
 	}
 
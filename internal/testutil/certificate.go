@@ -48,31 +48,84 @@ func generatePrivateKey(t *testing.T) *rsa.PrivateKey {
 	return priv
 }
 
+// NewCertificate makes a self-signed server certificate for localhost.
 func NewCertificate(t *testing.T) Certificate {
+	return newCertificate(t, &x509.Certificate{
+		DNSNames:     []string{"localhost"},
+		SerialNumber: generateSerialNumber(t),
+		Subject: pkix.Name{
+			Organization: []string{"Ayd"},
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(3 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}, nil)
+}
+
+// NewCACertificate makes a self-signed CA certificate.
+func NewCACertificate(t *testing.T) Certificate {
+	return newCertificate(t, &x509.Certificate{
+		SerialNumber: generateSerialNumber(t),
+		Subject: pkix.Name{
+			Organization: []string{"Ayd"},
+			CommonName:   "Ayd Test CA",
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(3 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil)
+}
+
+// NewClientCertificate makes a client certificate that signed by the ca.
+func NewClientCertificate(t *testing.T, ca Certificate) Certificate {
+	return newCertificate(t, &x509.Certificate{
+		SerialNumber: generateSerialNumber(t),
+		Subject: pkix.Name{
+			Organization: []string{"Ayd"},
+			CommonName:   "client",
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(3 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}, &ca)
+}
+
+// TLSCertificate returns tls.Certificate for use as a client certificate.
+func (c Certificate) TLSCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %s", err)
+	}
+	return cert
+}
+
+func newCertificate(t *testing.T, template *x509.Certificate, parent *Certificate) Certificate {
 	baseDir := t.TempDir()
 
 	c := Certificate{
-		PrivateKey: generatePrivateKey(t),
-		CertFile:   filepath.Join(baseDir, "cert.pem"),
-		KeyFile:    filepath.Join(baseDir, "key.pem"),
-		Certificate: &x509.Certificate{
-			DNSNames:     []string{"localhost"},
-			SerialNumber: generateSerialNumber(t),
-			Subject: pkix.Name{
-				Organization: []string{"Ayd"},
-			},
-			NotBefore:             time.Now(),
-			NotAfter:              time.Now().Add(3 * time.Hour),
-			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-			BasicConstraintsValid: true,
-		},
+		PrivateKey:  generatePrivateKey(t),
+		CertFile:    filepath.Join(baseDir, "cert.pem"),
+		KeyFile:     filepath.Join(baseDir, "key.pem"),
+		Certificate: template,
+	}
+
+	if parent == nil {
+		parent = &c
 	}
 
-	der, err := x509.CreateCertificate(rand.Reader, c.Certificate, c.Certificate, &c.PrivateKey.PublicKey, c.PrivateKey)
+	der, err := x509.CreateCertificate(rand.Reader, c.Certificate, parent.Certificate, &c.PrivateKey.PublicKey, parent.PrivateKey)
 	if err != nil {
 		t.Fatalf("failed to generate certificate: %s", err)
 	}
+	if c.Certificate, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("failed to parse generated certificate: %s", err)
+	}
 
 	certOut, err := os.Create(c.CertFile)
 	if err != nil {
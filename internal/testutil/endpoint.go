@@ -21,5 +21,5 @@ func StartTestServer(t testing.TB, opts ...StoreOption) *httptest.Server {
 		s.ActivateTarget(u, u)
 	}
 
-	return httptest.NewServer(endpoint.New(s))
+	return httptest.NewServer(endpoint.New(s, endpoint.Config{}))
 }
@@ -2,8 +2,82 @@ package ayd
 
 import (
 	"net/url"
+	"strings"
 )
 
+const maskedSecret = "xxxxx"
+
+// DefaultSensitiveQueryKeys is the query keys that SecretMasker always treats as secrets.
+var DefaultSensitiveQueryKeys = []string{"password", "passwd", "secret", "token", "access_token", "apikey", "api_key"}
+
+// SecretMasker hides secrets in target URLs and messages, like the password in the URL or the value of "token" query.
+// The zero value masks the password and the values of DefaultSensitiveQueryKeys.
+type SecretMasker struct {
+	queryKeys map[string]struct{}
+	values    []string
+}
+
+// NewSecretMasker makes a SecretMasker that masks the values of queryKeys in addition to DefaultSensitiveQueryKeys.
+// Keys are case-insensitive.
+func NewSecretMasker(queryKeys ...string) SecretMasker {
+	m := SecretMasker{queryKeys: make(map[string]struct{}, len(queryKeys))}
+	for _, k := range queryKeys {
+		m.queryKeys[strings.ToLower(k)] = struct{}{}
+	}
+	return m
+}
+
+// WithSecrets returns a copy of the SecretMasker that also masks the values in every part of URLs and messages.
+// It is useful for secrets that are not in the password or the query, like a value read from an environment variable.
+// Values shorter than 4 bytes are ignored, in the same way as MaskMessage.
+func (m SecretMasker) WithSecrets(values ...string) SecretMasker {
+	x := m
+	x.values = append([]string(nil), m.values...)
+	for _, v := range values {
+		x.values = appendSecretForms(x.values, v)
+	}
+	return x
+}
+
+func (m SecretMasker) isSensitiveQueryKey(key string) bool {
+	key = strings.ToLower(key)
+	if _, ok := m.queryKeys[key]; ok {
+		return true
+	}
+	for _, k := range DefaultSensitiveQueryKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// maskQuery replaces the values of the sensitive keys in the raw query.
+// The other part of the query is kept as is.
+func (m SecretMasker) maskQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+
+	parts := strings.Split(rawQuery, "&")
+	masked := false
+	for i, p := range parts {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || v == "" {
+			continue
+		}
+		if key, err := url.QueryUnescape(k); err == nil && m.isSensitiveQueryKey(key) {
+			parts[i] = k + "=" + maskedSecret
+			masked = true
+		}
+	}
+
+	if !masked {
+		return rawQuery
+	}
+	return strings.Join(parts, "&")
+}
+
 func isFragmentCodePoint(c byte) bool {
 	return (c == 0x21 ||
 		c == 0x24 ||
@@ -74,8 +148,130 @@ func (u *URL) ToURL() *url.URL {
 	return (*url.URL)(u)
 }
 
+// MaskURL returns a copy of the URL that the password, the values of sensitive query keys, and the values set by WithSecrets are masked.
+func (m SecretMasker) MaskURL(u *URL) *URL {
+	if u == nil {
+		return nil
+	}
+	x := *u
+	if len(m.values) > 0 {
+		if u.User != nil {
+			if p, ok := u.User.Password(); ok {
+				x.User = url.UserPassword(m.maskValues(u.User.Username()), m.maskValues(p))
+			} else {
+				x.User = url.User(m.maskValues(u.User.Username()))
+			}
+		}
+		x.Host = m.maskValues(u.Host)
+		x.Path = m.maskValues(u.Path)
+		x.RawPath = m.maskValues(u.RawPath)
+		x.Opaque = m.maskValues(u.Opaque)
+		x.RawQuery = m.maskValues(u.RawQuery)
+		x.Fragment = m.maskValues(u.Fragment)
+		x.RawFragment = m.maskValues(u.RawFragment)
+	}
+	if _, ok := x.User.Password(); ok {
+		x.User = url.UserPassword(x.User.Username(), maskedSecret)
+	}
+	x.RawQuery = m.maskQuery(x.RawQuery)
+	return &x
+}
+
+// minMaskLength is the minimum length of secrets to be masked in SecretMasker.MaskMessage.
+// Too short secrets are not masked, because it would break the whole message.
+const minMaskLength = 4
+
+// EscapeAll escapes all characters except unreserved characters in RFC 3986.
+// The result is safe to put in any part of URL, like the password, the path, or the query.
+func EscapeAll(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~' {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteByte('%')
+			sb.WriteByte(hex[c>>4])
+			sb.WriteByte(hex[c&15])
+		}
+	}
+	return sb.String()
+}
+
+// appendSecretForms appends the secret in raw and escaped forms to ss.
+// Too short secret is not appended.
+func appendSecretForms(ss []string, raw string) []string {
+	if len(raw) < minMaskLength {
+		return ss
+	}
+	ss = append(ss, raw)
+	for _, e := range []string{url.QueryEscape(raw), url.PathEscape(raw), EscapeAll(raw)} {
+		if e != raw {
+			ss = append(ss, e)
+		}
+	}
+	return ss
+}
+
+// maskValues replaces the values set by WithSecrets in s.
+func (m SecretMasker) maskValues(s string) string {
+	for _, v := range m.values {
+		s = strings.ReplaceAll(s, v, maskedSecret)
+	}
+	return s
+}
+
+// secrets returns the secret values in the URL, in both of raw and escaped forms.
+func (m SecretMasker) secrets(u *URL) []string {
+	var ss []string
+
+	add := func(raw string) {
+		ss = appendSecretForms(ss, raw)
+	}
+
+	if p, ok := u.User.Password(); ok {
+		add(p)
+	}
+	for _, p := range strings.Split(u.RawQuery, "&") {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || v == "" {
+			continue
+		}
+		if key, err := url.QueryUnescape(k); err == nil && m.isSensitiveQueryKey(key) {
+			if value, err := url.QueryUnescape(v); err == nil {
+				add(value)
+			}
+			add(v)
+		}
+	}
+
+	return ss
+}
+
+// MaskMessage replaces the secret values of the URL in s, like the password or the value of "token" query, and the values set by WithSecrets.
+// Secrets shorter than 4 bytes are kept as is.
+// It is useful to hide secrets in error messages that include the URL.
+func (m SecretMasker) MaskMessage(u *URL, s string) string {
+	s = m.maskValues(s)
+	if u == nil {
+		return s
+	}
+	for _, secret := range m.secrets(u) {
+		s = strings.ReplaceAll(s, secret, maskedSecret)
+	}
+	return s
+}
+
+// MaskRecord returns a copy of the Record that the secrets in the target URL and the message are masked.
+func (m SecretMasker) MaskRecord(r Record) Record {
+	r.Message = m.MaskMessage(r.Target, r.Message)
+	r.Target = m.MaskURL(r.Target)
+	return r
+}
+
 // String returns string version of the URL.
 // The password in the URL will be masked.
+// Please use SecretMasker to mask the other secrets like the values of "token" query.
 func (u URL) String() string {
 	s := u.ToURL().Redacted()
 	if u.Fragment != "" {